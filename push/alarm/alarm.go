@@ -0,0 +1,401 @@
+// Package alarm adds a raise/clear lifecycle on top of push.Record.
+//
+// A Manager tracks the active alarms of each NE, keyed by NE, alarm type
+// (schema.Alarm.AlarmID), and object. Raising an alarm that is already
+// active with the same severity is suppressed; clearing it sends a
+// "cleared" alarm record carrying the correlation ID of the raise. The
+// complete set of active alarms of each NE is re-sent periodically as an
+// "alarm_sync" snapshot, so receivers that missed a raise or clear
+// converge. All records are queued through push.Push.SendAsync with
+// client.PriorityHigh, so alarms overtake bulk traffic.
+//
+// Example:
+//
+//	m, err := alarm.New(p,
+//	    alarm.WithStore(alarm.NewFileStore("/var/lib/oam/alarms.json")),
+//	    alarm.WithSyncInterval(5*time.Minute),
+//	)
+//	if err != nil {
+//	    return err
+//	}
+//	defer m.Close()
+//
+//	m.Raise("ne-001", schema.Alarm{AlarmID: "link-down", Object: "eth0", Severity: schema.SeverityMajor})
+//	m.Raise("ne-001", schema.Alarm{AlarmID: "link-down", Object: "eth0", Severity: schema.SeverityMajor}) // suppressed
+//	m.Clear("ne-001", "link-down", "eth0")
+package alarm
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsmask/go-oam/pkg/generate"
+	"github.com/tsmask/go-oam/push"
+	"github.com/tsmask/go-oam/push/client"
+	"github.com/tsmask/go-oam/push/schema"
+	"github.com/tsmask/go-oam/push/timer"
+)
+
+// correlationIDSize is the length of generated correlation IDs.
+const correlationIDSize = 20
+
+// Key identifies an alarm instance.
+type Key struct {
+	NeUID  string // Network element ID
+	Type   string // Alarm type, schema.Alarm.AlarmID
+	Object string // Managed object, schema.Alarm.Object
+}
+
+// Active is an active alarm.
+type Active struct {
+	NeUID string       `json:"ne_uid"`
+	Alarm schema.Alarm `json:"alarm"` // Last raised state, with CorrelationID set
+}
+
+// Key returns the key of a.
+func (a Active) Key() Key {
+	return Key{NeUID: a.NeUID, Type: a.Alarm.AlarmID, Object: a.Alarm.Object}
+}
+
+// Stats reports Manager counters.
+type Stats struct {
+	Active     int    // Currently active alarms
+	Raised     uint64 // Raise records sent, including severity changes
+	Suppressed uint64 // Duplicate raises and clears of inactive alarms
+	Cleared    uint64 // Clear records sent
+	Syncs      uint64 // Sync snapshot records sent
+	SendErrors uint64 // Records that could not be queued or whose delivery failed
+	SaveErrors uint64 // Failed saves of the state to the Store
+}
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithStore persists active alarms and known NEs to s. New loads them back, so a
+// restarted Manager keeps suppressing duplicates and can still clear
+// alarms raised before the restart.
+//
+// Changes are saved by a background writer, outside the Manager lock;
+// changes made while a save is running are coalesced into the next save.
+// Close and Flush save the latest state synchronously.
+func WithStore(s Store) Option {
+	return func(m *Manager) { m.store = s }
+}
+
+// WithSyncInterval sends a sync snapshot of every known NE each interval.
+// Zero (the default) disables periodic sync; Sync can still be called.
+func WithSyncInterval(d time.Duration) Option {
+	return func(m *Manager) { m.syncInterval = d }
+}
+
+// WithSendParams sets the parameters used for every record sent. Records
+// are always queued with client.PriorityHigh; params.OnResult, if set,
+// receives the delivery outcome of each record.
+func WithSendParams(params *push.SendParams) Option {
+	return func(m *Manager) { m.params = params }
+}
+
+// Manager tracks active alarms and sends their lifecycle through a
+// push.Push. Safe for concurrent use. Records are delivered asynchronously,
+// so records of one alarm may arrive out of order; receivers can order
+// them by event time, and the next sync snapshot corrects the state.
+type Manager struct {
+	push         *push.Push
+	store        Store
+	syncInterval time.Duration
+	params       *push.SendParams
+	timer        *timer.Timer
+
+	mu     sync.Mutex
+	active map[Key]*Active
+	nes    map[string]struct{} // NEs that ever had an alarm; synced even when empty
+
+	saveMu    sync.Mutex    // Orders snapshot and Save, so saves never go back in time
+	dirty     chan struct{} // Signals the writer that the state changed
+	stop      chan struct{}
+	writerWg  sync.WaitGroup
+	closeOnce sync.Once
+
+	raised, suppressed, cleared, syncs, sendErrors, saveErrors atomic.Uint64
+}
+
+// New creates a Manager that sends through p. With WithStore, the state
+// saved by a previous Manager is loaded; its active alarms are reported by
+// the next sync snapshot.
+func New(p *push.Push, opts ...Option) (*Manager, error) {
+	m := &Manager{
+		push:   p,
+		active: make(map[Key]*Active),
+		nes:    make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.store != nil {
+		st, err := m.store.Load()
+		if err != nil {
+			return nil, fmt.Errorf("load alarm state: %w", err)
+		}
+		for _, ne := range st.NEs {
+			m.nes[ne] = struct{}{}
+		}
+		for i := range st.Active {
+			a := st.Active[i]
+			m.active[a.Key()] = &a
+			m.nes[a.NeUID] = struct{}{}
+		}
+	}
+
+	if m.store != nil {
+		m.dirty = make(chan struct{}, 1)
+		m.stop = make(chan struct{})
+		m.writerWg.Add(1)
+		go m.writeLoop()
+	}
+	if m.syncInterval > 0 {
+		m.timer = timer.New()
+		m.timer.Start(m.syncInterval, func(time.Time) { _ = m.Sync() })
+	}
+	return m, nil
+}
+
+// Close stops periodic sync and saves the latest state. Active alarms stay
+// in the store.
+func (m *Manager) Close() {
+	m.closeOnce.Do(func() {
+		if m.timer != nil {
+			m.timer.Stop()
+		}
+		if m.store != nil {
+			close(m.stop)
+			m.writerWg.Wait()
+			_ = m.Flush()
+		}
+	})
+}
+
+// Raise raises a on neUID and sends it as an "alarm" record.
+//
+// If the alarm is already active with the same severity, the raise is
+// suppressed and nothing is sent. A severity change is sent with the
+// correlation ID of the original raise. EventTime defaults to now. A
+// severity of "cleared" clears the alarm, as Clear does.
+//
+// The returned error covers validation and queuing; delivery failures are
+// reported to the OnResult of WithSendParams and counted in
+// Stats.SendErrors. The alarm stays active even if sending fails; the next
+// sync snapshot reports it. Returns a *schema.ValidationError when a is
+// invalid.
+func (m *Manager) Raise(neUID string, a schema.Alarm) error {
+	if a.Severity == schema.SeverityCleared {
+		return m.Clear(neUID, a.AlarmID, a.Object)
+	}
+	if a.EventTime == 0 {
+		a.EventTime = time.Now().UnixMilli()
+	}
+	key := Key{NeUID: neUID, Type: a.AlarmID, Object: a.Object}
+
+	m.mu.Lock()
+	cur, ok := m.active[key]
+	if ok && cur.Alarm.Severity == a.Severity {
+		m.mu.Unlock()
+		m.suppressed.Add(1)
+		return nil
+	}
+	if ok {
+		a.CorrelationID = cur.Alarm.CorrelationID
+	} else {
+		a.CorrelationID = generate.String(correlationIDSize)
+	}
+	rec, err := push.NewAlarm(neUID, a)
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.active[key] = &Active{NeUID: neUID, Alarm: a}
+	m.nes[neUID] = struct{}{}
+	m.mu.Unlock()
+	m.markDirty()
+
+	m.raised.Add(1)
+	return m.send(rec)
+}
+
+// Clear clears the alarm of type alarmID on object of neUID and sends a
+// "cleared" alarm record with the correlation ID of the raise. Clearing
+// an alarm that is not active is suppressed.
+func (m *Manager) Clear(neUID, alarmID, object string) error {
+	key := Key{NeUID: neUID, Type: alarmID, Object: object}
+
+	m.mu.Lock()
+	cur, ok := m.active[key]
+	if !ok {
+		m.mu.Unlock()
+		m.suppressed.Add(1)
+		return nil
+	}
+	delete(m.active, key)
+	m.mu.Unlock()
+	m.markDirty()
+
+	a := cur.Alarm
+	a.Severity = schema.SeverityCleared
+	a.EventTime = time.Now().UnixMilli()
+	rec, err := push.NewAlarm(neUID, a)
+	if err != nil {
+		return err
+	}
+	m.cleared.Add(1)
+	return m.send(rec)
+}
+
+// Active returns the active alarms, ordered by NE, type, and object.
+func (m *Manager) Active() []Active {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot()
+}
+
+// Sync sends an "alarm_sync" record with the active alarms of every NE
+// that has had an alarm, including NEs whose alarms are all cleared.
+func (m *Manager) Sync() error {
+	m.mu.Lock()
+	byNE := make(map[string][]schema.Alarm, len(m.nes))
+	for ne := range m.nes {
+		byNE[ne] = []schema.Alarm{}
+	}
+	for _, a := range m.snapshot() {
+		byNE[a.NeUID] = append(byNE[a.NeUID], a.Alarm)
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, ne := range sortedKeys(byNE) {
+		rec, err := push.NewRecord(schema.TypeAlarmSync, ne, schema.AlarmSync{Alarms: byNE[ne]})
+		if err == nil {
+			err = m.send(rec)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sync %s: %w", ne, err))
+			continue
+		}
+		m.syncs.Add(1)
+	}
+	return errors.Join(errs...)
+}
+
+// Stats returns the Manager counters.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	n := len(m.active)
+	m.mu.Unlock()
+	return Stats{
+		Active:     n,
+		Raised:     m.raised.Load(),
+		Suppressed: m.suppressed.Load(),
+		Cleared:    m.cleared.Load(),
+		Syncs:      m.syncs.Load(),
+		SendErrors: m.sendErrors.Load(),
+		SaveErrors: m.saveErrors.Load(),
+	}
+}
+
+// send queues rec with high priority. Failed deliveries are counted,
+// except those retained by the outbox, which are reported again on replay.
+func (m *Manager) send(rec *push.Record) error {
+	var params push.SendParams
+	if m.params != nil {
+		params = *m.params
+	}
+	onResult := params.OnResult
+	params.Priority = client.PriorityHigh
+	params.OnResult = func(res client.Result) {
+		if res.Err != nil && !res.Retained {
+			m.sendErrors.Add(1)
+		}
+		if onResult != nil {
+			onResult(res)
+		}
+	}
+	if err := m.push.SendAsync(rec, &params); err != nil {
+		m.sendErrors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// snapshot returns the active alarms in key order. Callers hold m.mu.
+func (m *Manager) snapshot() []Active {
+	out := make([]Active, 0, len(m.active))
+	for _, a := range m.active {
+		out = append(out, *a)
+	}
+	slices.SortFunc(out, func(a, b Active) int {
+		ka, kb := a.Key(), b.Key()
+		return cmp.Or(
+			cmp.Compare(ka.NeUID, kb.NeUID),
+			cmp.Compare(ka.Type, kb.Type),
+			cmp.Compare(ka.Object, kb.Object),
+		)
+	})
+	return out
+}
+
+// Flush saves the current state to the store. Without WithStore it does
+// nothing. Failures are also counted in Stats.SaveErrors.
+func (m *Manager) Flush() error {
+	if m.store == nil {
+		return nil
+	}
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+
+	m.mu.Lock()
+	st := State{Active: m.snapshot(), NEs: sortedKeys(m.nes)}
+	m.mu.Unlock()
+	if err := m.store.Save(st); err != nil {
+		m.saveErrors.Add(1)
+		return fmt.Errorf("save alarm state: %w", err)
+	}
+	return nil
+}
+
+// markDirty tells the writer that the state changed. It never blocks: a
+// pending signal already covers this change.
+func (m *Manager) markDirty() {
+	if m.dirty == nil {
+		return
+	}
+	select {
+	case m.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop saves the state after changes until Close.
+func (m *Manager) writeLoop() {
+	defer m.writerWg.Done()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-m.dirty:
+			_ = m.Flush()
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
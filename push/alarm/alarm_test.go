@@ -0,0 +1,260 @@
+package alarm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push"
+	"github.com/tsmask/go-oam/push/client"
+	"github.com/tsmask/go-oam/push/schema"
+)
+
+// sink collects the records sent to it.
+type sink struct {
+	mu   sync.Mutex
+	recs []push.Record
+	srv  *httptest.Server
+}
+
+func newSink(t *testing.T) (*sink, *push.Push) {
+	t.Helper()
+	s := &sink{}
+	s.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec push.Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.recs = append(s.recs, rec)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(s.srv.Close)
+	p := push.New(push.WithBaseURL(s.srv.URL), push.WithPushURI("/"), push.WithRetry(0), push.WithSchemas(schema.Builtin()))
+	t.Cleanup(p.Close)
+	return s, p
+}
+
+func (s *sink) take() []push.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.recs
+	s.recs = nil
+	return out
+}
+
+// wait takes the received records once at least n have arrived.
+func (s *sink) wait(t *testing.T, n int) []push.Record {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		got := len(s.recs)
+		s.mu.Unlock()
+		if got >= n {
+			return s.take()
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d records, want %d", got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// byState indexes alarm records by object and severity, since async
+// delivery does not preserve order.
+func byState(t *testing.T, recs []push.Record) map[string]schema.Alarm {
+	t.Helper()
+	out := make(map[string]schema.Alarm, len(recs))
+	for _, rec := range recs {
+		a := alarmOf(t, rec)
+		out[a.Object+"/"+string(a.Severity)] = a
+	}
+	return out
+}
+
+func alarmOf(t *testing.T, rec push.Record) schema.Alarm {
+	t.Helper()
+	var a schema.Alarm
+	if err := json.Unmarshal(rec.RecordData, &a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestManager_RaiseSuppressClear(t *testing.T) {
+	s, p := newSink(t)
+	results := make(chan client.Result, 8)
+	m, err := New(p, WithSendParams(&push.SendParams{OnResult: func(r client.Result) { results <- r }}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	linkDown := schema.Alarm{AlarmID: "link-down", Object: "eth0", Severity: schema.SeverityMajor}
+	for range 3 {
+		if err := m.Raise("ne-1", linkDown); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Same type on another object is a separate alarm
+	other := linkDown
+	other.Object = "eth1"
+	if err := m.Raise("ne-1", other); err != nil {
+		t.Fatal(err)
+	}
+	escalated := linkDown
+	escalated.Severity = schema.SeverityCritical
+	if err := m.Raise("ne-1", escalated); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Clear("ne-1", "link-down", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Clear("ne-1", "link-down", "eth0"); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := byState(t, s.wait(t, 4))
+	if len(recs) != 4 {
+		t.Fatalf("records = %+v, want 4 distinct", recs)
+	}
+	raise, eth1 := recs["eth0/"+string(schema.SeverityMajor)], recs["eth1/"+string(schema.SeverityMajor)]
+	esc, clear := recs["eth0/"+string(schema.SeverityCritical)], recs["eth0/"+string(schema.SeverityCleared)]
+	if raise.CorrelationID == "" || raise.CorrelationID == eth1.CorrelationID {
+		t.Fatalf("correlation IDs %q, %q, want distinct", raise.CorrelationID, eth1.CorrelationID)
+	}
+	if esc.Severity != schema.SeverityCritical || esc.CorrelationID != raise.CorrelationID {
+		t.Fatalf("escalation = %+v, want critical with correlation %q", esc, raise.CorrelationID)
+	}
+	if clear.Severity != schema.SeverityCleared || clear.CorrelationID != raise.CorrelationID || clear.Object != "eth0" {
+		t.Fatalf("clear = %+v", clear)
+	}
+
+	st := m.Stats()
+	if st.Active != 1 || st.Raised != 3 || st.Suppressed != 3 || st.Cleared != 1 || st.SendErrors != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+	for range 4 {
+		if r := <-results; r.Err != nil {
+			t.Fatalf("result = %+v", r)
+		}
+	}
+
+	// Invalid alarms are rejected and not tracked
+	if err := m.Raise("ne-1", schema.Alarm{AlarmID: "x", Severity: "loud"}); err == nil {
+		t.Fatal("invalid alarm raised")
+	}
+	if got := m.Active(); len(got) != 1 || got[0].Alarm.Object != "eth1" {
+		t.Fatalf("active = %+v", got)
+	}
+}
+
+func TestManager_SyncAndRestart(t *testing.T) {
+	s, p := newSink(t)
+	store := NewFileStore(filepath.Join(t.TempDir(), "state", "alarms.json"))
+
+	m, err := New(p, WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Raise("ne-1", schema.Alarm{AlarmID: "cpu-high", Severity: schema.SeverityMinor})
+	m.Raise("ne-2", schema.Alarm{AlarmID: "fan-fail", Object: "fan1", Severity: schema.SeverityMajor})
+	m.Clear("ne-2", "fan-fail", "fan1")
+	m.Close()
+	first := byState(t, s.wait(t, 3))["/"+string(schema.SeverityMinor)]
+
+	// A restarted manager keeps the active alarms and syncs them periodically
+	m, err = New(p, WithStore(store), WithSyncInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if err := m.Raise("ne-1", schema.Alarm{AlarmID: "cpu-high", Severity: schema.SeverityMinor}); err != nil {
+		t.Fatal(err)
+	}
+	if st := m.Stats(); st.Suppressed != 1 || st.Active != 1 {
+		t.Fatalf("stats after restart = %+v", st)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for m.Stats().Syncs < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	m.Close()
+	snaps := map[string]schema.AlarmSync{}
+	for _, rec := range s.wait(t, 2) {
+		if rec.RecordType != schema.TypeAlarmSync {
+			t.Fatalf("unexpected %s record", rec.RecordType)
+		}
+		var snap schema.AlarmSync
+		if err := json.Unmarshal(rec.RecordData, &snap); err != nil {
+			t.Fatal(err)
+		}
+		snaps[rec.NeUID] = snap
+	}
+	if got := snaps["ne-1"].Alarms; len(got) != 1 || got[0].CorrelationID != first.CorrelationID {
+		t.Fatalf("ne-1 snapshot = %+v, want cpu-high with correlation %q", got, first.CorrelationID)
+	}
+	if got, ok := snaps["ne-2"]; !ok || len(got.Alarms) != 0 {
+		t.Fatalf("ne-2 snapshot = %+v, %v, want empty", got, ok)
+	}
+}
+
+// slowStore is a Store whose Save blocks until released.
+type slowStore struct {
+	mu      sync.Mutex
+	saves   []State
+	release chan struct{}
+}
+
+func (s *slowStore) Load() (State, error) { return State{}, nil }
+
+func (s *slowStore) Save(st State) error {
+	<-s.release
+	s.mu.Lock()
+	s.saves = append(s.saves, st)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestManager_SavesOutsideLock(t *testing.T) {
+	_, p := newSink(t)
+	store := &slowStore{release: make(chan struct{})}
+	m, err := New(p, WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first save blocks; raises and clears must not wait for it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 50 {
+			_ = m.Raise("ne-1", schema.Alarm{AlarmID: "cpu-high", Object: strconv.Itoa(i), Severity: schema.SeverityMinor})
+		}
+		_ = m.Clear("ne-1", "cpu-high", "0")
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Raise blocked on a running save")
+	}
+	close(store.release)
+	m.Close()
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if n := len(store.saves); n == 0 || n > 3 {
+		t.Fatalf("%d saves, want the changes coalesced", n)
+	}
+	if last := store.saves[len(store.saves)-1]; len(last.Active) != 49 {
+		t.Fatalf("last save has %d active alarms, want 49", len(last.Active))
+	}
+}
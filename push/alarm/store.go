@@ -0,0 +1,94 @@
+package alarm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// State is the persisted state of a Manager.
+type State struct {
+	Active []Active `json:"active"` // Active alarms
+	NEs    []string `json:"nes"`    // NEs that have had an alarm, synced even when none is active
+}
+
+// Store persists the state of a Manager across restarts.
+//
+// Save is called with the complete state from a background writer after
+// changes, coalescing changes made while a save runs, and by Flush and
+// Close. Calls never overlap. Load is called once by New.
+type Store interface {
+	Load() (State, error)
+	Save(st State) error
+}
+
+// FileStore is a Store that keeps the state in a JSON file. The file is
+// replaced atomically on every Save, so a crash leaves either the old or
+// the new state.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewFileStore returns a FileStore backed by path. The directory is
+// created on the first Save.
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+// Load implements Store. A missing file means no active alarms.
+func (s *FileStore) Load() (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var st State
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return st, fmt.Errorf("decode %s: %w", s.path, err)
+	}
+	return st, nil
+}
+
+// Save implements Store.
+func (s *FileStore) Save(st State) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "http://nms/api/push/receive?site=1", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestBearer(t *testing.T) {
+	req := newRequest(t, "")
+	if err := Bearer("abc").Authenticate(req, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "Bearer abc" {
+		t.Fatalf("Authorization = %q", got)
+	}
+}
+
+func TestHMAC_SignVerify(t *testing.T) {
+	body := []byte(`{"ne_uid":"ne-001"}`)
+	req := newRequest(t, string(body))
+	if err := NewHMAC("k1", "secret").Authenticate(req, body); err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get(HeaderKeyID) != "k1" || len(req.Header.Get(HeaderNonce)) != nonceSize {
+		t.Fatalf("headers = %v", req.Header)
+	}
+	if err := VerifyHMAC(req, body, "secret", 0); err != nil {
+		t.Fatalf("VerifyHMAC: %v", err)
+	}
+
+	if err := VerifyHMAC(req, []byte(`{"ne_uid":"ne-002"}`), "secret", 0); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("tampered body: err = %v", err)
+	}
+	if err := VerifyHMAC(req, body, "other", 0); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("wrong secret: err = %v", err)
+	}
+	if err := VerifyHMAC(newRequest(t, ""), nil, "secret", 0); !errors.Is(err, ErrSignatureMissing) {
+		t.Fatalf("unsigned: err = %v", err)
+	}
+}
+
+func TestHMAC_RejectsStaleTimestamp(t *testing.T) {
+	h := NewHMAC("", "secret")
+	h.now = func() time.Time { return time.Now().Add(-10 * time.Minute) }
+	req := newRequest(t, "x")
+	_ = h.Authenticate(req, []byte("x"))
+	if err := VerifyHMAC(req, []byte("x"), "secret", time.Minute); !errors.Is(err, ErrSignatureExpired) {
+		t.Fatalf("err = %v, want ErrSignatureExpired", err)
+	}
+}
+
+// newTokenServer is a stand-in OAuth2 token endpoint issuing tok-1, tok-2, ...
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *atomic.Int32) {
+	var issued atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "agent" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		if r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "push metrics" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_request"})
+			return
+		}
+		n := issued.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "tok-" + strconv.Itoa(int(n)),
+			"token_type":   "bearer",
+			"expires_in":   expiresIn,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &issued
+}
+
+func TestClientCredentials_CachesAndRefreshes(t *testing.T) {
+	srv, issued := newTokenServer(t, 3600)
+	cc := NewClientCredentials(ClientCredentialsConfig{
+		TokenURL: srv.URL, ClientID: "agent", ClientSecret: "s3cr3t",
+		Scopes: []string{"push", "metrics"},
+	})
+	now := time.Now()
+	cc.now = func() time.Time { return now }
+
+	for range 3 {
+		req := newRequest(t, "")
+		if err := cc.Authenticate(req, nil); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer tok-1" {
+			t.Fatalf("Authorization = %q", got)
+		}
+	}
+	if issued.Load() != 1 {
+		t.Fatalf("token fetched %d times, want 1", issued.Load())
+	}
+
+	// Within the expiry skew the token is refreshed.
+	now = now.Add(3600*time.Second - 10*time.Second)
+	if tok, _, _ := cc.Token(t.Context()); tok != "tok-2" {
+		t.Fatalf("token after expiry = %q, want tok-2", tok)
+	}
+
+	cc.Invalidate()
+	if tok, _, _ := cc.Token(t.Context()); tok != "tok-3" {
+		t.Fatalf("token after Invalidate = %q, want tok-3", tok)
+	}
+}
+
+func TestClientCredentials_ShortLivedTokenIsCached(t *testing.T) {
+	// expires_in below the default 30s skew: the token must still be reused.
+	srv, issued := newTokenServer(t, 20)
+	cc := NewClientCredentials(ClientCredentialsConfig{
+		TokenURL: srv.URL, ClientID: "agent", ClientSecret: "s3cr3t",
+		Scopes: []string{"push", "metrics"},
+	})
+	now := time.Now()
+	cc.now = func() time.Time { return now }
+
+	for range 3 {
+		if tok, _, err := cc.Token(t.Context()); err != nil || tok != "tok-1" {
+			t.Fatalf("token = %q, err = %v", tok, err)
+		}
+	}
+	now = now.Add(10 * time.Second)
+	if tok, _, _ := cc.Token(t.Context()); tok != "tok-2" || issued.Load() != 2 {
+		t.Fatalf("token at half lifetime = %q, want tok-2", tok)
+	}
+}
+
+func TestClientCredentials_BadSecret(t *testing.T) {
+	srv, _ := newTokenServer(t, 60)
+	cc := NewClientCredentials(ClientCredentialsConfig{TokenURL: srv.URL, ClientID: "agent", ClientSecret: "wrong"})
+	if _, _, err := cc.Token(t.Context()); err == nil {
+		t.Fatal("expected error for rejected client credentials")
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTokenTimeout = 30 * time.Second
+	defaultExpirySkew   = 30 * time.Second
+	maxTokenBodyBytes   = 1 << 20
+)
+
+// ClientCredentialsConfig configures the OAuth2 client-credentials grant (RFC 6749 4.4).
+type ClientCredentialsConfig struct {
+	TokenURL     string        // Token endpoint
+	ClientID     string        // Client identifier
+	ClientSecret string        // Client secret, sent with HTTP Basic auth
+	Scopes       []string      // Optional requested scopes
+	HTTPClient   *http.Client  // Client for token requests; nil uses a client with a 30s timeout
+	ExpirySkew   time.Duration // Refresh this long before expiry, at most half the token lifetime; default 30s
+}
+
+// ClientCredentials is an Authenticator that fetches, caches, and refreshes
+// OAuth2 access tokens.
+//
+// Tokens are fetched on first use and refreshed ExpirySkew before they
+// expire. Concurrent requests share a single token fetch. Thread-safe.
+type ClientCredentials struct {
+	cfg ClientCredentialsConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	token   string
+	tokType string
+	expiry  time.Time // Zero when the token does not expire
+}
+
+// tokenResponse is the token endpoint response (RFC 6749 5.1).
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Error       string `json:"error"`
+	ErrorDesc   string `json:"error_description"`
+}
+
+// NewClientCredentials creates a client-credentials authenticator.
+func NewClientCredentials(cfg ClientCredentialsConfig) *ClientCredentials {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: defaultTokenTimeout}
+	}
+	if cfg.ExpirySkew <= 0 {
+		cfg.ExpirySkew = defaultExpirySkew
+	}
+	return &ClientCredentials{cfg: cfg, now: time.Now}
+}
+
+// Authenticate implements Authenticator.
+func (c *ClientCredentials) Authenticate(req *http.Request, _ []byte) error {
+	token, tokType, err := c.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", tokType+" "+token)
+	return nil
+}
+
+// Invalidate implements Invalidator, forcing a fetch on next use.
+func (c *ClientCredentials) Invalidate() {
+	c.mu.Lock()
+	c.token = ""
+	c.mu.Unlock()
+}
+
+// Token returns a valid access token and its type, fetching one if needed.
+func (c *ClientCredentials) Token(ctx context.Context) (token, tokenType string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token != "" && (c.expiry.IsZero() || c.now().Before(c.expiry)) {
+		return c.token, c.tokType, nil
+	}
+
+	resp, err := c.fetch(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	c.token = resp.AccessToken
+	c.tokType = "Bearer"
+	if resp.TokenType != "" && !strings.EqualFold(resp.TokenType, "bearer") {
+		c.tokType = resp.TokenType
+	}
+	c.expiry = time.Time{}
+	if resp.ExpiresIn > 0 {
+		// Cap the skew at half the lifetime so short-lived tokens are not
+		// considered expired as soon as they are fetched.
+		lifetime := time.Duration(resp.ExpiresIn) * time.Second
+		c.expiry = c.now().Add(lifetime - min(c.cfg.ExpirySkew, lifetime/2))
+	}
+	return c.token, c.tokType, nil
+}
+
+func (c *ClientCredentials) fetch(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.cfg.Scopes, " "))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.cfg.ClientID), url.QueryEscape(c.cfg.ClientSecret))
+
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTokenBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: read token response: %w", err)
+	}
+	var tr tokenResponse
+	_ = json.Unmarshal(data, &tr)
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		if tr.Error != "" {
+			return nil, fmt.Errorf("oauth2: token endpoint: http %d: %s %s", resp.StatusCode, tr.Error, tr.ErrorDesc)
+		}
+		return nil, fmt.Errorf("oauth2: token endpoint: http %d", resp.StatusCode)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("oauth2: token endpoint returned no access_token")
+	}
+	return &tr, nil
+}
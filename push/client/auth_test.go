@@ -0,0 +1,145 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push/auth"
+)
+
+func TestAuth_RefreshesTokenOn401(t *testing.T) {
+	var issued atomic.Int32
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := issued.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": map[int32]string{1: "revoked", 2: "fresh"}[n], "expires_in": 3600})
+	}))
+	defer tokenSrv.Close()
+
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	cc := auth.NewClientCredentials(auth.ClientCredentialsConfig{TokenURL: tokenSrv.URL, ClientID: "a", ClientSecret: "b"})
+	cli := New(WithAuth(cc))
+	defer cli.Close()
+
+	if err := cli.Push(srv.URL, map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(seen, ",") != "Bearer revoked,Bearer fresh" {
+		t.Fatalf("Authorization headers = %q", seen)
+	}
+}
+
+func TestAuth_HMACWithCompression(t *testing.T) {
+	var verifyErr atomic.Value
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := auth.VerifyHMAC(r, body, "secret", time.Minute); err != nil {
+			verifyErr.Store(err)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	cli := New(WithAuth(auth.NewHMAC("k1", "secret")), WithCompression(CompressGzip, 16))
+	defer cli.Close()
+
+	if err := cli.Push(srv.URL+"/api/push/receive", map[string]string{"data": strings.Repeat("x", 64)}); err != nil {
+		t.Fatalf("push: %v (receiver: %v)", err, verifyErr.Load())
+	}
+}
+
+func TestAuth_MutualTLS(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	clientCert := newTestLeaf(t, ca, caKey, x509.ExtKeyUsageClientAuth)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "ne-001" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	cli := New(WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{clientCert}, RootCAs: roots}))
+	defer cli.Close()
+	if err := cli.Push(srv.URL, map[string]int{"n": 1}); err != nil {
+		t.Fatalf("mTLS push: %v", err)
+	}
+
+	// Without a client certificate the handshake is rejected.
+	plain := New(WithTLSConfig(&tls.Config{RootCAs: roots}))
+	defer plain.Close()
+	if err := plain.Push(srv.URL, map[string]int{"n": 1}); err == nil {
+		t.Fatal("push without client certificate succeeded")
+	}
+}
+
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func newTestLeaf(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "ne-001"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
@@ -0,0 +1,462 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchRecords = 100
+	defaultBatchBytes   = 1 << 20
+	defaultBatchLinger  = 100 * time.Millisecond
+	defaultBatchRetries = 3
+)
+
+// BatchFormat selects the request body layout of a batch.
+type BatchFormat int
+
+const (
+	// BatchJSONArray sends records as a JSON array (Content-Type: application/json).
+	BatchJSONArray BatchFormat = iota
+	// BatchNDJSON sends one JSON record per line (Content-Type: application/x-ndjson).
+	BatchNDJSON
+)
+
+// BatchConfig configures batched async delivery.
+//
+// A batch for a URL is sent when it reaches MaxRecords records, MaxBytes
+// encoded bytes, or Linger after its first record, whichever comes first.
+// Zero fields use the defaults.
+type BatchConfig struct {
+	MaxRecords int           // Records per batch, default 100
+	MaxBytes   int           // Encoded body size per batch, default 1 MiB
+	Linger     time.Duration // Max wait after the first record, default 100ms
+	Format     BatchFormat   // Body layout, default BatchJSONArray
+	Retries    int           // Re-submissions of records rejected in a 2xx response, default 3; <0 disables
+}
+
+// BatchResult is the optional response body a receiver returns for a batch.
+//
+// An empty body, or a body without rejections, means every record was
+// accepted. Rejected items refer to records by their zero-based position
+// in the batch. Rejections with code 429 or 5xx are re-submitted in a later
+// batch (up to BatchConfig.Retries times); other codes are final.
+//
+// Example response:
+//
+//	{"accepted": 98, "rejected": [{"index": 3, "code": 503, "msg": "busy"}, {"index": 7, "code": 400, "msg": "bad ne_uid"}]}
+type BatchResult struct {
+	Accepted int              `json:"accepted"`
+	Rejected []BatchRejection `json:"rejected,omitempty"`
+}
+
+// BatchRejection describes a single rejected record in a batch.
+type BatchRejection struct {
+	Index int    `json:"index"`         // Position of the record in the batch
+	Code  int    `json:"code"`          // HTTP-like status code for the record
+	Msg   string `json:"msg,omitempty"` // Human-readable reason
+}
+
+// WithBatch enables batched async delivery.
+//
+// AsyncPush and BatchPush collect records per URL and priority and POST
+// them together;
+// synchronous Push is unaffected. Per-call async timeouts are ignored in
+// batch mode and the client default timeout applies to each batch request.
+func WithBatch(cfg BatchConfig) Option {
+	return func(c *Client) {
+		if cfg.MaxRecords <= 0 {
+			cfg.MaxRecords = defaultBatchRecords
+		}
+		if cfg.MaxBytes <= 0 {
+			cfg.MaxBytes = defaultBatchBytes
+		}
+		if cfg.Linger <= 0 {
+			cfg.Linger = defaultBatchLinger
+		}
+		if cfg.Retries == 0 {
+			cfg.Retries = defaultBatchRetries
+		} else if cfg.Retries < 0 {
+			cfg.Retries = 0
+		}
+		c.batch = &cfg
+	}
+}
+
+// batchItem is one encoded record waiting in or travelling with a batch.
+type batchItem struct {
+	body     []byte
+	seq      uint64 // Outbox sequence number, 0 when not durable
+	attempts int    // Times the record was rejected with a retryable code
+	sent     int    // HTTP requests that carried the record
+	reserved int64  // Memory budget bytes held by the record
+	priority Priority
+
+	payload  any // Original payload for results, nil for replayed records
+	queued   time.Time
+	onResult func(Result)
+	failover func(Result) bool
+}
+
+// batchKey identifies a batcher. Records of different priorities are never
+// batched together, so each batch is queued in the lane of its records.
+type batchKey struct {
+	url      string
+	priority Priority
+}
+
+// batcher accumulates records for a single URL and priority.
+type batcher struct {
+	items []batchItem
+	bytes int
+	timer *time.Timer
+}
+
+// batchState holds the per-URL batchers. Flushes hand batches to the async
+// queue without blocking; a batch whose lane is full is handed to
+// overflowBatch after the lock is released.
+type batchState struct {
+	mu       sync.Mutex
+	batchers map[batchKey]*batcher
+	closed   bool
+
+	// overflowing counts batches being handled by overflowBatch. Close
+	// waits for them before closing the lanes they may still be sent to.
+	overflowing sync.WaitGroup
+}
+
+// addBatch queues an encoded record for url and flushes if a threshold is
+// hit. ctx bounds the wait for lane room under OverflowBlock; inWorker
+// means the caller is a worker, which never waits for room since it may be
+// the one to make it.
+func (c *Client) addBatch(ctx context.Context, url string, it batchItem, inWorker bool) {
+	var overflow [][]batchItem
+
+	c.batches.mu.Lock()
+	if c.batches.closed {
+		c.batches.mu.Unlock()
+		c.deliverBatch(url, []batchItem{it})
+		return
+	}
+	if c.batches.batchers == nil {
+		c.batches.batchers = make(map[batchKey]*batcher)
+	}
+	key := batchKey{url: url, priority: it.priority.clamp()}
+	b := c.batches.batchers[key]
+	if b == nil {
+		b = &batcher{}
+		c.batches.batchers[key] = b
+	}
+	// A record that would overflow MaxBytes starts a new batch.
+	if len(b.items) > 0 && b.bytes+len(it.body)+1 > c.batch.MaxBytes {
+		if items := c.enqueueBatchLocked(url, b.takeLocked()); items != nil {
+			overflow = append(overflow, items)
+		}
+	}
+	b.items = append(b.items, it)
+	b.bytes += len(it.body) + 1
+	if len(b.items) >= c.batch.MaxRecords || b.bytes >= c.batch.MaxBytes {
+		if items := c.enqueueBatchLocked(url, b.takeLocked()); items != nil {
+			overflow = append(overflow, items)
+		}
+	} else if len(b.items) == 1 {
+		b.timer = time.AfterFunc(c.batch.Linger, func() { c.flushBatch(key) })
+	}
+	c.batches.overflowing.Add(len(overflow))
+	c.batches.mu.Unlock()
+
+	for _, items := range overflow {
+		c.overflowBatch(ctx, url, items, inWorker)
+	}
+}
+
+// flushBatch sends whatever is pending for key (linger timer expiry).
+func (c *Client) flushBatch(key batchKey) {
+	c.batches.mu.Lock()
+	var overflow []batchItem
+	if b := c.batches.batchers[key]; b != nil && !c.batches.closed {
+		overflow = c.enqueueBatchLocked(key.url, b.takeLocked())
+	}
+	if overflow != nil {
+		c.batches.overflowing.Add(1)
+	}
+	c.batches.mu.Unlock()
+
+	if overflow != nil {
+		c.overflowBatch(context.Background(), key.url, overflow, false)
+	}
+}
+
+// overflowBatch applies the overflow policy to a flushed batch whose lane
+// is full, as enqueue does for a single job. The records keep the budget
+// reserved when they were added until each one is settled.
+//
+// OverflowSync, and OverflowBlock in a worker, deliver the batch in the
+// calling goroutine. OverflowBlock otherwise waits for room until ctx is
+// done; once the client is closing the batch is delivered instead.
+// OverflowDropOldest evicts queued jobs of the lane. Records that still
+// find no room are settled with the error; under OverflowSpill
+// non-durable ones are appended to the outbox instead.
+func (c *Client) overflowBatch(ctx context.Context, url string, items []batchItem, inWorker bool) {
+	defer c.batches.overflowing.Done()
+
+	lane := items[0].priority.lane()
+	var err error = ErrQueueFull
+	switch {
+	case c.overflow == OverflowSync, c.overflow == OverflowBlock && inWorker:
+		c.deliverBatch(url, items)
+		return
+	case c.overflow == OverflowBlock:
+		job := c.newBatchJob(url, items)
+		select {
+		case c.lanes[lane] <- job:
+			return
+		case <-c.done:
+			releaseJob(job)
+			c.deliverBatch(url, items)
+			return
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		releaseJob(job)
+	case c.overflow == OverflowDropOldest:
+		job := c.newBatchJob(url, items)
+		for c.dropOldest(lane) {
+			select {
+			case c.lanes[lane] <- job:
+				return
+			default:
+			}
+		}
+		releaseJob(job)
+	}
+
+	c.laneStats[lane].overflowed.Add(int64(len(items)))
+	for _, it := range items {
+		c.rejectBatchItem(url, it, err)
+	}
+}
+
+// rejectBatchItem settles a record of a batch that could not be queued.
+// Durable records stay in the outbox. Under OverflowSpill a non-durable
+// record is appended to the outbox and reported as Retained, like a
+// spilled single record; otherwise it fails for good.
+func (c *Client) rejectBatchItem(url string, it batchItem, err error) {
+	c.budget.release(it.reserved)
+	res := Result{
+		URL:      url,
+		Payload:  it.payload,
+		Body:     it.body,
+		Seq:      it.seq,
+		Attempts: it.sent,
+		Latency:  time.Since(it.queued),
+		Err:      err,
+	}
+	if it.seq == 0 && c.overflow == OverflowSpill && c.outbox != nil {
+		seq, appendErr := c.outbox.AppendKey(url, idempotencyKey(it.payload), it.body, c.timeout)
+		if appendErr == nil {
+			c.outbox.Release(seq)
+			res.Seq, res.Retained = seq, true
+			c.report(res, it.onResult)
+			return
+		}
+		res.Err = errors.Join(err, fmt.Errorf("outbox append failed: %w", appendErr))
+	}
+	c.settle(res, it.seq == 0, it.onResult, it.failover)
+}
+
+// closeBatches stops accepting records and delivers all pending batches.
+// Called by Close after c.done is closed, before the async queue is closed.
+func (c *Client) closeBatches() {
+	c.batches.mu.Lock()
+	c.batches.closed = true
+	pending := make(map[batchKey][]batchItem, len(c.batches.batchers))
+	for key, b := range c.batches.batchers {
+		if items := b.takeLocked(); len(items) > 0 {
+			pending[key] = items
+		}
+	}
+	c.batches.mu.Unlock()
+	c.batches.overflowing.Wait()
+
+	for key, items := range pending {
+		job := c.newBatchJob(key.url, items)
+		select {
+		case c.lanes[job.priority.lane()] <- job:
+		default:
+			releaseJob(job)
+			c.deliverBatch(key.url, items)
+		}
+	}
+}
+
+// takeLocked removes and returns the pending items, stopping the linger timer.
+func (b *batcher) takeLocked() []batchItem {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	items := b.items
+	b.items = nil
+	b.bytes = 0
+	return items
+}
+
+// enqueueBatchLocked tries to hand items to the lane of their priority and
+// returns them back when the lane is full.
+func (c *Client) enqueueBatchLocked(url string, items []batchItem) []batchItem {
+	if len(items) == 0 {
+		return nil
+	}
+	job := c.newBatchJob(url, items)
+	select {
+	case c.lanes[job.priority.lane()] <- job:
+		return nil
+	default:
+		releaseJob(job)
+		return items
+	}
+}
+
+func (c *Client) newBatchJob(url string, items []batchItem) *pushJob {
+	job := jobPool.Get().(*pushJob)
+	job.url = url
+	job.batch = items
+	job.timeout = c.timeout
+	job.priority = items[0].priority
+	return job
+}
+
+// encodeBatch builds the request body for items in the configured format.
+func (c *Client) encodeBatch(items []batchItem) (body []byte, contentType string) {
+	size := 2
+	for _, it := range items {
+		size += len(it.body) + 1
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size))
+
+	if c.batch.Format == BatchNDJSON {
+		for _, it := range items {
+			buf.Write(it.body)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), ContentTypeNDJSON
+	}
+
+	buf.WriteByte('[')
+	for i, it := range items {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(it.body)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), ContentTypeJSON
+}
+
+// deliverBatch sends a batch and settles every record in it.
+//
+// Whole-request failures are retried with backoff under the client retry
+// policy (WithRetry/WithRetryPolicy), like single-record pushes.
+// After a 2xx, records listed in BatchResult.Rejected with a retryable code
+// are re-submitted (or released to the outbox); the rest are final.
+func (c *Client) deliverBatch(url string, items []batchItem) {
+	body, contentType := c.encodeBatch(items)
+
+	var status, attempts int
+	var respBody []byte
+	err := c.withRetry(c.timeout, c.retry, func(ctx context.Context) error {
+		attempts++
+		var err error
+		status, respBody, err = c.send(ctx, url, "", contentType, body, true)
+		return err
+	})
+	for i := range items {
+		items[i].sent += attempts
+	}
+	if err != nil {
+		for _, it := range items {
+			c.settleBatchItem(url, it, batchFailed, status, err)
+		}
+		return
+	}
+
+	rejected := parseBatchRejections(respBody, len(items))
+	for i, it := range items {
+		r, ok := rejected[i]
+		switch {
+		case !ok:
+			c.settleBatchItem(url, it, batchAccepted, status, nil)
+		case isRetryableStatus(r.Code):
+			c.settleBatchItem(url, it, batchRetryable, r.Code, r.err())
+		default:
+			c.settleBatchItem(url, it, batchRejected, r.Code, r.err())
+		}
+	}
+}
+
+// batchOutcome is the delivery outcome of one record in a batch.
+type batchOutcome int
+
+const (
+	batchAccepted  batchOutcome = iota // Receiver accepted the record
+	batchFailed                        // Whole request failed after retries
+	batchRetryable                     // Rejected with 429/5xx
+	batchRejected                      // Rejected with a final code
+)
+
+// settleBatchItem records the outcome of one record in a batch. Non-durable
+// records rejected with a retryable code are re-submitted until
+// BatchConfig.Retries is used up; durable ones are retried by outbox replay.
+// A whole-request failure with a final status (e.g. 400) settles every
+// record as final, so durable records are acked instead of replayed.
+func (c *Client) settleBatchItem(url string, it batchItem, outcome batchOutcome, status int, err error) {
+	if outcome == batchRetryable && it.seq == 0 && it.attempts < c.batch.Retries {
+		it.attempts++
+		c.addBatch(context.Background(), url, it, true)
+		return
+	}
+
+	res := Result{
+		URL:      url,
+		Payload:  it.payload,
+		Body:     it.body,
+		Seq:      it.seq,
+		Attempts: it.sent,
+		Latency:  time.Since(it.queued),
+		Status:   status,
+		Err:      err,
+	}
+	c.budget.release(it.reserved)
+	c.settle(res, outcome == batchRejected || (outcome == batchFailed && isFinalStatus(status)), it.onResult, it.failover)
+}
+
+// err returns the rejection as an error carrying its code.
+func (r BatchRejection) err() error {
+	return &httpStatusError{statusCode: r.Code, body: r.Msg}
+}
+
+// parseBatchRejections maps batch positions to rejections. Unparseable
+// bodies and out-of-range indexes are ignored, so the batch counts as accepted.
+func parseBatchRejections(body []byte, n int) map[int]BatchRejection {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 || body[0] != '{' {
+		return nil
+	}
+	var res BatchResult
+	if err := json.Unmarshal(body, &res); err != nil || len(res.Rejected) == 0 {
+		return nil
+	}
+	rejected := make(map[int]BatchRejection, len(res.Rejected))
+	for _, r := range res.Rejected {
+		if r.Index >= 0 && r.Index < n {
+			rejected[r.Index] = r
+		}
+	}
+	return rejected
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push/outbox"
+)
+
+type batchRecord struct {
+	N int `json:"n"`
+}
+
+// newBatchReceiver decodes JSON array or NDJSON batches and answers with the
+// BatchResult returned by respond.
+func newBatchReceiver(t *testing.T, respond func(batch []int) *BatchResult) (*testReceiver, *httptest.Server) {
+	return newTestReceiverFunc(t, func(req *http.Request, body []byte) (int, []byte) {
+		batch, err := decodeBatch(req.Header.Get("Content-Type"), body)
+		if err != nil {
+			return http.StatusBadRequest, nil
+		}
+		if respond != nil {
+			if res := respond(batch); res != nil {
+				data, _ := json.Marshal(res)
+				return http.StatusOK, data
+			}
+		}
+		return http.StatusOK, nil
+	})
+}
+
+func decodeBatch(contentType string, body []byte) ([]int, error) {
+	var recs []batchRecord
+	if contentType == ContentTypeNDJSON {
+		sc := bufio.NewScanner(bytes.NewReader(body))
+		for sc.Scan() {
+			var rec batchRecord
+			if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+				return nil, err
+			}
+			recs = append(recs, rec)
+		}
+	} else if err := json.Unmarshal(body, &recs); err != nil {
+		return nil, err
+	}
+	batch := make([]int, len(recs))
+	for i, rec := range recs {
+		batch[i] = rec.N
+	}
+	return batch, nil
+}
+
+// receivedBatches returns the accepted batches and their content types.
+func receivedBatches(r *testReceiver) ([][]int, []string) {
+	var out [][]int
+	var types []string
+	for _, req := range r.requests() {
+		if req.status >= 300 {
+			continue
+		}
+		ct := req.header.Get("Content-Type")
+		batch, _ := decodeBatch(ct, []byte(req.body))
+		out = append(out, batch)
+		types = append(types, ct)
+	}
+	return out, types
+}
+
+func TestBatch_MaxRecords(t *testing.T) {
+	recv, srv := newBatchReceiver(t, nil)
+	cli := New(WithBatch(BatchConfig{MaxRecords: 3, Linger: time.Hour}))
+	defer cli.Close()
+
+	for i := range 6 {
+		_ = cli.AsyncPush(srv.URL, batchRecord{N: i})
+	}
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 6 })
+
+	batches, types := receivedBatches(recv)
+	if len(batches) != 2 || len(batches[0]) != 3 || len(batches[1]) != 3 {
+		t.Fatalf("batches = %v, want two batches of 3", batches)
+	}
+	if types[0] != ContentTypeJSON {
+		t.Fatalf("content type = %q", types[0])
+	}
+}
+
+func TestBatch_LingerAndNDJSON(t *testing.T) {
+	recv, srv := newBatchReceiver(t, nil)
+	cli := New(WithBatch(BatchConfig{Linger: 30 * time.Millisecond, Format: BatchNDJSON}))
+	defer cli.Close()
+
+	_ = cli.AsyncPush(srv.URL, batchRecord{N: 1})
+	_ = cli.AsyncPush(srv.URL, batchRecord{N: 2})
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 2 })
+
+	batches, types := receivedBatches(recv)
+	if len(batches) != 1 || len(batches[0]) != 2 || types[0] != ContentTypeNDJSON {
+		t.Fatalf("batches = %v types = %v", batches, types)
+	}
+}
+
+func TestBatch_MaxBytes(t *testing.T) {
+	recv, srv := newBatchReceiver(t, nil)
+	// Each record encodes to 8 bytes ({"n":10}); 20 bytes fit two records.
+	cli := New(WithBatch(BatchConfig{MaxBytes: 20, Linger: 30 * time.Millisecond}))
+	defer cli.Close()
+
+	for i := 10; i < 15; i++ {
+		_ = cli.AsyncPush(srv.URL, batchRecord{N: i})
+	}
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 5 })
+
+	batches, _ := receivedBatches(recv)
+	for _, b := range batches {
+		if len(b) > 2 {
+			t.Fatalf("batch %v exceeds MaxBytes", b)
+		}
+	}
+}
+
+func TestBatch_PartialFailureRetriesRejectedOnly(t *testing.T) {
+	var once sync.Once
+	recv, srv := newBatchReceiver(t, func(batch []int) *BatchResult {
+		var res *BatchResult
+		once.Do(func() {
+			// First batch: record 1 is retryable, record 2 is permanently rejected.
+			res = &BatchResult{Accepted: 1, Rejected: []BatchRejection{
+				{Index: 1, Code: http.StatusServiceUnavailable, Msg: "busy"},
+				{Index: 2, Code: http.StatusBadRequest, Msg: "invalid"},
+			}}
+		})
+		return res
+	})
+	cli := New(WithBatch(BatchConfig{MaxRecords: 3, Linger: 20 * time.Millisecond}))
+	defer cli.Close()
+
+	for i := range 3 {
+		_ = cli.AsyncPush(srv.URL, batchRecord{N: i})
+	}
+	waitUntil(t, 2*time.Second, func() bool {
+		st := cli.Stats()
+		return st.TotalProcessed == 2 && st.FailedCount == 1
+	})
+
+	batches, _ := receivedBatches(recv)
+	if len(batches) != 2 || len(batches[1]) != 1 || batches[1][0] != 1 {
+		t.Fatalf("batches = %v, want retry of record 1 only", batches)
+	}
+}
+
+func TestBatch_CloseFlushesPending(t *testing.T) {
+	recv, srv := newBatchReceiver(t, nil)
+	cli := New(WithBatch(BatchConfig{Linger: time.Hour}))
+
+	_ = cli.AsyncPush(srv.URL, batchRecord{N: 7})
+	cli.Close()
+
+	batches, _ := receivedBatches(recv)
+	if len(batches) != 1 || batches[0][0] != 7 {
+		t.Fatalf("batches = %v, want pending record flushed on Close", batches)
+	}
+}
+
+func TestBatch_FinalStatusSettlesDurableRecords(t *testing.T) {
+	recv, srv := newTestReceiver(t, http.StatusBadRequest)
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	cli := New(WithOutbox(ob), WithReplayInterval(20*time.Millisecond),
+		WithBatch(BatchConfig{MaxRecords: 3, Linger: time.Hour}))
+	defer cli.Close()
+
+	for i := range 3 {
+		if err := cli.AsyncPush(srv.URL, batchRecord{N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, 2*time.Second, func() bool {
+		st := cli.Stats()
+		return st.FailedCount == 3 && st.OutboxRecords == 0
+	})
+
+	// A 400 for the whole batch is final: the records are acked, not replayed.
+	time.Sleep(100 * time.Millisecond)
+	if n := len(recv.requests()); n != 1 {
+		t.Fatalf("%d requests, want the batch sent once", n)
+	}
+}
+
+func TestBatch_WholeRequestUsesClientRetries(t *testing.T) {
+	recv, srv := newTestReceiver(t, http.StatusServiceUnavailable)
+	cli := New(WithRetry(1), WithRetryPolicy(&recordingPolicy{}),
+		WithBatch(BatchConfig{MaxRecords: 2, Linger: time.Hour, Retries: 5}))
+	defer cli.Close()
+
+	for i := range 2 {
+		_ = cli.AsyncPush(srv.URL, batchRecord{N: i})
+	}
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().FailedCount == 2 })
+
+	// One retry from WithRetry; BatchConfig.Retries only re-submits records
+	// rejected inside a 2xx response.
+	if n := len(recv.requests()); n != 2 {
+		t.Fatalf("%d requests, want 2", n)
+	}
+}
@@ -0,0 +1,258 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBreakerFailures = 5
+	defaultBreakerOpen     = 30 * time.Second
+	defaultBreakerProbes   = 1
+)
+
+// ErrCircuitOpen is returned without sending a request while the circuit
+// for the destination is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitState is the state of a destination's circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets requests through and counts consecutive failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests until OpenTimeout has elapsed.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through.
+	CircuitHalfOpen
+)
+
+// String returns the state name.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerConfig configures per-destination circuit breakers.
+//
+// A circuit opens after FailureThreshold consecutive failed requests to a
+// destination. Failures are transport errors, timeouts, 429, and 5xx
+// responses; other 4xx responses prove the receiver is up and count as
+// successes. After OpenTimeout the circuit turns half-open and lets
+// HalfOpenProbes requests through: one success closes it, one failure
+// opens it again. Zero fields use the defaults.
+type BreakerConfig struct {
+	FailureThreshold int           // Consecutive failures that open a circuit, default 5
+	OpenTimeout      time.Duration // Time before an open circuit is probed, default 30s
+	HalfOpenProbes   int           // Concurrent probe requests in half-open, default 1
+	PerURL           bool          // Key circuits by full URL instead of host
+
+	// OnStateChange is called after a circuit changes state. It runs in
+	// the goroutine that caused the change and must not block.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// WithCircuitBreaker enables a circuit breaker per destination host.
+//
+// While a circuit is open, requests fail fast with ErrCircuitOpen instead of
+// waiting for timeouts and retries: Push returns it, AsyncPush returns it
+// before queuing, and with WithOutbox records stay on disk and are replayed
+// once the circuit is probed again.
+func WithCircuitBreaker(cfg BreakerConfig) Option {
+	return func(c *Client) {
+		if cfg.FailureThreshold <= 0 {
+			cfg.FailureThreshold = defaultBreakerFailures
+		}
+		if cfg.OpenTimeout <= 0 {
+			cfg.OpenTimeout = defaultBreakerOpen
+		}
+		if cfg.HalfOpenProbes <= 0 {
+			cfg.HalfOpenProbes = defaultBreakerProbes
+		}
+		c.breakers = &breakerSet{cfg: cfg, now: time.Now}
+	}
+}
+
+// breaker is the circuit of a single destination.
+type breaker struct {
+	state    CircuitState
+	failures int       // Consecutive failures while closed
+	openedAt time.Time // When the circuit last opened
+	probes   int       // Probe requests in flight while half-open
+}
+
+// breakerSet holds the circuits of all destinations.
+type breakerSet struct {
+	cfg      BreakerConfig
+	now      func() time.Time
+	rejected atomic.Int64
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// key returns the circuit key of rawURL.
+func (s *breakerSet) key(rawURL string) string {
+	if s.cfg.PerURL {
+		return rawURL
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// allow reports whether a request to key may be sent. A nil error admits
+// the request and must be followed by exactly one call to done or release.
+func (s *breakerSet) allow(key string) error {
+	s.mu.Lock()
+	b := s.breakers[key]
+	if b == nil {
+		s.mu.Unlock()
+		return nil
+	}
+
+	from := b.state
+	switch b.state {
+	case CircuitOpen:
+		if s.now().Sub(b.openedAt) < s.cfg.OpenTimeout {
+			s.mu.Unlock()
+			s.rejected.Add(1)
+			return ErrCircuitOpen
+		}
+		b.state = CircuitHalfOpen
+		b.probes = 1
+	case CircuitHalfOpen:
+		if b.probes >= s.cfg.HalfOpenProbes {
+			s.mu.Unlock()
+			s.rejected.Add(1)
+			return ErrCircuitOpen
+		}
+		b.probes++
+	}
+	to := b.state
+	s.mu.Unlock()
+
+	s.notify(key, from, to)
+	return nil
+}
+
+// ready reports whether a request to key would currently be admitted,
+// without taking a probe slot.
+func (s *breakerSet) ready(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.breakers[key]
+	return b == nil || b.state == CircuitClosed ||
+		(b.state == CircuitOpen && s.now().Sub(b.openedAt) >= s.cfg.OpenTimeout) ||
+		(b.state == CircuitHalfOpen && b.probes < s.cfg.HalfOpenProbes)
+}
+
+// done records the outcome of an admitted request.
+func (s *breakerSet) done(key string, failed bool) {
+	s.mu.Lock()
+	b := s.breakers[key]
+	if b == nil {
+		if !failed {
+			s.mu.Unlock()
+			return
+		}
+		if s.breakers == nil {
+			s.breakers = make(map[string]*breaker)
+		}
+		b = &breaker{}
+		s.breakers[key] = b
+	}
+
+	from := b.state
+	switch b.state {
+	case CircuitClosed:
+		if !failed {
+			b.failures = 0
+		} else if b.failures++; b.failures >= s.cfg.FailureThreshold {
+			b.state = CircuitOpen
+			b.openedAt = s.now()
+		}
+	case CircuitHalfOpen:
+		b.probes--
+		if failed {
+			b.state = CircuitOpen
+			b.openedAt = s.now()
+		} else {
+			b.state = CircuitClosed
+			b.failures = 0
+		}
+	}
+	// Results of requests admitted before the circuit opened are ignored.
+	to := b.state
+	if to == CircuitClosed && b.failures == 0 {
+		delete(s.breakers, key)
+	}
+	s.mu.Unlock()
+
+	s.notify(key, from, to)
+}
+
+// release returns the probe slot of an admitted request whose outcome says
+// nothing about the destination, such as caller cancellation. The circuit
+// state is left unchanged.
+func (s *breakerSet) release(key string) {
+	s.mu.Lock()
+	if b := s.breakers[key]; b != nil && b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+	s.mu.Unlock()
+}
+
+// states returns a snapshot of every circuit that is not closed.
+func (s *breakerSet) states() map[string]CircuitState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var m map[string]CircuitState
+	for key, b := range s.breakers {
+		if b.state == CircuitClosed {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]CircuitState)
+		}
+		m[key] = b.state
+	}
+	return m
+}
+
+func (s *breakerSet) notify(key string, from, to CircuitState) {
+	if from != to && s.cfg.OnStateChange != nil {
+		s.cfg.OnStateChange(key, from, to)
+	}
+}
+
+// isBreakerFailure reports whether err says the destination is unhealthy.
+// Final 4xx responses do not count; caller cancellation is handled by
+// release before this is consulted.
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return isRetryableStatus(statusErr.statusCode)
+	}
+	return true
+}
+
+// circuitReady reports whether requests to rawURL would pass the breaker.
+func (c *Client) circuitReady(rawURL string) bool {
+	return c.breakers == nil || c.breakers.ready(c.breakers.key(rawURL))
+}
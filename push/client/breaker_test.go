@@ -0,0 +1,224 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push/outbox"
+)
+
+type transitionLog struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (l *transitionLog) record(key string, from, to CircuitState) {
+	l.mu.Lock()
+	l.seen = append(l.seen, fmt.Sprintf("%s->%s", from, to))
+	l.mu.Unlock()
+}
+
+func (l *transitionLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.seen...)
+}
+
+func TestBreaker_StateMachine(t *testing.T) {
+	var log transitionLog
+	now := time.Unix(0, 0)
+	s := &breakerSet{
+		cfg: BreakerConfig{
+			FailureThreshold: 3,
+			OpenTimeout:      time.Minute,
+			HalfOpenProbes:   1,
+			OnStateChange:    log.record,
+		},
+		now: func() time.Time { return now },
+	}
+
+	// Successes reset the consecutive failure count
+	for _, failed := range []bool{true, true, false, true, true} {
+		if err := s.allow("nms"); err != nil {
+			t.Fatal(err)
+		}
+		s.done("nms", failed)
+	}
+	if err := s.allow("nms"); err != nil {
+		t.Fatalf("opened before threshold: %v", err)
+	}
+	s.done("nms", true)
+	if err := s.allow("nms"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("allow after threshold = %v, want ErrCircuitOpen", err)
+	}
+	if s.allow("other") != nil {
+		t.Fatal("circuits are not independent")
+	}
+	s.done("other", false)
+
+	// One probe at a time once the open timeout has elapsed
+	now = now.Add(time.Minute)
+	if !s.ready("nms") {
+		t.Fatal("not ready after open timeout")
+	}
+	if err := s.allow("nms"); err != nil {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if err := s.allow("nms"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("second probe = %v, want ErrCircuitOpen", err)
+	}
+	s.done("nms", true)
+	if got := s.states()["nms"]; got != CircuitOpen {
+		t.Fatalf("state after failed probe = %v, want open", got)
+	}
+
+	now = now.Add(time.Minute)
+	if err := s.allow("nms"); err != nil {
+		t.Fatal(err)
+	}
+	s.done("nms", false)
+	if states := s.states(); states != nil {
+		t.Fatalf("states after recovery = %v, want none", states)
+	}
+
+	want := []string{
+		"closed->open", "open->half-open", "half-open->open",
+		"open->half-open", "half-open->closed",
+	}
+	if got := log.get(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("transitions = %v, want %v", got, want)
+	}
+	if n := s.rejected.Load(); n != 2 {
+		t.Fatalf("rejected = %d, want 2", n)
+	}
+}
+
+func TestBreaker_CanceledProbeKeepsState(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	cli := New(WithCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute, HalfOpenProbes: 1}))
+	defer cli.Close()
+	now := time.Unix(0, 0)
+	cli.breakers.now = func() time.Time { return now }
+
+	key := cli.breakers.key(srv.URL)
+	if err := cli.breakers.allow(key); err != nil {
+		t.Fatal(err)
+	}
+	cli.breakers.done(key, true)
+	now = now.Add(time.Minute)
+
+	// The probe is canceled by the caller: no success is recorded and the
+	// probe slot is given back.
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if _, _, err := cli.send(ctx, srv.URL, "", ContentTypeJSON, []byte("{}"), false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if got := cli.breakers.states()[key]; got != CircuitHalfOpen {
+		t.Fatalf("state after canceled probe = %v, want half-open", got)
+	}
+	if _, _, err := cli.send(t.Context(), srv.URL, "", ContentTypeJSON, []byte("{}"), false); err != nil {
+		t.Fatalf("next probe: %v", err)
+	}
+	if states := cli.breakers.states(); states != nil {
+		t.Fatalf("states after successful probe = %v, want none", states)
+	}
+}
+
+func TestBreaker_FailsFastWhileOpen(t *testing.T) {
+	var hits, status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	host := srv.Listener.Addr().String()
+
+	var log transitionLog
+	cli := New(WithWorkers(1), WithCircuitBreaker(BreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		OnStateChange:    log.record,
+	}))
+	defer cli.Close()
+
+	for range 2 {
+		if err := cli.Push(srv.URL, "x"); err == nil {
+			t.Fatal("push to failing receiver succeeded")
+		}
+	}
+	if err := cli.Push(srv.URL, "x"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("push while open = %v, want ErrCircuitOpen", err)
+	}
+	if err := cli.AsyncPush(srv.URL, "x"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("async push while open = %v, want ErrCircuitOpen", err)
+	}
+	if n := hits.Load(); n != 2 {
+		t.Fatalf("receiver hits = %d, want 2", n)
+	}
+	stats := cli.Stats()
+	if stats.Circuits[host] != CircuitOpen || stats.CircuitRejected != 2 {
+		t.Fatalf("stats = %+v, want %s open with 2 rejected", stats, host)
+	}
+
+	// 4xx proves the receiver is up and does not count as a failure
+	status.Store(http.StatusBadRequest)
+	time.Sleep(60 * time.Millisecond)
+	if err := cli.Push(srv.URL, "x"); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("probe = %v, want http 400", err)
+	}
+	if states := cli.Stats().Circuits; len(states) != 0 {
+		t.Fatalf("circuits after probe = %v, want none", states)
+	}
+	want := []string{"closed->open", "open->half-open", "half-open->closed"}
+	if got := log.get(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("transitions = %v, want %v", got, want)
+	}
+}
+
+func TestBreaker_DivertsToOutbox(t *testing.T) {
+	recv, srv := newTestReceiver(t, http.StatusServiceUnavailable)
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+
+	cli := New(
+		WithOutbox(ob),
+		WithWorkers(1),
+		WithReplayInterval(10*time.Millisecond),
+		WithCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: 100 * time.Millisecond}),
+	)
+	defer cli.Close()
+
+	if err := cli.AsyncPush(srv.URL, map[string]int{"n": 0}); err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(srv.URL)
+	waitUntil(t, time.Second, func() bool { return cli.Stats().Circuits[u.Host] == CircuitOpen })
+
+	// Records for an open circuit are kept on disk, not queued
+	for i := 1; i < 4; i++ {
+		if err := cli.AsyncPush(srv.URL, map[string]int{"n": i}); err != nil {
+			t.Fatalf("AsyncPush while open = %v, want nil", err)
+		}
+	}
+	if q := cli.Stats().QueueLength; q != 0 {
+		t.Fatalf("queue length = %d, want 0", q)
+	}
+
+	recv.status.Store(http.StatusOK)
+	waitUntil(t, 2*time.Second, func() bool { return len(recv.received()) == 4 })
+	waitUntil(t, time.Second, func() bool { return ob.Pending() == 0 })
+}
@@ -1,10 +1,13 @@
 // Package client provides HTTP client with async queue and retry for Push SDK.
 //
 // Client features:
-//   - Async queue with worker pool
+//   - Pluggable transport: HTTP by default (see WithTransport)
+//   - Async queue with worker pool and priority lanes (see Priority)
 //   - Exponential backoff with jitter
 //   - Connection pooling and reuse
-//   - Graceful degradation when queue is full
+//   - Overflow policies and memory budget for a full queue (see WithOverflow)
+//   - Optional durable outbox with replay (see WithOutbox)
+//   - Optional per-destination circuit breaker (see WithCircuitBreaker)
 //
 // Usage Example:
 //
@@ -24,26 +27,31 @@
 //
 //	cli.Stats() returns PoolStats with:
 //	  - ActiveWorkers: Current number of active workers
-//	  - QueueLength: Current queue length
+//	  - QueueLength: Current queue length, summed over priority lanes
+//	  - Lanes: Queue length, processed and drop counts per priority
 //	  - TotalProcessed: Total successful requests
 //	  - FailedCount: Total failed requests
+//	  - QueuedBytes / Dropped: Memory budget usage and evicted records
+//	  - OutboxBytes / OutboxRecords: Unacknowledged outbox backlog
+//	  - Circuits: Destinations whose circuit is open or half-open
 package client
 
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"math/rand/v2"
-	"net"
 	"net/http"
 	"runtime"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/tsmask/go-oam/push/auth"
+	"github.com/tsmask/go-oam/push/outbox"
 )
 
 const (
@@ -52,6 +60,15 @@ const (
 	defaultMaxDelay  = 30 * time.Second
 	defaultInitDelay = 100 * time.Millisecond
 	maxErrBodyBytes  = 4096
+	maxRespBodyBytes = 1 << 20
+
+	defaultReplayInterval = 1 * time.Second
+)
+
+// Content types of request bodies.
+const (
+	ContentTypeJSON   = "application/json"     // Single record, or a BatchJSONArray batch
+	ContentTypeNDJSON = "application/x-ndjson" // BatchNDJSON batch
 )
 
 var (
@@ -59,9 +76,37 @@ var (
 	defaultQueueSz = 4096
 )
 
+// ErrQueueFull reports that the async queue or the memory budget is full.
+// Durable records reported with it stay in the outbox for replay.
+var ErrQueueFull = errors.New("async queue full")
+
+// HeaderIdempotencyKey is the request header carrying the key of an
+// Idempotent payload.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// Idempotent is implemented by payloads that carry a stable idempotency key.
+//
+// The key is sent in the Idempotency-Key header on every attempt of a
+// single-record request, including retries and outbox replays, so the
+// receiver can drop repeats. Batch requests carry no header; receivers
+// dedupe batched records by the ID in their body. push.Record implements
+// Idempotent with its ID.
+type Idempotent interface {
+	IdempotencyKey() string
+}
+
+// idempotencyKey returns the key of payload, or "" when it has none.
+func idempotencyKey(payload any) string {
+	if p, ok := payload.(Idempotent); ok {
+		return p.IdempotencyKey()
+	}
+	return ""
+}
+
 type httpStatusError struct {
 	statusCode int
 	body       string
+	retryAfter time.Duration // Parsed Retry-After header, 0 when absent
 }
 
 func (e *httpStatusError) Error() string {
@@ -79,13 +124,55 @@ type PoolStats struct {
 	QueueLength    int   // Current number of jobs waiting in queue
 	TotalProcessed int64 // Total number of successfully processed requests
 	FailedCount    int64 // Total number of failed requests
+	OutboxBytes    int64 // Unacknowledged outbox bytes (0 without an outbox)
+	OutboxRecords  int64 // Unacknowledged outbox records (0 without an outbox)
+	QueuedBytes    int64 // Payload bytes held against the memory budget (0 without a budget)
+	Dropped        int64 // Queued records evicted by OverflowDropOldest
+
+	Lanes map[Priority]LaneStats // Per-priority queue statistics
+
+	UncompressedBytes int64 // Body bytes before compression, for requests sent compressed
+	CompressedBytes   int64 // Body bytes on the wire, for requests sent compressed
+
+	DeadLettered  int64 // Async records handed to the dead-letter sink
+	Retries       int64 // Retry attempts made after failed requests
+	RetriesDenied int64 // Retries skipped because the retry budget was exhausted
+
+	Circuits        map[string]CircuitState // Destinations whose circuit is not closed, nil without a breaker
+	CircuitRejected int64                   // Requests rejected because a circuit was open
 }
 
 type pushJob struct {
-	url     string
-	payload any
-	timeout time.Duration
-	next    *pushJob
+	url      string
+	payload  any
+	body     []byte      // Pre-encoded JSON body, used instead of payload when set
+	key      string      // Idempotency key of body
+	seq      uint64      // Outbox sequence number, 0 when not durable
+	batch    []batchItem // Records of a batch job, nil for single-record jobs
+	reserved int64       // Memory budget bytes held by the job
+	priority Priority
+	timeout  time.Duration
+	retry    int
+	queued   time.Time
+	onResult func(Result)
+	failover func(Result) bool
+	next     *pushJob
+}
+
+func releaseJob(job *pushJob) {
+	job.next = nil
+	job.payload = nil
+	job.body = nil
+	job.key = ""
+	job.seq = 0
+	job.batch = nil
+	job.reserved = 0
+	job.priority = PriorityNormal
+	job.url = ""
+	job.retry = 0
+	job.onResult = nil
+	job.failover = nil
+	jobPool.Put(job)
 }
 
 var jobPool = sync.Pool{
@@ -96,18 +183,25 @@ var jobPool = sync.Pool{
 
 var httpClientPool = sync.Pool{
 	New: func() any {
-		return &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:        100,
-				MaxIdleConnsPerHost: 10,
-				IdleConnTimeout:     90 * time.Second,
-				MaxConnsPerHost:     100,
-			},
-			Timeout: defaultTimeout,
-		}
+		return newHTTPClient(nil)
 	},
 }
 
+// newHTTPClient creates an http.Client with the shared transport settings.
+// Clients with a TLS configuration are never returned to httpClientPool.
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			MaxIdleConns:        100,
+			MaxIdleConnsPerHost: 10,
+			IdleConnTimeout:     90 * time.Second,
+			MaxConnsPerHost:     100,
+		},
+		Timeout: defaultTimeout,
+	}
+}
+
 var jsonBufferPool = sync.Pool{
 	New: func() any {
 		return new(bytes.Buffer)
@@ -133,17 +227,56 @@ type Client struct {
 	queueSz int
 	workers int
 
-	asyncCh chan *pushJob
+	laneQueueSz [numLanes]int // Lane capacities set by WithLaneQueueSizes, 0 for the default
+
+	lanes       [numLanes]chan *pushJob // Async queues by priority, highest first
+	laneStats   [numLanes]laneStats
+	lanesClosed atomic.Bool
+	sched       scheduler
+	stopWorker  chan struct{} // Receives one value per worker removed by SetWorkers
+	done        chan struct{} // Closed by Close
+	closeMu     sync.RWMutex  // Held for writing while Close closes the lanes
+	overflow    OverflowPolicy
+	budget      *memBudget
 
 	running atomic.Bool
 
-	cli *http.Client
-	wg  sync.WaitGroup
-	mu  sync.Mutex
+	cli       *http.Client
+	transport Transport
+	wg        sync.WaitGroup
+	mu        sync.Mutex
 
 	activeWorkers  atomic.Int32
 	totalProcessed atomic.Int64
 	failedCount    atomic.Int64
+
+	outbox         *outbox.Outbox
+	replayInterval time.Duration
+	stopReplay     chan struct{}
+	replayWg       sync.WaitGroup
+
+	batch   *BatchConfig
+	batches batchState
+
+	auth      auth.Authenticator
+	tlsConfig *tls.Config
+
+	breakers *breakerSet
+
+	onResult     func(Result)
+	deadLetter   DeadLetterSink
+	deadLettered atomic.Int64
+
+	retryPolicy   RetryPolicy
+	retryBudget   *tokenBucket
+	retries       atomic.Int64
+	retriesDenied atomic.Int64
+
+	compression       Compression
+	compressMin       int
+	noCompressHosts   sync.Map // host -> struct{}, hosts that answered 415
+	compressedBytes   atomic.Int64
+	uncompressedBytes atomic.Int64
 }
 
 // Option configures Client behavior using functional options pattern.
@@ -167,7 +300,7 @@ func WithTimeout(d time.Duration) Option {
 // WithRetry sets the number of retry attempts for failed requests.
 //
 // Set to 0 for no retries. If not set, defaults to 0.
-// Retries use exponential backoff with jitter.
+// Retries use exponential backoff with jitter unless WithRetryPolicy is set.
 func WithRetry(n int) Option {
 	return func(c *Client) { c.retry = n }
 }
@@ -186,8 +319,10 @@ func WithWorkers(n int) Option {
 
 // WithQueueSize sets the maximum queue size for async operations.
 //
-// If the queue is full, AsyncPush will fall back to synchronous push.
-// If not set, defaults to 4096.
+// n is the capacity of the normal priority lane; the high and low lanes
+// default to a quarter of it (see WithLaneQueueSizes). If a lane is full,
+// the overflow policy applies (see WithOverflow). If not set, defaults to
+// 4096.
 func WithQueueSize(n int) Option {
 	return func(c *Client) {
 		if n > 0 {
@@ -210,6 +345,45 @@ func WithAsyncQueue(workers, queueSize int) Option {
 	}
 }
 
+// WithOutbox enables durable async delivery through ob.
+//
+// AsyncPush appends each payload to the outbox before queuing it and
+// acknowledges it after a 2xx response. Failed deliveries, records that
+// did not fit in the queue, and records left over from a previous run are
+// replayed in the background. The outbox is owned by the caller: close the
+// Client before closing the outbox. With OverflowSpill, only records that
+// overflow the queue are appended.
+func WithOutbox(ob *outbox.Outbox) Option {
+	return func(c *Client) { c.outbox = ob }
+}
+
+// WithReplayInterval sets how often pending outbox records are replayed.
+//
+// If not set, defaults to 1 second. Has no effect without WithOutbox.
+func WithReplayInterval(d time.Duration) Option {
+	return func(c *Client) {
+		if d > 0 {
+			c.replayInterval = d
+		}
+	}
+}
+
+// WithAuth sets the authenticator applied to every request attempt.
+//
+// See package push/auth for bearer, OAuth2 client-credentials, and HMAC
+// schemes. Authenticators implementing auth.Invalidator are refreshed once
+// when the receiver answers 401.
+func WithAuth(a auth.Authenticator) Option {
+	return func(c *Client) { c.auth = a }
+}
+
+// WithTLSConfig sets the TLS configuration, e.g. client certificates for
+// mutual TLS (see auth.LoadClientTLS). The Client then uses a dedicated
+// connection pool instead of the shared one.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) { c.tlsConfig = cfg }
+}
+
 // New creates a new Client with the specified options.
 //
 // The client starts worker goroutines immediately. Call Close to shut down.
@@ -219,14 +393,30 @@ func New(opts ...Option) *Client {
 		retry:   defaultRetry,
 		workers: defaultWorkers,
 		queueSz: defaultQueueSz,
-		cli:     httpClientPool.Get().(*http.Client),
+
+		replayInterval: defaultReplayInterval,
+		retryPolicy:    ExponentialBackoff(defaultInitDelay, defaultMaxDelay),
 	}
+	c.sched.weights = defaultLaneWeights
 
 	for _, opt := range opts {
 		opt(c)
 	}
 
-	c.asyncCh = make(chan *pushJob, c.queueSz)
+	if c.tlsConfig != nil {
+		c.cli = newHTTPClient(c.tlsConfig)
+	} else {
+		c.cli = httpClientPool.Get().(*http.Client)
+	}
+	if c.transport == nil {
+		c.transport = httpTransport{c: c}
+	}
+
+	for i := range c.lanes {
+		c.lanes[i] = make(chan *pushJob, c.laneCap(i))
+	}
+	c.stopWorker = make(chan struct{})
+	c.done = make(chan struct{})
 	c.running.Store(true)
 
 	for i := 0; i < c.workers; i++ {
@@ -234,6 +424,12 @@ func New(opts ...Option) *Client {
 		go c.worker(i)
 	}
 
+	if c.outbox != nil {
+		c.stopReplay = make(chan struct{})
+		c.replayWg.Add(1)
+		go c.replayLoop()
+	}
+
 	return c
 }
 
@@ -243,22 +439,97 @@ func (c *Client) worker(_ int) {
 	defer c.activeWorkers.Add(-1)
 
 	for {
-		job, ok := <-c.asyncCh
-		if !ok || job == nil {
+		job, ok := c.nextJob()
+		if !ok {
 			return
 		}
 
-		err := c.doPushWithRetry(job.url, job.payload, job.timeout, 0)
-		if err == nil {
-			c.totalProcessed.Add(1)
-		} else {
-			c.failedCount.Add(1)
+		if job.batch != nil {
+			c.deliverBatch(job.url, job.batch)
+			releaseJob(job)
+			continue
+		}
+
+		res := c.deliverJob(job)
+		c.budget.release(job.reserved)
+		c.settle(res, isFinalStatus(res.Status), job.onResult, job.failover)
+		releaseJob(job)
+	}
+}
+
+// deliverJob sends a single-record job and returns its outcome.
+func (c *Client) deliverJob(job *pushJob) Result {
+	res := Result{URL: job.url, Payload: job.payload, Body: job.body, Seq: job.seq}
+	if job.body != nil {
+		res.Status, res.Attempts, res.Err = c.post(job.url, job.key, job.body, job.timeout, job.retry)
+	} else {
+		res.Status, res.Attempts, res.Err = c.encodeAndPost(job.url, job.payload, job.timeout, job.retry)
+	}
+	res.Latency = time.Since(job.queued)
+	return res
+}
+
+// replayLoop periodically re-queues pending outbox records until Close.
+func (c *Client) replayLoop() {
+	defer c.replayWg.Done()
+	ticker := time.NewTicker(c.replayInterval)
+	defer ticker.Stop()
+
+	for {
+		c.replayOutbox()
+		select {
+		case <-c.stopReplay:
+			return
+		case <-ticker.C:
 		}
+	}
+}
 
-		job.next = nil
-		job.payload = nil
-		job.url = ""
-		jobPool.Put(job)
+// replayOutbox claims as many pending records as the normal lane and the
+// memory budget have room for. Replayed records are queued as PriorityNormal.
+func (c *Client) replayOutbox() {
+	lane := c.lanes[PriorityNormal.lane()]
+	free := cap(lane) - len(lane)
+	if free <= 0 {
+		return
+	}
+	var accept func(string) bool
+	if c.breakers != nil {
+		// Leave records for open circuits on disk so they do not take
+		// queue slots from healthy destinations.
+		accept = c.circuitReady
+	}
+	entries, _ := c.outbox.ClaimFunc(free, accept)
+	for _, e := range entries {
+		size := int64(len(e.Body))
+		if !c.budget.reserve(size) {
+			c.outbox.Release(e.Seq)
+			continue
+		}
+		if c.budget == nil {
+			size = 0
+		}
+		if c.batch != nil {
+			c.addBatch(context.Background(), e.URL, batchItem{body: e.Body, seq: e.Seq, queued: time.Now(), reserved: size}, false)
+			continue
+		}
+
+		job := jobPool.Get().(*pushJob)
+		job.url = e.URL
+		job.body = e.Body
+		job.key = e.Key
+		job.seq = e.Seq
+		job.timeout = e.Timeout
+		job.queued = time.Now()
+		job.reserved = size
+
+		select {
+		case lane <- job:
+		default:
+			c.budget.release(size)
+			c.outbox.Release(e.Seq)
+			releaseJob(job)
+		}
 	}
 }
 
@@ -282,13 +553,15 @@ func (c *Client) PushTimeout(url string, payload any, timeout time.Duration) err
 	if timeout <= 0 {
 		timeout = c.timeout
 	}
-	return c.doPushWithRetry(url, payload, timeout, c.retry)
+	_, _, err := c.encodeAndPost(url, payload, timeout, c.retry)
+	return err
 }
 
 // AsyncPush sends a payload asynchronously to the specified URL.
 //
 // Non-blocking: returns immediately after queuing. Uses the default
-// timeout for each request. Falls back to synchronous push if queue is full.
+// timeout for each request. When the queue is full, the overflow policy
+// applies; by default the payload is pushed synchronously.
 //
 // Example:
 //
@@ -299,114 +572,317 @@ func (c *Client) AsyncPush(url string, payload any) error {
 
 // AsyncPushTimeout sends a payload asynchronously with a custom timeout.
 //
-// Returns immediately after queuing (non-blocking). If the async queue
-// is full, falls back to synchronous push with the specified timeout.
+// Returns immediately after queuing (non-blocking) in the PriorityNormal
+// lane; use AsyncPushJob to choose the priority. If the lane is full, the
+// overflow policy applies (see WithOverflow); by default it falls back to
+// synchronous push with the specified timeout.
+// Returns ErrCircuitOpen without queuing while the destination's circuit
+// is open, unless an outbox is configured, and ErrClientClosed after Close.
 func (c *Client) AsyncPushTimeout(url string, payload any, timeout time.Duration) error {
-	if timeout <= 0 {
-		timeout = c.timeout
+	return c.AsyncPushJob(url, payload, JobOptions{Timeout: timeout})
+}
+
+// AsyncPushJob sends a payload asynchronously with per-job options.
+//
+// Queuing behaves like AsyncPushTimeout. Once the job completes, its
+// Result is passed to opts.OnResult and the WithOnResult handler; a
+// synchronous fallback reports its Result the same way and also returns
+// the error. Records that stay in the outbox instead of being queued are
+// reported as Retained with ErrQueueFull or ErrCircuitOpen.
+//
+// Example:
+//
+//	cli.AsyncPushJob(url, alarm, client.JobOptions{
+//	    Retry: 2,
+//	    OnResult: func(r client.Result) {
+//	        if r.Err != nil && !r.Retained {
+//	            log.Printf("alarm lost after %d attempts: %v", r.Attempts, r.Err)
+//	        }
+//	    },
+//	})
+func (c *Client) AsyncPushJob(url string, payload any, opts JobOptions) error {
+	return c.AsyncPushContext(context.Background(), url, payload, opts)
+}
+
+// AsyncPushContext is AsyncPushJob with a context bounding the wait for
+// room under OverflowBlock; delivery itself is bounded by opts.Timeout.
+// When ctx is done first, its error is returned and the payload is not
+// queued. Durable records stay in the outbox instead and are reported as
+// Retained with the context's error.
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+//	defer cancel()
+//	if err := cli.AsyncPushContext(ctx, url, kpi, client.JobOptions{}); err != nil {
+//	    log.Printf("kpi not queued: %v", err)
+//	}
+func (c *Client) AsyncPushContext(ctx context.Context, url string, payload any, opts JobOptions) error {
+	if opts.Timeout <= 0 {
+		opts.Timeout = c.timeout
+	}
+	c.closeMu.RLock()
+	defer c.closeMu.RUnlock()
+	if !c.running.Load() {
+		return ErrClientClosed
+	}
+	if c.outbox != nil && c.overflow != OverflowSpill {
+		return c.asyncPushDurable(ctx, url, payload, opts)
+	}
+	if !c.circuitReady(url) {
+		c.breakers.rejected.Add(1)
+		return c.overflowed(url, payload, nil, opts, time.Now(), ErrCircuitOpen)
+	}
+	if c.batch != nil {
+		body, err := encodeBody(payload)
+		if err != nil {
+			return err
+		}
+		queued := time.Now()
+		reserved, err := c.admit(ctx, int64(len(body)), opts.Priority)
+		if err != nil {
+			return c.overflowed(url, payload, body, opts, queued, err)
+		}
+		c.addBatch(ctx, url, batchItem{
+			body:     body,
+			payload:  payload,
+			queued:   queued,
+			onResult: opts.OnResult,
+			failover: opts.Failover,
+			reserved: reserved,
+			priority: opts.Priority,
+		}, false)
+		return nil
 	}
 
 	job := jobPool.Get().(*pushJob)
 	job.url = url
 	job.payload = payload
-	job.timeout = timeout
+	job.timeout = opts.Timeout
+	job.retry = opts.Retry
+	job.queued = time.Now()
+	job.onResult = opts.OnResult
+	job.failover = opts.Failover
+	job.priority = opts.Priority
+	if c.budget != nil {
+		// Encode now so the budget accounts the real size.
+		body, err := encodeBody(payload)
+		if err != nil {
+			releaseJob(job)
+			return err
+		}
+		job.body = body
+		job.key = idempotencyKey(payload)
+	}
 
-	select {
-	case c.asyncCh <- job:
+	err := c.enqueue(ctx, job)
+	if err == nil {
 		return nil
-	default:
-		job.next = nil
-		job.payload = nil
-		job.url = ""
-		jobPool.Put(job)
-
-		return c.doPushWithRetry(url, payload, timeout, 0)
 	}
+	body, queued := job.body, job.queued
+	releaseJob(job)
+	return c.overflowed(url, payload, body, opts, queued, err)
 }
 
-func (c *Client) doPushWithRetry(url string, payload any, timeout time.Duration, retry int) error {
-	if timeout <= 0 {
-		timeout = c.timeout
+// overflowed handles a non-durable record that was not queued because of
+// err. OverflowSpill appends it to the outbox when the queue is full or the
+// circuit is open, OverflowSync delivers it synchronously when the queue is
+// full, and otherwise err is returned. body may be nil when payload has not
+// been encoded yet.
+func (c *Client) overflowed(url string, payload any, body []byte, opts JobOptions, queued time.Time, err error) error {
+	full := errors.Is(err, ErrQueueFull)
+	if c.overflow == OverflowSpill && c.outbox != nil && (full || errors.Is(err, ErrCircuitOpen)) {
+		if body == nil {
+			var encErr error
+			if body, encErr = encodeBody(payload); encErr != nil {
+				return encErr
+			}
+		}
+		seq, appendErr := c.outbox.AppendKey(url, idempotencyKey(payload), body, opts.Timeout)
+		if appendErr != nil {
+			return fmt.Errorf("outbox append failed: %w", appendErr)
+		}
+		c.outbox.Release(seq)
+		c.report(Result{
+			URL: url, Payload: payload, Body: body, Seq: seq,
+			Latency: time.Since(queued), Err: err, Retained: true,
+		}, opts.OnResult)
+		return nil
 	}
-	if retry < 0 {
-		retry = 0
+	if c.overflow != OverflowSync || !full {
+		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	// The error goes back to the caller, so the record is reported
+	// but neither counted nor dead-lettered.
+	res := Result{URL: url, Payload: payload, Body: body}
+	if body != nil {
+		res.Status, res.Attempts, res.Err = c.post(url, idempotencyKey(payload), body, opts.Timeout, opts.Retry)
+	} else {
+		res.Status, res.Attempts, res.Err = c.encodeAndPost(url, payload, opts.Timeout, opts.Retry)
+	}
+	res.Latency = time.Since(queued)
+	c.report(res, opts.OnResult)
+	return res.Err
+}
 
-	var lastErr error
-	for attempt := 0; attempt <= retry; attempt++ {
-		if attempt > 0 {
-			delay := c.calculateBackoff(attempt)
-			timer := time.NewTimer(delay)
-			select {
-			case <-ctx.Done():
-				if !timer.Stop() {
-					select {
-					case <-timer.C:
-					default:
-					}
-				}
-				return ctx.Err()
-			case <-timer.C:
-			}
-		}
+// asyncPushDurable appends the encoded payload to the outbox, then queues it.
+// When the queue is full or the destination's circuit is open, the record
+// stays in the outbox for replay instead of falling back to a synchronous
+// push; OverflowBlock and OverflowDropOldest still wait for or make room.
+func (c *Client) asyncPushDurable(ctx context.Context, url string, payload any, opts JobOptions) error {
+	body, err := encodeBody(payload)
+	if err != nil {
+		return err
+	}
+	queued := time.Now()
+	key := idempotencyKey(payload)
+	seq, err := c.outbox.AppendKey(url, key, body, opts.Timeout)
+	if err != nil {
+		return fmt.Errorf("outbox append failed: %w", err)
+	}
+	retained := func(err error) {
+		c.outbox.Release(seq)
+		c.report(Result{
+			URL: url, Payload: payload, Body: body, Seq: seq,
+			Latency: time.Since(queued), Err: err, Retained: true,
+		}, opts.OnResult)
+	}
 
-		lastErr = c.doPush(ctx, url, payload)
-		if lastErr == nil {
+	if !c.circuitReady(url) {
+		retained(ErrCircuitOpen)
+		return nil
+	}
+	if c.batch != nil {
+		reserved, err := c.admit(ctx, int64(len(body)), opts.Priority)
+		if err != nil {
+			retained(err)
 			return nil
 		}
+		c.addBatch(ctx, url, batchItem{
+			body:     body,
+			seq:      seq,
+			payload:  payload,
+			queued:   queued,
+			onResult: opts.OnResult,
+			failover: opts.Failover,
+			reserved: reserved,
+			priority: opts.Priority,
+		}, false)
+		return nil
+	}
 
-		if !isRetryable(lastErr) {
-			break
-		}
+	job := jobPool.Get().(*pushJob)
+	job.url = url
+	job.payload = payload
+	job.body = body
+	job.key = key
+	job.seq = seq
+	job.timeout = opts.Timeout
+	job.retry = opts.Retry
+	job.queued = queued
+	job.onResult = opts.OnResult
+	job.failover = opts.Failover
+	job.priority = opts.Priority
+
+	if err := c.enqueue(ctx, job); err != nil {
+		releaseJob(job)
+		retained(err)
 	}
+	return nil
+}
+
+// encodeBody returns the JSON encoding of payload.
+func encodeBody(payload any) ([]byte, error) {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer jsonBufferPool.Put(buf)
 
-	return fmt.Errorf("push failed after %d retries: %w", retry, lastErr)
+	if err := encodeJSON(buf, payload); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
 }
 
-func (c *Client) calculateBackoff(attempt int) time.Duration {
-	delay := defaultInitDelay * time.Duration(1<<uint(attempt-1))
-	if delay > defaultMaxDelay {
-		delay = defaultMaxDelay
+// encodeAndPost encodes payload as JSON and posts it with post, keyed by
+// the payload's idempotency key.
+func (c *Client) encodeAndPost(url string, payload any, timeout time.Duration, retry int) (status, attempts int, err error) {
+	buf := jsonBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer jsonBufferPool.Put(buf)
+
+	if err := encodeJSON(buf, payload); err != nil {
+		return 0, 0, err
 	}
+	return c.post(url, idempotencyKey(payload), buf.Bytes(), timeout, retry)
+}
 
-	jitter := time.Duration(rand.Int64N(int64(delay / 2)))
-	return delay + jitter/2
+// post sends a JSON body with retries and returns the status of the last
+// response and the number of attempts made. A non-empty key is sent as the
+// Idempotency-Key header of every attempt.
+func (c *Client) post(url, key string, body []byte, timeout time.Duration, retry int) (status, attempts int, err error) {
+	err = c.withRetry(timeout, retry, func(ctx context.Context) error {
+		attempts++
+		var err error
+		status, _, err = c.send(ctx, url, key, ContentTypeJSON, body, false)
+		return err
+	})
+	return status, attempts, err
 }
 
-func isRetryable(err error) bool {
-	if err == nil {
-		return false
+// withRetry runs attempt until it succeeds, the retry policy gives up, the
+// retry budget is exhausted, or retries run out. timeout bounds all
+// attempts and backoff.
+func (c *Client) withRetry(timeout time.Duration, retry int, attempt func(ctx context.Context) error) error {
+	if timeout <= 0 {
+		timeout = c.timeout
 	}
-	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
-		return false
+	if retry < 0 {
+		retry = 0
 	}
 
-	var statusErr *httpStatusError
-	if errors.As(err, &statusErr) {
-		return statusErr.statusCode == http.StatusTooManyRequests || statusErr.statusCode >= 500
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var lastErr error
+	n := 0
+	for ; ; n++ {
+		lastErr = attempt(ctx)
+		if lastErr == nil {
+			return nil
+		}
+		if n == retry {
+			break
+		}
+
+		delay, ok := c.retryPolicy.Next(n+1, StatusCode(lastErr), lastErr)
+		if !ok {
+			break
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			// The next attempt could not start before the timeout.
+			break
+		}
+		if c.retryBudget != nil && !c.retryBudget.take() {
+			c.retriesDenied.Add(1)
+			break
+		}
 
-	var netErr net.Error
-	if errors.As(err, &netErr) && netErr.Timeout() {
-		return true
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		c.retries.Add(1)
 	}
 
-	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "connection refused") ||
-		strings.Contains(msg, "connection reset") ||
-		strings.Contains(msg, "temporary failure") ||
-		strings.Contains(msg, "timeout") ||
-		strings.Contains(msg, "i/o timeout")
+	return fmt.Errorf("push failed after %d retries: %w", n, lastErr)
 }
 
-func (c *Client) doPush(ctx context.Context, url string, payload any) error {
-	buf := jsonBufferPool.Get().(*bytes.Buffer)
-	buf.Reset()
-	defer jsonBufferPool.Put(buf)
-
+// encodeJSON writes payload to buf without HTML escaping or a trailing newline.
+func encodeJSON(buf *bytes.Buffer, payload any) error {
 	enc := json.NewEncoder(buf)
 	enc.SetEscapeHTML(false)
 	if err := enc.Encode(payload); err != nil {
@@ -415,53 +891,141 @@ func (c *Client) doPush(ctx context.Context, url string, payload any) error {
 	if n := buf.Len(); n > 0 && buf.Bytes()[n-1] == '\n' {
 		buf.Truncate(n - 1)
 	}
+	return nil
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(buf.Bytes()))
+// send delivers body to url through the transport, with key as the
+// idempotency key when not empty, and returns the response status (0 when
+// no response was received). When wantBody is set, up to maxRespBodyBytes
+// of a successful response body are returned; otherwise the body is
+// discarded.
+// With a circuit breaker, the request is rejected with ErrCircuitOpen while
+// the destination's circuit is open and its outcome is recorded otherwise;
+// a canceled request only gives back its probe slot.
+func (c *Client) send(ctx context.Context, url, key, contentType string, body []byte, wantBody bool) (int, []byte, error) {
+	var bk string
+	if c.breakers != nil {
+		bk = c.breakers.key(url)
+		if err := c.breakers.allow(bk); err != nil {
+			return 0, nil, err
+		}
+	}
+	msg := &Message{URL: url, Key: key, ContentType: contentType, Body: body, wantBody: wantBody}
+	status, data, err := c.transport.Send(ctx, msg)
+	if status == 0 {
+		status = StatusCode(err)
+	}
+	if c.breakers != nil {
+		if errors.Is(err, context.Canceled) {
+			c.breakers.release(bk)
+		} else {
+			c.breakers.done(bk, isBreakerFailure(err))
+		}
+	}
+	return status, data, err
+}
+
+// sendRequest performs one POST. A 415 to a compressed body is resent
+// uncompressed; a 401 with cached credentials is resent once after
+// invalidating them (reauthed reports that this already happened).
+func (c *Client) sendRequest(ctx context.Context, url, key, contentType string, body []byte, wantBody, reauthed bool) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
 	if err != nil {
-		return fmt.Errorf("create request failed: %w", err)
+		return 0, nil, fmt.Errorf("create request failed: %w", err)
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	payload, encoding := c.compressBody(req.URL.Host, body)
+	req.Body = io.NopCloser(bytes.NewReader(payload))
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(payload)), nil }
+	req.ContentLength = int64(len(payload))
+
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("User-Agent", "go-oam-push/1.0")
-	req.ContentLength = int64(buf.Len())
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	if c.auth != nil {
+		if err := c.auth.Authenticate(req, payload); err != nil {
+			return 0, nil, fmt.Errorf("authenticate failed: %w", err)
+		}
+	}
 
 	resp, err := c.cli.Do(req)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return 0, nil, fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnsupportedMediaType && encoding != "" {
+		// Receiver cannot decode the body: remember and resend uncompressed.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrBodyBytes))
+		c.noCompressHosts.Store(req.URL.Host, struct{}{})
+		return c.sendRequest(ctx, url, key, contentType, body, wantBody, reauthed)
+	}
+
+	if inv, ok := c.auth.(auth.Invalidator); ok && resp.StatusCode == http.StatusUnauthorized && !reauthed {
+		// Cached credentials were rejected (e.g. revoked token): refresh once.
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrBodyBytes))
+		inv.Invalidate()
+		return c.sendRequest(ctx, url, key, contentType, body, wantBody, true)
+	}
+
 	if resp.StatusCode >= 400 {
 		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrBodyBytes))
 		_, _ = io.Copy(io.Discard, resp.Body)
-		return &httpStatusError{
+		return resp.StatusCode, nil, &httpStatusError{
 			statusCode: resp.StatusCode,
 			body:       string(data),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
 		}
 	}
 
+	var data []byte
+	if wantBody {
+		data, _ = io.ReadAll(io.LimitReader(resp.Body, maxRespBodyBytes))
+	}
 	_, _ = io.Copy(io.Discard, resp.Body)
-	return nil
+	return resp.StatusCode, data, nil
 }
 
 // Close gracefully shuts down the client.
 //
 // Waits for all pending jobs to complete before returning.
-// Safe to call multiple times.
+// Outbox records that are still undelivered stay on disk for the next run.
+// Async pushes blocked by OverflowBlock return ErrClientClosed, as do
+// async pushes made after Close. Safe to call multiple times.
 func (c *Client) Close() {
 	if c == nil {
 		return
 	}
 	if c.running.CompareAndSwap(true, false) {
-		close(c.asyncCh)
+		close(c.done)
+		if c.stopReplay != nil {
+			close(c.stopReplay)
+			c.replayWg.Wait()
+		}
+		if c.batch != nil {
+			c.closeBatches()
+		}
+		// Wait for async pushes that are still queuing.
+		c.closeMu.Lock()
+		for _, ch := range c.lanes {
+			close(ch)
+		}
+		c.lanesClosed.Store(true)
+		c.closeMu.Unlock()
 		c.wg.Wait()
+		_ = c.transport.Close()
 	}
 }
 
 // SetWorkers dynamically adjusts the number of worker goroutines.
 //
 // Can be called at runtime to scale up or down. When scaling down,
-// sends nil jobs to gracefully stop excess workers.
+// excess workers stop after finishing their current job.
 // Thread-safe.
 func (c *Client) SetWorkers(n int) {
 	if n <= 0 {
@@ -483,7 +1047,11 @@ func (c *Client) SetWorkers(n int) {
 		}
 	} else {
 		for i := 0; i < currentWorkers-n; i++ {
-			c.asyncCh <- nil
+			select {
+			case c.stopWorker <- struct{}{}:
+			case <-c.done:
+				return
+			}
 		}
 	}
 
@@ -547,12 +1115,34 @@ func (c *Client) BatchPush(url string, payloads []any) error {
 //	stats := cli.Stats()
 //	fmt.Printf("Processed: %d, Failed: %d\n", stats.TotalProcessed, stats.FailedCount)
 func (c *Client) Stats() PoolStats {
-	return PoolStats{
+	stats := PoolStats{
 		ActiveWorkers:  c.activeWorkers.Load(),
-		QueueLength:    len(c.asyncCh),
+		QueueLength:    c.queueLength(),
 		TotalProcessed: c.totalProcessed.Load(),
 		FailedCount:    c.failedCount.Load(),
+		QueuedBytes:    c.budget.usedBytes(),
+		Lanes:          c.laneSnapshot(),
+
+		UncompressedBytes: c.uncompressedBytes.Load(),
+		CompressedBytes:   c.compressedBytes.Load(),
+
+		DeadLettered:  c.deadLettered.Load(),
+		Retries:       c.retries.Load(),
+		RetriesDenied: c.retriesDenied.Load(),
+	}
+	for _, l := range stats.Lanes {
+		stats.Dropped += l.Dropped
+	}
+	if c.outbox != nil {
+		ob := c.outbox.Stats()
+		stats.OutboxBytes = ob.Bytes
+		stats.OutboxRecords = ob.Records
+	}
+	if c.breakers != nil {
+		stats.Circuits = c.breakers.states()
+		stats.CircuitRejected = c.breakers.rejected.Load()
 	}
+	return stats
 }
 
 // HealthCheck verifies the client is operational.
@@ -564,9 +1154,10 @@ func (c *Client) HealthCheck() error {
 		return errors.New("client is not running")
 	}
 
+	lane := c.lanes[PriorityNormal.lane()]
 	select {
-	case job := <-c.asyncCh:
-		c.asyncCh <- job
+	case job := <-lane:
+		lane <- job
 		return nil
 	default:
 		return nil
@@ -0,0 +1,227 @@
+package client
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/tsmask/go-oam/push/outbox"
+)
+
+// testRequest is one request seen by testReceiver.
+type testRequest struct {
+	header http.Header
+	body   string
+	status int
+}
+
+// testReceiver records requests and answers with a configurable status, or
+// with the status and body returned by handle when set. gzip and zstd bodies
+// are decoded first; undecodable ones are answered with 400.
+type testReceiver struct {
+	status atomic.Int32
+	handle func(req *http.Request, body []byte) (int, []byte)
+	mu     sync.Mutex
+	reqs   []testRequest
+}
+
+func newTestReceiver(t *testing.T, status int) (*testReceiver, *httptest.Server) {
+	r, srv := newTestReceiverFunc(t, nil)
+	r.status.Store(int32(status))
+	return r, srv
+}
+
+func newTestReceiverFunc(t *testing.T, handle func(req *http.Request, body []byte) (int, []byte)) (*testReceiver, *httptest.Server) {
+	r := &testReceiver{handle: handle}
+	r.status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := readBody(req)
+		code, resp := int(r.status.Load()), []byte(nil)
+		if err != nil {
+			code = http.StatusBadRequest
+		} else if r.handle != nil {
+			code, resp = r.handle(req, body)
+		}
+		r.mu.Lock()
+		r.reqs = append(r.reqs, testRequest{header: req.Header.Clone(), body: string(body), status: code})
+		r.mu.Unlock()
+		w.WriteHeader(code)
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return r, srv
+}
+
+// readBody reads the request body, decoding its Content-Encoding.
+func readBody(req *http.Request) ([]byte, error) {
+	var body io.Reader = req.Body
+	switch req.Header.Get("Content-Encoding") {
+	case "gzip":
+		zr, err := gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = zr
+	case "zstd":
+		zr, err := zstd.NewReader(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		body = zr
+	}
+	return io.ReadAll(body)
+}
+
+// requests returns every request seen so far, whatever its status.
+func (r *testReceiver) requests() []testRequest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]testRequest(nil), r.reqs...)
+}
+
+// received returns the bodies of accepted (2xx) requests.
+func (r *testReceiver) received() []string {
+	var bodies []string
+	for _, req := range r.requests() {
+		if req.status < 300 {
+			bodies = append(bodies, req.body)
+		}
+	}
+	return bodies
+}
+
+func waitUntil(t *testing.T, d time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %v", d)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_OutboxReplaysAfterOutage(t *testing.T) {
+	recv, srv := newTestReceiver(t, http.StatusServiceUnavailable)
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+
+	cli := New(WithOutbox(ob), WithWorkers(2), WithReplayInterval(20*time.Millisecond))
+	defer cli.Close()
+
+	for i := range 3 {
+		if err := cli.AsyncPush(srv.URL, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().FailedCount >= 3 })
+	if st := cli.Stats(); st.OutboxRecords != 3 || st.OutboxBytes == 0 {
+		t.Fatalf("stats during outage = %+v", st)
+	}
+
+	recv.status.Store(http.StatusOK)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().OutboxRecords == 0 })
+	if got := recv.received(); len(got) != 3 {
+		t.Fatalf("received %d records, want 3: %v", len(got), got)
+	}
+	if st := cli.Stats(); st.OutboxBytes != 0 {
+		t.Fatalf("OutboxBytes = %d after ack", st.OutboxBytes)
+	}
+}
+
+func TestClient_OutboxSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	recv, srv := newTestReceiver(t, http.StatusServiceUnavailable)
+
+	ob, err := outbox.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli := New(WithOutbox(ob), WithReplayInterval(time.Hour))
+	_ = cli.AsyncPush(srv.URL, map[string]string{"alarm": "link down"})
+	cli.Close()
+	_ = ob.Close()
+
+	recv.status.Store(http.StatusOK)
+	ob, err = outbox.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	cli = New(WithOutbox(ob), WithReplayInterval(time.Hour))
+	defer cli.Close()
+
+	waitUntil(t, 2*time.Second, func() bool { return len(recv.received()) == 1 })
+	if got := recv.received()[0]; got != `{"alarm":"link down"}` {
+		t.Fatalf("body = %s", got)
+	}
+	waitUntil(t, time.Second, func() bool { return ob.Pending() == 0 })
+}
+
+// keyedPayload is an Idempotent test payload.
+type keyedPayload struct {
+	ID string `json:"id"`
+}
+
+func (p keyedPayload) IdempotencyKey() string { return p.ID }
+
+func TestClient_IdempotencyKeyOnRetriesAndReplay(t *testing.T) {
+	var mu sync.Mutex
+	var keys []string
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+		mu.Unlock()
+		if hits.Add(1) <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+	got := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), keys...)
+	}
+
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	cli := New(WithOutbox(ob), WithWorkers(1), WithRetry(1), WithRetryPolicy(&recordingPolicy{}), WithReplayInterval(20*time.Millisecond))
+	defer cli.Close()
+
+	// Sync: both attempts carry the key
+	if err := cli.Push(srv.URL, keyedPayload{ID: "k-1"}); err == nil {
+		t.Fatal("push to failing receiver succeeded")
+	}
+	// Durable async: the first attempt fails, the replay carries the key
+	// read back from the outbox.
+	if err := cli.AsyncPush(srv.URL, keyedPayload{ID: "k-2"}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 2*time.Second, func() bool { return ob.Pending() == 0 })
+	// Plain payloads carry no key
+	if err := cli.Push(srv.URL, map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"k-1", "k-1", "k-2", "k-2", ""}
+	if k := got(); fmt.Sprint(k) != fmt.Sprint(want) {
+		t.Fatalf("Idempotency-Key headers = %q, want %q", k, want)
+	}
+}
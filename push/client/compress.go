@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const defaultCompressMinSize = 1024
+
+// Compression selects the request body compression algorithm.
+type Compression int
+
+const (
+	// CompressNone sends bodies uncompressed (default).
+	CompressNone Compression = iota
+	// CompressGzip sends bodies with Content-Encoding: gzip.
+	CompressGzip
+	// CompressZstd sends bodies with Content-Encoding: zstd.
+	CompressZstd
+)
+
+// encoding returns the Content-Encoding token for c.
+func (c Compression) encoding() string {
+	switch c {
+	case CompressGzip:
+		return "gzip"
+	case CompressZstd:
+		return "zstd"
+	default:
+		return ""
+	}
+}
+
+// WithCompression compresses request bodies of at least minSize bytes.
+//
+// If minSize <= 0, defaults to 1024. When a receiver answers 415
+// Unsupported Media Type to a compressed request, the request is resent
+// uncompressed and compression stays off for that host for the lifetime of
+// the Client.
+func WithCompression(alg Compression, minSize int) Option {
+	return func(c *Client) {
+		if minSize <= 0 {
+			minSize = defaultCompressMinSize
+		}
+		c.compression = alg
+		c.compressMin = minSize
+	}
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(nil)
+	},
+}
+
+// zstdEncoder is shared by all clients; EncodeAll is safe for concurrent use.
+var zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+	enc, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	return enc
+})
+
+// compressBody returns the body to send and its Content-Encoding. Bodies
+// below the threshold, hosts that rejected compression, and compression
+// errors all fall back to the original body with an empty encoding.
+func (c *Client) compressBody(host string, body []byte) ([]byte, string) {
+	if c.compression == CompressNone || len(body) < c.compressMin {
+		return body, ""
+	}
+	if _, off := c.noCompressHosts.Load(host); off {
+		return body, ""
+	}
+
+	var out []byte
+	switch c.compression {
+	case CompressGzip:
+		var buf bytes.Buffer
+		buf.Grow(len(body) / 4)
+		zw := gzipWriterPool.Get().(*gzip.Writer)
+		zw.Reset(&buf)
+		_, err := zw.Write(body)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		gzipWriterPool.Put(zw)
+		if err != nil {
+			return body, ""
+		}
+		out = buf.Bytes()
+	case CompressZstd:
+		out = zstdEncoder().EncodeAll(body, make([]byte, 0, len(body)/4))
+	default:
+		return body, ""
+	}
+
+	c.uncompressedBytes.Add(int64(len(body)))
+	c.compressedBytes.Add(int64(len(out)))
+	return out, c.compression.encoding()
+}
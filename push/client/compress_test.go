@@ -0,0 +1,92 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newCompressReceiver returns a testReceiver that answers 415 to any
+// compressed request when reject is set.
+func newCompressReceiver(t *testing.T, reject bool) (*testReceiver, *httptest.Server) {
+	return newTestReceiverFunc(t, func(req *http.Request, _ []byte) (int, []byte) {
+		if reject && req.Header.Get("Content-Encoding") != "" {
+			return http.StatusUnsupportedMediaType, nil
+		}
+		return http.StatusOK, nil
+	})
+}
+
+// encodings returns the Content-Encoding of every request seen by r.
+func encodings(r *testReceiver) []string {
+	var encs []string
+	for _, req := range r.requests() {
+		encs = append(encs, req.header.Get("Content-Encoding"))
+	}
+	return encs
+}
+
+func TestCompression_RoundTrip(t *testing.T) {
+	payload := map[string]string{"data": strings.Repeat("cpu=85.5;", 400)}
+	for _, tc := range []struct {
+		alg  Compression
+		name string
+	}{{CompressGzip, "gzip"}, {CompressZstd, "zstd"}} {
+		t.Run(tc.name, func(t *testing.T) {
+			recv, srv := newCompressReceiver(t, false)
+			cli := New(WithCompression(tc.alg, 256))
+			defer cli.Close()
+
+			if err := cli.Push(srv.URL, payload); err != nil {
+				t.Fatal(err)
+			}
+			encs, bodies := encodings(recv), recv.received()
+			if encs[0] != tc.name || !strings.Contains(bodies[0], "cpu=85.5;") {
+				t.Fatalf("encoding = %q body = %.40s", encs[0], bodies[0])
+			}
+			st := cli.Stats()
+			if st.UncompressedBytes <= st.CompressedBytes*5 {
+				t.Fatalf("stats = %+v, want ratio > 5", st)
+			}
+		})
+	}
+}
+
+func TestCompression_BelowThreshold(t *testing.T) {
+	recv, srv := newCompressReceiver(t, false)
+	cli := New(WithCompression(CompressGzip, 1024))
+	defer cli.Close()
+
+	if err := cli.Push(srv.URL, map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if encs := encodings(recv); encs[0] != "" {
+		t.Fatalf("small body sent with encoding %q", encs[0])
+	}
+	if st := cli.Stats(); st.CompressedBytes != 0 {
+		t.Fatalf("CompressedBytes = %d", st.CompressedBytes)
+	}
+}
+
+func TestCompression_FallbackOn415(t *testing.T) {
+	recv, srv := newCompressReceiver(t, true)
+	cli := New(WithCompression(CompressGzip, 16))
+	defer cli.Close()
+
+	payload := map[string]string{"data": strings.Repeat("x", 64)}
+	for range 2 {
+		if err := cli.Push(srv.URL, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	encs, bodies := encodings(recv), recv.received()
+	// First push: compressed (415) then uncompressed; second push: uncompressed only.
+	if want := []string{"gzip", "", ""}; strings.Join(encs, ",") != strings.Join(want, ",") {
+		t.Fatalf("encodings = %q, want %q", encs, want)
+	}
+	if len(bodies) != 2 || !bytes.Contains([]byte(bodies[1]), []byte("xxxx")) {
+		t.Fatalf("bodies = %q", bodies)
+	}
+}
@@ -0,0 +1,280 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed reports that an async push was attempted after Close.
+var ErrClientClosed = errors.New("client closed")
+
+// ErrDropped is the Result error of a queued record evicted by
+// OverflowDropOldest.
+var ErrDropped = errors.New("dropped from full async queue")
+
+// OverflowPolicy selects what an async push does when its priority lane or
+// the memory budget is full.
+type OverflowPolicy int
+
+const (
+	// OverflowSync delivers the record synchronously on the caller's
+	// goroutine (default). Durable records stay in the outbox instead.
+	OverflowSync OverflowPolicy = iota
+	// OverflowBlock waits for room until the context passed to
+	// AsyncPushContext is done or the client is closed.
+	OverflowBlock
+	// OverflowReject returns ErrQueueFull. Durable records stay in the
+	// outbox and are reported as Retained instead.
+	OverflowReject
+	// OverflowDropOldest evicts the oldest queued job to make room: from the
+	// record's own lane when the lane is full, and from the lowest non-empty
+	// lane not above the record's priority when the memory budget is full.
+	// Evicted records are reported with ErrDropped: non-durable ones are
+	// dead-lettered, durable ones stay in the outbox.
+	OverflowDropOldest
+	// OverflowSpill appends the record to the outbox and returns; replay
+	// delivers it once the queue drains. With this policy the outbox only
+	// holds records that overflowed, instead of every async record. Without
+	// an outbox it behaves like OverflowReject.
+	OverflowSpill
+)
+
+// String returns the policy name.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowSync:
+		return "sync"
+	case OverflowBlock:
+		return "block"
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowSpill:
+		return "spill"
+	default:
+		return "unknown"
+	}
+}
+
+// WithOverflow sets the policy applied when an async push finds its lane
+// or the memory budget full. If not set, defaults to OverflowSync.
+//
+// In batch mode the policy also applies when a flushed batch finds its
+// lane full. Its records were already accepted, so they are reported
+// through their Result rather than by the push that flushed the batch.
+//
+// Example:
+//
+//	cli := client.New(
+//	    client.WithOverflow(client.OverflowBlock),
+//	    client.WithMemoryBudget(64<<20),
+//	)
+//	ctx, cancel := context.WithTimeout(ctx, time.Second)
+//	defer cancel()
+//	err := cli.AsyncPushContext(ctx, url, payload, client.JobOptions{})
+func WithOverflow(p OverflowPolicy) Option {
+	return func(c *Client) { c.overflow = p }
+}
+
+// WithMemoryBudget bounds the encoded payload bytes held by queued and
+// in-flight async records, including records waiting in batches. A push
+// that would exceed the budget is handled by the overflow policy, as when
+// the queue is full. A record larger than the whole budget is admitted
+// only when nothing else is held. If n <= 0, only the queue size bounds
+// the async queue (default).
+//
+// With a budget, non-durable payloads are encoded when they are queued
+// rather than by the worker.
+func WithMemoryBudget(n int64) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.budget = &memBudget{limit: n, freed: make(chan struct{})}
+		}
+	}
+}
+
+// memBudget accounts the payload bytes held by async records. A nil
+// budget admits everything.
+type memBudget struct {
+	limit int64
+
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{} // Closed and replaced whenever bytes are released
+}
+
+// reserve takes n bytes and reports whether they were available.
+func (b *memBudget) reserve(n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.used > 0 && b.used+n > b.limit {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// release returns n reserved bytes and wakes waiters.
+func (b *memBudget) release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	b.used -= n
+	close(b.freed)
+	b.freed = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// wait returns a channel closed by the next release. A nil budget never
+// releases.
+func (b *memBudget) wait() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.freed
+}
+
+func (b *memBudget) usedBytes() int64 {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.used
+}
+
+// admit reserves budget for size bytes of a record with priority p,
+// applying the blocking and drop-oldest policies when the budget is full.
+// It returns the reserved byte count, which the caller releases when the
+// record is settled, or ErrQueueFull when the caller must apply another
+// policy.
+func (c *Client) admit(ctx context.Context, size int64, p Priority) (int64, error) {
+	if c.budget == nil {
+		return 0, nil
+	}
+	for {
+		wake := c.budget.wait()
+		if c.budget.reserve(size) {
+			return size, nil
+		}
+		var err error
+		switch c.overflow {
+		case OverflowBlock:
+			select {
+			case <-wake:
+				continue
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-c.done:
+				err = ErrClientClosed
+			}
+		case OverflowDropOldest:
+			if c.dropLowest(p) {
+				continue
+			}
+			err = ErrQueueFull
+		default:
+			err = ErrQueueFull
+		}
+		c.laneStats[p.lane()].overflowed.Add(1)
+		return 0, err
+	}
+}
+
+// enqueue admits job to the lane of its priority. When the lane or the
+// memory budget is full, OverflowBlock waits for room and
+// OverflowDropOldest evicts queued jobs; the other policies get
+// ErrQueueFull and the job back for the caller to handle. On success the
+// lane owns the job.
+//
+// The caller holds c.closeMu for reading.
+func (c *Client) enqueue(ctx context.Context, job *pushJob) error {
+	reserved, err := c.admit(ctx, int64(len(job.body)), job.priority)
+	if err != nil {
+		return err
+	}
+	job.reserved = reserved
+	lane := job.priority.lane()
+	for {
+		select {
+		case c.lanes[lane] <- job:
+			return nil
+		default:
+		}
+		switch c.overflow {
+		case OverflowBlock:
+			select {
+			case c.lanes[lane] <- job:
+				return nil
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-c.done:
+				err = ErrClientClosed
+			}
+		case OverflowDropOldest:
+			if c.dropOldest(lane) {
+				continue
+			}
+			err = ErrQueueFull
+		default:
+			err = ErrQueueFull
+		}
+		c.laneStats[lane].overflowed.Add(1)
+		job.reserved = 0
+		c.budget.release(reserved)
+		return err
+	}
+}
+
+// dropLowest evicts the oldest job of the lowest non-empty lane not above
+// priority p and reports whether there was one.
+func (c *Client) dropLowest(p Priority) bool {
+	for lane := numLanes - 1; lane >= p.lane(); lane-- {
+		if c.dropOldest(lane) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropOldest evicts the oldest job of a lane and reports whether there was one.
+func (c *Client) dropOldest(lane int) bool {
+	var job *pushJob
+	select {
+	case job = <-c.lanes[lane]:
+	default:
+	}
+	if job == nil {
+		return false
+	}
+
+	dropped := &c.laneStats[lane].dropped
+	if job.batch != nil {
+		for _, it := range job.batch {
+			dropped.Add(1)
+			c.budget.release(it.reserved)
+			c.settle(Result{
+				URL: job.url, Payload: it.payload, Body: it.body, Seq: it.seq,
+				Attempts: it.sent, Latency: time.Since(it.queued), Err: ErrDropped,
+			}, it.seq == 0, it.onResult, it.failover)
+		}
+	} else {
+		dropped.Add(1)
+		c.budget.release(job.reserved)
+		c.settle(Result{
+			URL: job.url, Payload: job.payload, Body: job.body, Seq: job.seq,
+			Latency: time.Since(job.queued), Err: ErrDropped,
+		}, job.seq == 0, job.onResult, job.failover)
+	}
+	releaseJob(job)
+	return true
+}
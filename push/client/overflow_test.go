@@ -0,0 +1,227 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push/outbox"
+)
+
+// newGatedClient returns a client with one worker and a one-slot queue
+// whose transport holds every message until the returned gate is closed.
+// It waits until a first record is in flight and a second one is queued.
+func newGatedClient(t *testing.T, opts ...Option) (*Client, *fakeTransport, chan struct{}) {
+	t.Helper()
+	gate := make(chan struct{})
+	started := make(chan struct{}, 100)
+	ft := &fakeTransport{reply: func(int, *Message) (int, []byte, error) {
+		started <- struct{}{}
+		<-gate
+		return 200, nil, nil
+	}}
+	cli := New(append([]Option{WithTransport(ft), WithWorkers(1), WithQueueSize(1)}, opts...)...)
+	t.Cleanup(cli.Close)
+
+	if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 2}); err != nil {
+		t.Fatal(err)
+	}
+	return cli, ft, gate
+}
+
+func TestOverflow_Reject(t *testing.T) {
+	cli, ft, gate := newGatedClient(t, WithOverflow(OverflowReject))
+	if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 3}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("err = %v, want ErrQueueFull", err)
+	}
+	close(gate)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 2 })
+	if n := len(ft.sent()); n != 2 {
+		t.Fatalf("sent %d messages, want 2", n)
+	}
+}
+
+func TestOverflow_DropOldest(t *testing.T) {
+	dlq := NewDeadLetterQueue(10)
+	cli, ft, gate := newGatedClient(t, WithOverflow(OverflowDropOldest), WithDeadLetter(dlq))
+	if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if st := cli.Stats(); st.Dropped != 1 {
+		t.Fatalf("Dropped = %d, want 1", st.Dropped)
+	}
+	items := dlq.Items()
+	if len(items) != 1 || !errors.Is(items[0].Err, ErrDropped) || items[0].Payload.(map[string]int)["n"] != 2 {
+		t.Fatalf("dead letters = %+v", items)
+	}
+
+	close(gate)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 2 })
+	if msgs := ft.sent(); len(msgs) != 2 || !strings.Contains(string(msgs[1].Body), `"n":3`) {
+		t.Fatalf("sent %d messages, last %q", len(msgs), msgs[len(msgs)-1].Body)
+	}
+}
+
+func TestOverflow_BlockWaitsForRoom(t *testing.T) {
+	cli, _, gate := newGatedClient(t, WithOverflow(OverflowBlock))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cli.AsyncPushContext(ctx, "http://nms/push", map[string]int{"n": 3}, JobOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cli.AsyncPush("http://nms/push", map[string]int{"n": 4}) }()
+	select {
+	case err := <-done:
+		t.Fatalf("push returned %v while the queue was full", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(gate)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 3 })
+
+	cli.Close()
+	if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 5}); !errors.Is(err, ErrClientClosed) {
+		t.Fatalf("push after Close: err = %v, want ErrClientClosed", err)
+	}
+}
+
+func TestOverflow_MemoryBudget(t *testing.T) {
+	gate := make(chan struct{})
+	ft := &fakeTransport{reply: func(int, *Message) (int, []byte, error) {
+		<-gate
+		return 200, nil, nil
+	}}
+	cli := New(WithTransport(ft), WithWorkers(1), WithOverflow(OverflowReject), WithMemoryBudget(100))
+	defer cli.Close()
+
+	payload := map[string]string{"v": strings.Repeat("x", 60)}
+	if err := cli.AsyncPush("http://nms/push", payload); err != nil {
+		t.Fatal(err)
+	}
+	used := cli.Stats().QueuedBytes
+	if used < 60 || used > 100 {
+		t.Fatalf("QueuedBytes = %d", used)
+	}
+	if err := cli.AsyncPush("http://nms/push", payload); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("push over budget: err = %v, want ErrQueueFull", err)
+	}
+
+	close(gate)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().QueuedBytes == 0 })
+	if err := cli.AsyncPush("http://nms/push", payload); err != nil {
+		t.Fatalf("push after release: %v", err)
+	}
+}
+
+func TestOverflow_SpillToOutbox(t *testing.T) {
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+
+	var results resultLog
+	cli, ft, gate := newGatedClient(t,
+		WithOverflow(OverflowSpill),
+		WithOutbox(ob),
+		WithReplayInterval(20*time.Millisecond),
+		WithOnResult(results.add),
+	)
+	// Only the record that overflowed is written to the outbox.
+	if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if st := cli.Stats(); st.OutboxRecords != 1 {
+		t.Fatalf("OutboxRecords = %d, want 1", st.OutboxRecords)
+	}
+	if r := results.get(); len(r) != 1 || !r[0].Retained || !errors.Is(r[0].Err, ErrQueueFull) {
+		t.Fatalf("results = %+v", r)
+	}
+
+	close(gate)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().OutboxRecords == 0 })
+	if msgs := ft.sent(); len(msgs) != 3 || !strings.Contains(string(msgs[2].Body), `"n":3`) {
+		t.Fatalf("sent %d messages", len(msgs))
+	}
+}
+
+func TestOverflow_BatchFollowsPolicy(t *testing.T) {
+	batched := WithBatch(BatchConfig{MaxRecords: 1, Linger: time.Hour})
+
+	t.Run("reject", func(t *testing.T) {
+		var results resultLog
+		cli, ft, gate := newGatedClient(t, batched, WithOverflow(OverflowReject), WithOnResult(results.add))
+		// The batch overflows when flushed: the caller is not made to
+		// deliver it, and the record is failed with ErrQueueFull.
+		if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 3}); err != nil {
+			t.Fatal(err)
+		}
+		if r := results.get(); len(r) != 1 || !errors.Is(r[0].Err, ErrQueueFull) || r[0].Retained {
+			t.Fatalf("results = %+v", r)
+		}
+		if st := cli.Stats(); st.Lanes[PriorityNormal].Overflowed != 1 || st.FailedCount != 1 {
+			t.Fatalf("stats = %+v", st)
+		}
+		close(gate)
+		waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 2 })
+		if n := len(ft.sent()); n != 2 {
+			t.Fatalf("sent %d messages, want 2", n)
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		cli, ft, gate := newGatedClient(t, batched, WithOverflow(OverflowBlock), WithMemoryBudget(1<<20))
+		done := make(chan error, 1)
+		go func() { done <- cli.AsyncPush("http://nms/push", map[string]int{"n": 3}) }()
+		select {
+		case err := <-done:
+			t.Fatalf("push returned %v while the queue was full", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(gate)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 3 })
+		if st := cli.Stats(); st.QueuedBytes != 0 || len(ft.sent()) != 3 {
+			t.Fatalf("stats = %+v, sent %d", st, len(ft.sent()))
+		}
+	})
+
+	t.Run("spill", func(t *testing.T) {
+		ob, err := outbox.Open(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ob.Close()
+		var results resultLog
+		cli, ft, gate := newGatedClient(t, batched,
+			WithOverflow(OverflowSpill), WithOutbox(ob),
+			WithReplayInterval(20*time.Millisecond), WithOnResult(results.add))
+		if err := cli.AsyncPush("http://nms/push", map[string]int{"n": 3}); err != nil {
+			t.Fatal(err)
+		}
+		if st := cli.Stats(); st.OutboxRecords != 1 {
+			t.Fatalf("OutboxRecords = %d, want 1", st.OutboxRecords)
+		}
+		if r := results.get(); len(r) != 1 || !r[0].Retained || !errors.Is(r[0].Err, ErrQueueFull) {
+			t.Fatalf("results = %+v", r)
+		}
+		close(gate)
+		waitUntil(t, 2*time.Second, func() bool { return cli.Stats().OutboxRecords == 0 })
+		if msgs := ft.sent(); len(msgs) != 3 || !strings.Contains(string(msgs[2].Body), `"n":3`) {
+			t.Fatalf("sent %d messages", len(msgs))
+		}
+	})
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Priority is the delivery class of an async job. Each class has its own
+// queue (lane), sized by WithQueueSize and WithLaneQueueSizes; workers
+// serve the lanes by weighted round-robin, so higher classes get most of
+// the workers during congestion without starving lower ones.
+type Priority int
+
+const (
+	// PriorityLow is for bulk records such as routine KPIs.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default class.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for records such as critical alarms.
+	PriorityHigh Priority = 1
+)
+
+// numLanes is the number of priority classes.
+const numLanes = 3
+
+// Default lane weights, highest class first.
+var defaultLaneWeights = [numLanes]int{8, 2, 1}
+
+// laneCap returns the capacity of lane: WithQueueSize for the normal lane,
+// and for the others the WithLaneQueueSizes value or a quarter of
+// WithQueueSize, at least one job.
+func (c *Client) laneCap(lane int) int {
+	if lane == PriorityNormal.lane() {
+		return c.queueSz
+	}
+	if n := c.laneQueueSz[lane]; n > 0 {
+		return n
+	}
+	return max(c.queueSz/4, 1)
+}
+
+// String returns the class name.
+func (p Priority) String() string {
+	switch p.clamp() {
+	case PriorityHigh:
+		return "high"
+	case PriorityLow:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// clamp maps out-of-range values to the nearest class.
+func (p Priority) clamp() Priority {
+	return max(PriorityLow, min(p, PriorityHigh))
+}
+
+// lane returns the lane index of p, 0 being the highest class.
+func (p Priority) lane() int {
+	return int(PriorityHigh - p.clamp())
+}
+
+// laneStats are the counters of one lane.
+type laneStats struct {
+	dropped    atomic.Int64
+	overflowed atomic.Int64
+	processed  atomic.Int64
+}
+
+// LaneStats holds statistics about one priority lane.
+type LaneStats struct {
+	QueueLength int   // Jobs waiting in the lane
+	Processed   int64 // Jobs taken from the lane by workers
+	Overflowed  int64 // Records not queued because the lane or memory budget was full
+	Dropped     int64 // Queued records evicted by OverflowDropOldest
+}
+
+// WithPriorityWeights sets how often workers serve each priority lane
+// relative to the others while several lanes have work. With the default
+// weights 8, 2, 1, a worker takes eight high and two normal jobs for every
+// low one. Weights <= 0 are ignored.
+//
+// Example:
+//
+//	cli := client.New(client.WithPriorityWeights(16, 4, 1))
+//	cli.AsyncPushJob(url, alarm, client.JobOptions{Priority: client.PriorityHigh})
+func WithPriorityWeights(high, normal, low int) Option {
+	return func(c *Client) {
+		for i, w := range [numLanes]int{high, normal, low} {
+			if w > 0 {
+				c.sched.weights[i] = w
+			}
+		}
+	}
+}
+
+// WithLaneQueueSizes sets the capacity of the high and low priority lanes.
+// The normal lane holds WithQueueSize jobs; the high and low lanes default
+// to a quarter of it, at least one job. Sizes <= 0 keep the default.
+//
+// Example:
+//
+//	cli := client.New(
+//	    client.WithQueueSize(4096),
+//	    client.WithLaneQueueSizes(1024, 16384), // buffer bulk KPIs
+//	)
+func WithLaneQueueSizes(high, low int) Option {
+	return func(c *Client) {
+		if high > 0 {
+			c.laneQueueSz[PriorityHigh.lane()] = high
+		}
+		if low > 0 {
+			c.laneQueueSz[PriorityLow.lane()] = low
+		}
+	}
+}
+
+// scheduler picks lanes by smooth weighted round-robin.
+type scheduler struct {
+	mu      sync.Mutex
+	weights [numLanes]int
+	current [numLanes]int
+}
+
+// pickLane returns the next lane to serve among the non-empty ones, or -1 when
+// all are empty.
+func (c *Client) pickLane() int {
+	s := &c.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	best, total := -1, 0
+	for i, ch := range c.lanes {
+		if len(ch) == 0 {
+			continue
+		}
+		s.current[i] += s.weights[i]
+		total += s.weights[i]
+		if best < 0 || s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	if best >= 0 {
+		s.current[best] -= total
+	}
+	return best
+}
+
+// nextJob returns the next job for a worker, blocking while every lane is
+// empty. It returns false when the worker must stop: on SetWorkers scale
+// down, or once Close has closed the lanes and they are drained.
+func (c *Client) nextJob() (*pushJob, bool) {
+	for {
+		// Scale down is served before queued jobs, so SetWorkers does not
+		// wait for the lanes to drain.
+		select {
+		case <-c.stopWorker:
+			return nil, false
+		default:
+		}
+
+		if i := c.pickLane(); i >= 0 {
+			select {
+			case job, ok := <-c.lanes[i]:
+				if ok {
+					c.laneStats[i].processed.Add(1)
+					return job, true
+				}
+			default:
+				// Taken by another worker.
+			}
+			continue
+		}
+
+		var job *pushJob
+		var ok bool
+		var lane int
+		select {
+		case job, ok = <-c.lanes[0]:
+		case job, ok = <-c.lanes[1]:
+			lane = 1
+		case job, ok = <-c.lanes[2]:
+			lane = 2
+		case <-c.stopWorker:
+			return nil, false
+		}
+		if ok {
+			c.laneStats[lane].processed.Add(1)
+			return job, true
+		}
+		if c.lanesClosed.Load() && c.queueLength() == 0 {
+			return nil, false
+		}
+		// Close is still closing the other lanes, or they hold jobs.
+	}
+}
+
+// queueLength returns the number of jobs waiting in all lanes.
+func (c *Client) queueLength() int {
+	n := 0
+	for _, ch := range c.lanes {
+		n += len(ch)
+	}
+	return n
+}
+
+// laneSnapshot returns the statistics of every lane.
+func (c *Client) laneSnapshot() map[Priority]LaneStats {
+	lanes := make(map[Priority]LaneStats, numLanes)
+	for i, ch := range c.lanes {
+		st := &c.laneStats[i]
+		lanes[PriorityHigh-Priority(i)] = LaneStats{
+			QueueLength: len(ch),
+			Processed:   st.processed.Load(),
+			Overflowed:  st.overflowed.Load(),
+			Dropped:     st.dropped.Load(),
+		}
+	}
+	return lanes
+}
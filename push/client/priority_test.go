@@ -0,0 +1,206 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPriority_WeightedOrder(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{}, 100)
+	ft := &fakeTransport{reply: func(int, *Message) (int, []byte, error) {
+		started <- struct{}{}
+		<-gate
+		return 200, nil, nil
+	}}
+	cli := New(WithTransport(ft), WithWorkers(1), WithPriorityWeights(8, 2, 1))
+	defer cli.Close()
+
+	push := func(class string, p Priority) {
+		t.Helper()
+		if err := cli.AsyncPushJob("http://nms/push", map[string]string{"class": class}, JobOptions{Priority: p}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Hold the worker, then queue routine records ahead of an alarm.
+	push("first", PriorityNormal)
+	<-started
+	for range 6 {
+		push("low", PriorityLow)
+		push("normal", PriorityNormal)
+	}
+	push("high", PriorityHigh)
+
+	st := cli.Stats()
+	if st.QueueLength != 13 || st.Lanes[PriorityLow].QueueLength != 6 || st.Lanes[PriorityHigh].QueueLength != 1 {
+		t.Fatalf("lane stats = %+v", st.Lanes)
+	}
+
+	close(gate)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 14 })
+	var order []string
+	for _, msg := range ft.sent() {
+		var v map[string]string
+		_ = json.Unmarshal(msg.Body, &v)
+		order = append(order, v["class"])
+	}
+	if order[1] != "high" {
+		t.Fatalf("order = %v, want the alarm right after the first record", order)
+	}
+	// Normal records get twice the turns of low ones, and low ones still run.
+	counts := map[string]int{}
+	for _, class := range order[2:8] {
+		counts[class]++
+	}
+	if counts["normal"] != 4 || counts["low"] != 2 {
+		t.Fatalf("order = %v, want 4 normal and 2 low in the next six", order)
+	}
+	if st := cli.Stats(); st.Lanes[PriorityHigh].Processed != 1 || st.Lanes[PriorityLow].Processed != 6 {
+		t.Fatalf("lane stats = %+v", st.Lanes)
+	}
+}
+
+func TestPriority_LanesOverflowSeparately(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{}, 100)
+	ft := &fakeTransport{reply: func(int, *Message) (int, []byte, error) {
+		started <- struct{}{}
+		<-gate
+		return 200, nil, nil
+	}}
+	cli := New(WithTransport(ft), WithWorkers(1), WithQueueSize(1), WithOverflow(OverflowReject))
+	defer cli.Close()
+
+	low := JobOptions{Priority: PriorityLow}
+	if err := cli.AsyncPushJob("http://nms/push", "kpi-1", low); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := cli.AsyncPushJob("http://nms/push", "kpi-2", low); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.AsyncPushJob("http://nms/push", "kpi-3", low); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("low lane full: err = %v, want ErrQueueFull", err)
+	}
+	// A full low lane does not hold back alarms.
+	if err := cli.AsyncPushJob("http://nms/push", "alarm", JobOptions{Priority: PriorityHigh}); err != nil {
+		t.Fatalf("high lane: %v", err)
+	}
+
+	st := cli.Stats()
+	if st.Lanes[PriorityLow].Overflowed != 1 || st.Lanes[PriorityHigh].Overflowed != 0 {
+		t.Fatalf("lane stats = %+v", st.Lanes)
+	}
+	close(gate)
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 3 })
+	if msgs := ft.sent(); string(bytes.TrimSpace(msgs[1].Body)) != `"alarm"` {
+		t.Fatalf("second message = %q, want the alarm", msgs[1].Body)
+	}
+}
+
+func TestPriority_ScaleDownWithQueuedJobs(t *testing.T) {
+	gate := make(chan struct{})
+	started := make(chan struct{}, 100)
+	ft := &fakeTransport{reply: func(int, *Message) (int, []byte, error) {
+		started <- struct{}{}
+		<-gate
+		return 200, nil, nil
+	}}
+	cli := New(WithTransport(ft), WithWorkers(2))
+	defer cli.Close()
+
+	for i := range 50 {
+		if err := cli.AsyncPush("http://nms/push", map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+	<-started
+
+	// Release jobs one at a time: a worker must stop after its current
+	// job instead of once the queue is drained.
+	done := make(chan struct{})
+	go func() {
+		cli.SetWorkers(1)
+		close(done)
+	}()
+	// SetWorkers holds mu while it signals the workers.
+	waitUntil(t, time.Second, func() bool {
+		if cli.mu.TryLock() {
+			cli.mu.Unlock()
+			return false
+		}
+		return true
+	})
+	timeout := time.After(2 * time.Second)
+release:
+	for {
+		select {
+		case <-done:
+			break release
+		case gate <- struct{}{}:
+		case <-timeout:
+			close(gate)
+			t.Fatal("SetWorkers did not return")
+		}
+	}
+	queued := cli.Stats().QueueLength
+	close(gate)
+	if queued == 0 {
+		t.Fatal("queue drained before SetWorkers returned")
+	}
+	waitUntil(t, time.Second, func() bool { return cli.Stats().ActiveWorkers == 1 })
+	waitUntil(t, 2*time.Second, func() bool { return cli.Stats().TotalProcessed == 50 })
+}
+
+func TestPriority_LaneQueueSizes(t *testing.T) {
+	for _, tc := range []struct {
+		opts []Option
+		want [numLanes]int // highest lane first
+	}{
+		{nil, [numLanes]int{1024, 4096, 1024}},
+		{[]Option{WithQueueSize(10)}, [numLanes]int{2, 10, 2}},
+		{[]Option{WithQueueSize(3)}, [numLanes]int{1, 3, 1}},
+		{[]Option{WithQueueSize(100), WithLaneQueueSizes(5, 0)}, [numLanes]int{5, 100, 25}},
+		{[]Option{WithLaneQueueSizes(8, 3), WithQueueSize(100)}, [numLanes]int{8, 100, 3}},
+	} {
+		cli := New(tc.opts...)
+		var got [numLanes]int
+		for i := range cli.lanes {
+			got[i] = cap(cli.lanes[i])
+		}
+		cli.Close()
+		if got != tc.want {
+			t.Errorf("lane capacities = %v, want %v", got, tc.want)
+		}
+	}
+
+	// The low lane queues 2 jobs behind the one in flight.
+	gate := make(chan struct{})
+	started := make(chan struct{}, 100)
+	ft := &fakeTransport{reply: func(int, *Message) (int, []byte, error) {
+		started <- struct{}{}
+		<-gate
+		return 200, nil, nil
+	}}
+	cli := New(WithTransport(ft), WithWorkers(1), WithLaneQueueSizes(0, 2), WithOverflow(OverflowReject))
+	defer cli.Close()
+	defer close(gate)
+
+	low := JobOptions{Priority: PriorityLow}
+	if err := cli.AsyncPushJob("http://nms/push", "kpi-0", low); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	for i := 1; i <= 2; i++ {
+		if err := cli.AsyncPushJob("http://nms/push", "kpi", low); err != nil {
+			t.Fatalf("push %d: %v", i, err)
+		}
+	}
+	if err := cli.AsyncPushJob("http://nms/push", "kpi", low); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("push beyond the lane size: err = %v, want ErrQueueFull", err)
+	}
+}
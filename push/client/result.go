@@ -0,0 +1,220 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultDeadLetterSize = 1000
+
+// Result is the final outcome of an async record.
+//
+// It is reported once per delivery pass: when a durable record fails and
+// stays in the outbox (Retained), its replay reports another Result.
+type Result struct {
+	URL      string        // Destination URL
+	Payload  any           // Payload passed to AsyncPush; nil for records replayed from the outbox
+	Body     []byte        // Encoded JSON body; set for outbox and batched records
+	Seq      uint64        // Outbox sequence number, 0 when not durable
+	Attempts int           // HTTP requests that carried the record, including retries
+	Latency  time.Duration // Time from queuing to completion
+	Status   int           // HTTP status of the last response, 0 when none was received
+	Err      error         // nil when the receiver accepted the record
+	Retained bool          // The failed record stays in the outbox and will be replayed
+}
+
+// JobOptions configures a single async job. See AsyncPushJob.
+type JobOptions struct {
+	// Timeout bounds all attempts of the job. If <= 0, uses the client default.
+	Timeout time.Duration
+
+	// Retry is the number of retries after a failed attempt. Async jobs do
+	// not retry by default. Ignored in batch mode, where batch requests use
+	// the client retry count (WithRetry).
+	Retry int
+
+	// OnResult is called with the outcome of the job, before the handler
+	// set by WithOnResult. It runs on a worker goroutine and must not block.
+	OnResult func(Result)
+
+	// Priority selects the lane the job is queued in. The zero value is
+	// PriorityNormal.
+	Priority Priority
+
+	// Failover, if set, is offered the result of a failed job before it is
+	// settled, on a worker goroutine, and must not block. Returning true
+	// hands the record back to the caller, e.g. to queue it for another
+	// destination: the failure is neither counted nor dead-lettered, a
+	// durable record is removed from the outbox, and the result is not
+	// reported to OnResult or the WithOnResult handler. Failures returned
+	// by the AsyncPush call itself are not offered.
+	Failover func(Result) bool
+}
+
+// DeadLetterSink receives async records that failed permanently: records
+// without an outbox that failed their last attempt, and records the
+// receiver rejected with a final (non-429 4xx) status.
+//
+// Put is called on a worker goroutine and must not block.
+type DeadLetterSink interface {
+	Put(r Result)
+}
+
+// WithOnResult sets a handler called with the outcome of every async
+// record, including records replayed from the outbox. It runs on a worker
+// goroutine and must not block.
+func WithOnResult(fn func(Result)) Option {
+	return func(c *Client) { c.onResult = fn }
+}
+
+// WithDeadLetter sends permanently failed async records to sink.
+//
+// With an outbox, records rejected with a final status are removed from
+// the outbox once they are handed to the sink.
+func WithDeadLetter(sink DeadLetterSink) Option {
+	return func(c *Client) { c.deadLetter = sink }
+}
+
+// settle records the outcome of an async record: it updates counters,
+// acknowledges or releases the outbox record, dead-letters permanent
+// failures, and reports the result. A failed durable record is kept for
+// replay unless final is set. A failure taken over by failover (see
+// JobOptions.Failover) is not settled here.
+func (c *Client) settle(res Result, final bool, onResult func(Result), failover func(Result) bool) {
+	switch {
+	case res.Err == nil:
+		c.totalProcessed.Add(1)
+		if res.Seq != 0 {
+			_ = c.outbox.Ack(res.Seq)
+		}
+	case failover != nil && failover(res):
+		if res.Seq != 0 {
+			_ = c.outbox.Ack(res.Seq)
+		}
+		return
+	case res.Seq != 0 && !final:
+		c.failedCount.Add(1)
+		c.outbox.Release(res.Seq)
+		res.Retained = true
+	default:
+		c.failedCount.Add(1)
+		if res.Seq != 0 {
+			// Retrying cannot succeed: drop the record from the outbox.
+			_ = c.outbox.Ack(res.Seq)
+		}
+		if c.deadLetter != nil {
+			c.deadLettered.Add(1)
+			c.deadLetter.Put(res)
+		}
+	}
+	c.report(res, onResult)
+}
+
+// report passes a result to the per-job callback and the client handler.
+func (c *Client) report(res Result, onResult func(Result)) {
+	if onResult != nil {
+		onResult(res)
+	}
+	if c.onResult != nil {
+		c.onResult(res)
+	}
+}
+
+// isFinalStatus reports whether a receiver status rules out any retry.
+func isFinalStatus(status int) bool {
+	return status >= 400 && !isRetryableStatus(status)
+}
+
+// DeadLetterQueue is an in-memory DeadLetterSink holding the most recent
+// permanently failed records. When full, the oldest record is dropped.
+// Thread-safe.
+//
+// Example:
+//
+//	dlq := client.NewDeadLetterQueue(1000)
+//	cli := client.New(client.WithDeadLetter(dlq))
+//
+//	for _, r := range dlq.Items() {
+//	    log.Printf("lost %s: %v", r.URL, r.Err)
+//	}
+//	n, err := dlq.Redrive(cli) // after the receiver is fixed
+type DeadLetterQueue struct {
+	max int
+
+	mu      sync.Mutex
+	items   []Result
+	dropped int64
+}
+
+// NewDeadLetterQueue creates a queue holding up to max records.
+// If max <= 0, defaults to 1000.
+func NewDeadLetterQueue(max int) *DeadLetterQueue {
+	if max <= 0 {
+		max = defaultDeadLetterSize
+	}
+	return &DeadLetterQueue{max: max}
+}
+
+// Put implements DeadLetterSink.
+func (q *DeadLetterQueue) Put(r Result) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= q.max {
+		q.items[0] = Result{}
+		q.items = q.items[1:]
+		q.dropped++
+	}
+	q.items = append(q.items, r)
+}
+
+// Items returns the queued records, oldest first.
+func (q *DeadLetterQueue) Items() []Result {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Result(nil), q.items...)
+}
+
+// Len returns the number of queued records.
+func (q *DeadLetterQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Dropped returns the number of records dropped because the queue was full.
+func (q *DeadLetterQueue) Dropped() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
+
+// Redrive removes all queued records and submits them to cli again with
+// AsyncPushJob and the client default timeout. Records that cannot be
+// submitted are put back. Returns the number of records submitted.
+//
+// Records that fail again are delivered to cli's dead-letter sink as usual.
+func (q *DeadLetterQueue) Redrive(cli *Client) (int, error) {
+	q.mu.Lock()
+	items := q.items
+	q.items = nil
+	q.mu.Unlock()
+
+	var errs []error
+	n := 0
+	for _, r := range items {
+		payload := r.Payload
+		if payload == nil {
+			payload = json.RawMessage(r.Body)
+		}
+		if err := cli.AsyncPushJob(r.URL, payload, JobOptions{}); err != nil {
+			q.Put(r)
+			errs = append(errs, fmt.Errorf("%s: %w", r.URL, err))
+			continue
+		}
+		n++
+	}
+	return n, errors.Join(errs...)
+}
@@ -0,0 +1,208 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push/outbox"
+)
+
+// resultLog collects reported results.
+type resultLog struct {
+	mu  sync.Mutex
+	all []Result
+}
+
+func (l *resultLog) add(r Result) {
+	l.mu.Lock()
+	l.all = append(l.all, r)
+	l.mu.Unlock()
+}
+
+func (l *resultLog) get() []Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Result(nil), l.all...)
+}
+
+func TestResult_ReportsOutcomeAndAttempts(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	var perJob, global resultLog
+	cli := New(WithWorkers(1), WithRetryPolicy(&recordingPolicy{}), WithOnResult(global.add))
+	defer cli.Close()
+
+	payload := map[string]string{"alarm_id": "a-1"}
+	if err := cli.AsyncPushJob(srv.URL, payload, JobOptions{Retry: 2, OnResult: perJob.add}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, time.Second, func() bool { return len(global.get()) == 1 })
+
+	res := perJob.get()
+	if len(res) != 1 {
+		t.Fatalf("per-job results = %d, want 1", len(res))
+	}
+	r := res[0]
+	if r.Err != nil || r.Status != http.StatusAccepted || r.Attempts != 3 || r.URL != srv.URL || r.Latency <= 0 {
+		t.Fatalf("result = %+v", r)
+	}
+	if got := r.Payload.(map[string]string)["alarm_id"]; got != "a-1" {
+		t.Fatalf("result payload = %v, want the queued payload", r.Payload)
+	}
+}
+
+func TestResult_DeadLetterAndRedrive(t *testing.T) {
+	recv, srv := newTestReceiver(t, http.StatusBadRequest)
+	dlq := NewDeadLetterQueue(10)
+	var results resultLog
+	cli := New(WithWorkers(1), WithDeadLetter(dlq), WithOnResult(results.add))
+	defer cli.Close()
+
+	for i := range 2 {
+		if err := cli.AsyncPush(srv.URL, map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, time.Second, func() bool { return dlq.Len() == 2 })
+	for _, r := range dlq.Items() {
+		if r.Status != http.StatusBadRequest || StatusCode(r.Err) != http.StatusBadRequest || r.Retained {
+			t.Fatalf("dead letter = %+v", r)
+		}
+	}
+	if n := cli.Stats().DeadLettered; n != 2 {
+		t.Fatalf("DeadLettered = %d, want 2", n)
+	}
+
+	recv.status.Store(http.StatusOK)
+	n, err := dlq.Redrive(cli)
+	if err != nil || n != 2 {
+		t.Fatalf("Redrive = %d, %v; want 2", n, err)
+	}
+	waitUntil(t, time.Second, func() bool { return len(recv.received()) == 2 })
+	if dlq.Len() != 0 {
+		t.Fatalf("dead letters after redrive = %d", dlq.Len())
+	}
+	waitUntil(t, time.Second, func() bool { return len(results.get()) == 4 })
+}
+
+func TestResult_FailoverTakesOverFailure(t *testing.T) {
+	_, srv := newTestReceiver(t, http.StatusBadRequest)
+	dlq := NewDeadLetterQueue(10)
+	var perJob, global, handed resultLog
+	cli := New(WithWorkers(1), WithDeadLetter(dlq), WithOnResult(global.add))
+	defer cli.Close()
+
+	// The first job is taken over, the second declined and settled.
+	for _, take := range []bool{true, false} {
+		err := cli.AsyncPushJob(srv.URL, map[string]bool{"take": take}, JobOptions{
+			OnResult: perJob.add,
+			Failover: func(r Result) bool {
+				handed.add(r)
+				return take
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, time.Second, func() bool { return len(global.get()) == 1 })
+
+	if n := len(handed.get()); n != 2 {
+		t.Fatalf("failover calls = %d, want 2", n)
+	}
+	res := perJob.get()
+	if len(res) != 1 || res[0].Payload.(map[string]bool)["take"] {
+		t.Fatalf("per-job results = %+v, want only the declined job", res)
+	}
+	if st := cli.Stats(); dlq.Len() != 1 || st.FailedCount != 1 {
+		t.Fatalf("dead letters = %d, FailedCount = %d; want 1, 1", dlq.Len(), st.FailedCount)
+	}
+}
+
+func TestResult_DurableFinalRejectionLeavesOutbox(t *testing.T) {
+	recv, srv := newTestReceiver(t, http.StatusServiceUnavailable)
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+
+	dlq := NewDeadLetterQueue(10)
+	var results resultLog
+	cli := New(WithOutbox(ob), WithWorkers(1), WithReplayInterval(time.Hour), WithDeadLetter(dlq))
+	defer cli.Close()
+
+	// 503: retained in the outbox for replay
+	if err := cli.AsyncPushJob(srv.URL, map[string]int{"n": 1}, JobOptions{OnResult: results.add}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, time.Second, func() bool { return len(results.get()) == 1 })
+	if r := results.get()[0]; !r.Retained || r.Seq == 0 || string(r.Body) != `{"n":1}` {
+		t.Fatalf("result = %+v, want retained", r)
+	}
+	if ob.Pending() != 1 || dlq.Len() != 0 {
+		t.Fatalf("pending = %d, dead letters = %d; want 1, 0", ob.Pending(), dlq.Len())
+	}
+
+	// 400: final, moved from the outbox to the dead-letter queue
+	recv.status.Store(http.StatusBadRequest)
+	if err := cli.AsyncPushJob(srv.URL, map[string]int{"n": 2}, JobOptions{OnResult: results.add}); err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, time.Second, func() bool { return len(results.get()) == 2 })
+	if r := results.get()[1]; r.Retained || r.Status != http.StatusBadRequest {
+		t.Fatalf("result = %+v, want final rejection", r)
+	}
+	if ob.Pending() != 1 || dlq.Len() != 1 {
+		t.Fatalf("pending = %d, dead letters = %d; want 1, 1", ob.Pending(), dlq.Len())
+	}
+}
+
+func TestResult_BatchRejectionCarriesCode(t *testing.T) {
+	_, srv := newBatchReceiver(t, func(batch []int) *BatchResult {
+		return &BatchResult{Accepted: len(batch) - 1, Rejected: []BatchRejection{{Index: 1, Code: 422, Msg: "bad ne_uid"}}}
+	})
+	dlq := NewDeadLetterQueue(10)
+	var results resultLog
+	cli := New(WithWorkers(1), WithDeadLetter(dlq), WithOnResult(results.add),
+		WithBatch(BatchConfig{MaxRecords: 3, Linger: time.Second}))
+	defer cli.Close()
+
+	for i := range 3 {
+		if err := cli.AsyncPush(srv.URL, batchRecord{N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, time.Second, func() bool { return len(results.get()) == 3 })
+
+	items := dlq.Items()
+	if len(items) != 1 || string(items[0].Body) != `{"n":1}` || items[0].Status != 422 || items[0].Attempts != 1 {
+		t.Fatalf("dead letters = %+v", items)
+	}
+	if err := items[0].Err; err == nil || err.Error() != "http 422: bad ne_uid" {
+		t.Fatalf("dead letter error = %v", err)
+	}
+}
+
+func TestDeadLetterQueue_DropsOldest(t *testing.T) {
+	q := NewDeadLetterQueue(2)
+	for _, u := range []string{"a", "b", "c"} {
+		q.Put(Result{URL: u})
+	}
+	items := q.Items()
+	if len(items) != 2 || items[0].URL != "b" || items[1].URL != "c" || q.Dropped() != 1 {
+		t.Fatalf("items = %+v, dropped = %d", items, q.Dropped())
+	}
+}
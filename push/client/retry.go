@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed attempt is retried.
+//
+// Next is called after each failed attempt with the number of attempts
+// made so far (starting at 1), the HTTP status of the response (0 when no
+// response was received), and the attempt error. It returns the delay
+// before the next attempt and whether to retry at all. The retry count set
+// by WithRetry and the operation timeout still bound the total attempts.
+//
+// Implementations must be safe for concurrent use.
+type RetryPolicy interface {
+	Next(attempt, status int, err error) (delay time.Duration, retry bool)
+}
+
+// ExponentialBackoff returns the default RetryPolicy.
+//
+// It retries errors accepted by Retryable. The delay starts at initial,
+// doubles per attempt up to max, and adds up to 25% random jitter. When
+// the receiver sent a Retry-After header, that delay is used instead.
+// Non-positive values default to 100ms and 30s.
+func ExponentialBackoff(initial, max time.Duration) RetryPolicy {
+	if initial <= 0 {
+		initial = defaultInitDelay
+	}
+	if max <= 0 {
+		max = defaultMaxDelay
+	}
+	return &exponentialBackoff{initial: initial, max: max}
+}
+
+type exponentialBackoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+// Next implements RetryPolicy.
+func (b *exponentialBackoff) Next(attempt, status int, err error) (time.Duration, bool) {
+	if !Retryable(status, err) {
+		return 0, false
+	}
+	if d := RetryAfter(err); d > 0 {
+		return d, true
+	}
+
+	delay := b.max
+	if shift := attempt - 1; shift < 32 {
+		if d := b.initial << uint(shift); d > 0 && d < b.max {
+			delay = d
+		}
+	}
+	jitter := time.Duration(rand.Int64N(int64(delay/2) + 1))
+	return delay + jitter/2, true
+}
+
+// Retryable reports whether an attempt that failed with status and err is
+// worth retrying.
+//
+// Retryable: 429 and 5xx responses, network timeouts, refused or reset
+// connections, connections closed mid-response, and temporary DNS
+// failures. Not retryable: other statuses, caller cancellation, an
+// exhausted operation deadline, open circuits, TLS certificate errors, and
+// anything unrecognized.
+func Retryable(status int, err error) bool {
+	if status != 0 {
+		return isRetryableStatus(status)
+	}
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+
+	var certErr *x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &hostErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// The receiver closed a kept-alive connection before answering.
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// RetryAfter returns the delay requested by the receiver's Retry-After
+// header for err, or 0 when err carries none.
+func RetryAfter(err error) time.Duration {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryAfter
+	}
+	return 0
+}
+
+// StatusCode returns the HTTP status of the response that caused err, or 0
+// when err was not caused by an error response.
+func StatusCode(err error) int {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.statusCode
+	}
+	return 0
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// parseRetryAfter parses a Retry-After value in delay-seconds or HTTP-date
+// form. Invalid and past values yield 0.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// WithRetryPolicy sets the policy that classifies failures and computes
+// retry delays. If not set, defaults to ExponentialBackoff(100ms, 30s).
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *Client) {
+		if p != nil {
+			c.retryPolicy = p
+		}
+	}
+}
+
+// WithRetryBudget caps retries across the whole Client at perSecond on
+// average, allowing bursts of up to burst retries.
+//
+// When the budget is exhausted, failing operations return their last error
+// instead of retrying, so an outage cannot multiply the request rate. First
+// attempts are never limited. If burst <= 0, it defaults to perSecond
+// rounded up (at least 1).
+func WithRetryBudget(perSecond float64, burst int) Option {
+	return func(c *Client) {
+		if perSecond <= 0 {
+			return
+		}
+		if burst <= 0 {
+			burst = max(1, int(perSecond+0.999))
+		}
+		c.retryBudget = &tokenBucket{
+			rate:   perSecond,
+			burst:  float64(burst),
+			tokens: float64(burst),
+			last:   time.Now(),
+			now:    time.Now,
+		}
+	}
+}
+
+// tokenBucket is a retry budget refilled at rate tokens per second.
+type tokenBucket struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// take consumes one token and reports whether one was available.
+func (b *tokenBucket) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
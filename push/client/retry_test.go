@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	refused := &url.Error{Op: "Post", URL: "http://nms", Err: &net.OpError{
+		Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}}
+	tests := []struct {
+		name   string
+		status int
+		err    error
+		want   bool
+	}{
+		{"429", http.StatusTooManyRequests, &httpStatusError{statusCode: 429}, true},
+		{"503", http.StatusServiceUnavailable, &httpStatusError{statusCode: 503}, true},
+		{"400", http.StatusBadRequest, &httpStatusError{statusCode: 400}, false},
+		{"connection refused", 0, fmt.Errorf("request failed: %w", refused), true},
+		{"connection reset", 0, fmt.Errorf("request failed: %w", syscall.ECONNRESET), true},
+		{"closed mid-response", 0, &url.Error{Op: "Post", URL: "http://nms", Err: io.EOF}, true},
+		{"dns timeout", 0, &net.DNSError{Err: "timeout", Name: "nms", IsTimeout: true}, true},
+		{"dns not found", 0, &net.DNSError{Err: "no such host", Name: "nms", IsNotFound: true}, false},
+		{"unknown CA", 0, &url.Error{Op: "Post", URL: "https://nms", Err: &x509.UnknownAuthorityError{}}, false},
+		{"canceled", 0, fmt.Errorf("request failed: %w", context.Canceled), false},
+		{"deadline", 0, context.DeadlineExceeded, false},
+		{"circuit open", 0, ErrCircuitOpen, false},
+		// Error text alone no longer makes an error retryable
+		{"timeout text", 0, errors.New("upstream timeout"), false},
+	}
+	for _, tt := range tests {
+		if got := Retryable(tt.status, tt.err); got != tt.want {
+			t.Errorf("%s: Retryable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := map[string]time.Duration{
+		"":     0,
+		"7":    7 * time.Second,
+		"0":    0,
+		"-3":   0,
+		"soon": 0,
+		now.Add(90 * time.Second).Format(http.TimeFormat): 90 * time.Second,
+		now.Add(-time.Minute).Format(http.TimeFormat):     0,
+	}
+	for in, want := range tests {
+		if got := parseRetryAfter(in, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	p := ExponentialBackoff(100*time.Millisecond, time.Second)
+	for attempt, base := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		3:  400 * time.Millisecond,
+		10: time.Second,
+		64: time.Second,
+	} {
+		d, ok := p.Next(attempt, 503, &httpStatusError{statusCode: 503})
+		if !ok || d < base || d > base+base/4 {
+			t.Errorf("attempt %d: delay = %v, %v; want [%v, %v]", attempt, d, ok, base, base+base/4)
+		}
+	}
+
+	// Retry-After overrides the computed delay
+	err := &httpStatusError{statusCode: 429, retryAfter: 5 * time.Second}
+	if d, ok := p.Next(1, 429, err); !ok || d != 5*time.Second {
+		t.Fatalf("Retry-After delay = %v, %v; want 5s", d, ok)
+	}
+	if _, ok := p.Next(1, 400, &httpStatusError{statusCode: 400}); ok {
+		t.Fatal("400 retried")
+	}
+}
+
+// recordingPolicy retries everything immediately and records its inputs.
+type recordingPolicy struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (p *recordingPolicy) Next(attempt, status int, err error) (time.Duration, bool) {
+	p.mu.Lock()
+	p.calls = append(p.calls, fmt.Sprintf("%d/%d/%v", attempt, status, RetryAfter(err)))
+	p.mu.Unlock()
+	return time.Millisecond, true
+}
+
+func TestRetry_PolicySeesStatusAndRetryAfter(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) < 3 {
+			w.Header().Set("Retry-After", "2")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	policy := &recordingPolicy{}
+	cli := New(WithWorkers(1), WithRetry(5), WithRetryPolicy(policy))
+	defer cli.Close()
+
+	if err := cli.Push(srv.URL, "x"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1/429/2s", "2/429/2s"}
+	if fmt.Sprint(policy.calls) != fmt.Sprint(want) {
+		t.Fatalf("policy calls = %v, want %v", policy.calls, want)
+	}
+	if n := cli.Stats().Retries; n != 2 {
+		t.Fatalf("Retries = %d, want 2", n)
+	}
+}
+
+func TestRetry_RetryAfterBeyondTimeoutFailsEarly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cli := New(WithWorkers(1), WithRetry(3))
+	defer cli.Close()
+
+	start := time.Now()
+	err := cli.PushTimeout(srv.URL, "x", 2*time.Second)
+	if StatusCode(err) != http.StatusServiceUnavailable || RetryAfter(err) != time.Minute {
+		t.Fatalf("err = %v, want http 503 with Retry-After", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("waited %v for a retry that could not fit the timeout", elapsed)
+	}
+}
+
+func TestRetry_BudgetLimitsRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cli := New(
+		WithWorkers(1),
+		WithRetry(5),
+		WithRetryPolicy(&recordingPolicy{}),
+		WithRetryBudget(0.001, 2),
+	)
+	defer cli.Close()
+
+	for range 2 {
+		if err := cli.Push(srv.URL, "x"); err == nil {
+			t.Fatal("push to failing receiver succeeded")
+		}
+	}
+	// First push: 1 attempt + 2 budgeted retries; second push: 1 attempt.
+	stats := cli.Stats()
+	if n := hits.Load(); n != 4 || stats.Retries != 2 || stats.RetriesDenied != 2 {
+		t.Fatalf("hits = %d, stats = %+v; want 4 hits, 2 retries, 2 denied", n, stats)
+	}
+}
+
+func TestTokenBucket_Refills(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := &tokenBucket{rate: 2, burst: 2, tokens: 2, last: now, now: func() time.Time { return now }}
+	if !b.take() || !b.take() || b.take() {
+		t.Fatal("burst not enforced")
+	}
+	now = now.Add(500 * time.Millisecond)
+	if !b.take() || b.take() {
+		t.Fatal("refill after 500ms at 2/s should allow exactly one")
+	}
+	now = now.Add(time.Hour)
+	if !b.take() || !b.take() || b.take() {
+		t.Fatal("refill not capped at burst")
+	}
+}
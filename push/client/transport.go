@@ -0,0 +1,65 @@
+package client
+
+import "context"
+
+// Message is one request handed to a Transport: a single encoded record or
+// a batch of records.
+type Message struct {
+	URL         string // Destination URL; non-HTTP transports use its scheme and host
+	Key         string // Idempotency key of a single record, "" when none
+	ContentType string // ContentTypeJSON or ContentTypeNDJSON
+	Body        []byte // Encoded JSON record or batch; must not be modified
+
+	wantBody bool // The caller reads the response body (batch results)
+}
+
+// Transport delivers messages for a Client.
+//
+// Send makes one attempt. It returns the receiver's HTTP-like status code
+// (0 when the transport receives no reply) and the reply body, which for a
+// batch may be a BatchResult. A receiver rejection should be returned as
+// a StatusError, whose code is used when status is 0, so that retries,
+// circuit breaking, and dead-lettering classify it like an HTTP response;
+// connection errors are returned as is and retried according to Retryable.
+//
+// The retry loop, async queue, outbox, batching, circuit breaker, and
+// statistics of the Client apply to every transport. Compression, auth,
+// and TLS options apply only to the default HTTP transport.
+//
+// Implementations must be safe for concurrent use. Client.Close closes
+// the transport after pending jobs are done.
+type Transport interface {
+	Send(ctx context.Context, msg *Message) (status int, reply []byte, err error)
+	Close() error
+}
+
+// WithTransport replaces the default HTTP transport. See push/transport
+// for WebSocket, TCP, and syslog transports.
+func WithTransport(t Transport) Option {
+	return func(c *Client) {
+		if t != nil {
+			c.transport = t
+		}
+	}
+}
+
+// StatusError returns an error reporting that the receiver rejected a
+// message with an HTTP-like status code. StatusCode returns code for it.
+func StatusError(code int, msg string) error {
+	return &httpStatusError{statusCode: code, body: msg}
+}
+
+// httpTransport is the default Transport: an HTTP POST per message.
+type httpTransport struct {
+	c *Client
+}
+
+// Send implements Transport.
+func (t httpTransport) Send(ctx context.Context, msg *Message) (int, []byte, error) {
+	return t.c.sendRequest(ctx, msg.URL, msg.Key, msg.ContentType, msg.Body, msg.wantBody, false)
+}
+
+// Close implements Transport. Pooled connections are kept for reuse.
+func (t httpTransport) Close() error {
+	return nil
+}
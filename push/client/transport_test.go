@@ -0,0 +1,105 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport answers messages with scripted replies and records them.
+type fakeTransport struct {
+	mu     sync.Mutex
+	msgs   []Message
+	reply  func(n int, msg *Message) (int, []byte, error)
+	closed bool
+}
+
+func (f *fakeTransport) Send(_ context.Context, msg *Message) (int, []byte, error) {
+	m := *msg
+	m.Body = bytes.Clone(msg.Body) // msg.Body may be a pooled buffer
+	f.mu.Lock()
+	f.msgs = append(f.msgs, m)
+	n := len(f.msgs)
+	f.mu.Unlock()
+	return f.reply(n, msg)
+}
+
+func (f *fakeTransport) Close() error {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeTransport) sent() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.msgs...)
+}
+
+func TestTransport_RetriesAndClassifiesStatus(t *testing.T) {
+	ft := &fakeTransport{reply: func(n int, msg *Message) (int, []byte, error) {
+		switch {
+		case msg.URL == "tcp://reject:1":
+			return 0, nil, StatusError(422, "bad record")
+		case n < 3:
+			return 0, nil, StatusError(503, "busy")
+		}
+		return 0, nil, nil
+	}}
+	dlq := NewDeadLetterQueue(10)
+	cli := New(WithTransport(ft), WithRetry(3), WithRetryPolicy(ExponentialBackoff(time.Millisecond, time.Millisecond)), WithDeadLetter(dlq), WithWorkers(1))
+
+	if err := cli.Push("tcp://nms:6000", keyedPayload{ID: "r-1"}); err != nil {
+		t.Fatal(err)
+	}
+	msgs := ft.sent()
+	if len(msgs) != 3 || msgs[2].Key != "r-1" || msgs[2].ContentType != ContentTypeJSON || string(msgs[2].Body) != `{"id":"r-1"}` {
+		t.Fatalf("messages = %+v", msgs)
+	}
+
+	err := cli.AsyncPushJob("tcp://reject:1", keyedPayload{ID: "r-2"}, JobOptions{Retry: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitUntil(t, time.Second, func() bool { return dlq.Len() == 1 })
+	if r := dlq.Items()[0]; r.Status != 422 || r.Attempts != 1 {
+		t.Fatalf("dead letter = %+v, want one attempt rejected with 422", r)
+	}
+
+	cli.Close()
+	if !ft.closed {
+		t.Fatal("transport not closed by Client.Close")
+	}
+}
+
+func TestTransport_BatchReply(t *testing.T) {
+	ft := &fakeTransport{reply: func(_ int, msg *Message) (int, []byte, error) {
+		if msg.ContentType != ContentTypeNDJSON {
+			return 0, nil, errors.New("want NDJSON")
+		}
+		return 200, []byte(`{"accepted":1,"rejected":[{"index":1,"code":400,"msg":"bad"}]}`), nil
+	}}
+	var results resultLog
+	cli := New(WithTransport(ft), WithBatch(BatchConfig{MaxRecords: 2, Format: BatchNDJSON}), WithOnResult(results.add))
+	defer cli.Close()
+
+	for i := range 2 {
+		if err := cli.AsyncPush("ws://nms/ws", map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitUntil(t, time.Second, func() bool { return len(results.get()) == 2 })
+	var rejected int
+	for _, r := range results.get() {
+		if r.Err != nil {
+			rejected++
+		}
+	}
+	if rejected != 1 || len(ft.sent()) != 1 {
+		t.Fatalf("rejected = %d, messages = %d; want 1 rejected record in 1 message", rejected, len(ft.sent()))
+	}
+}
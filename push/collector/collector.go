@@ -0,0 +1,372 @@
+// Package collector runs named, periodic sample collectors and sends their
+// samples through one push.Push.
+//
+// Each collector has its own interval, jitter, timeout, and record type.
+// Runs of one collector never overlap: a tick that comes while the previous
+// sample is still being collected is skipped. Every sample becomes a
+// push.Record sent with SendAsync, so all collectors share the queue,
+// retries, outbox, and statistics of the Push. Status reports the health
+// and last error of each collector.
+//
+// Example:
+//
+//	s := collector.New(p, collector.WithNeUID("ne-001"))
+//	s.Register(collector.Config{
+//	    Name:       "cpu_mem",
+//	    RecordType: "cpu_mem",
+//	    Interval:   10 * time.Second,
+//	    Jitter:     time.Second,
+//	    Collect:    collector.CPUMemUsage(time.Second),
+//	})
+//	s.Start()
+//	defer s.Stop()
+package collector
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/tsmask/go-oam/push"
+)
+
+// ErrDuplicate reports that a collector with the same name is registered.
+var ErrDuplicate = errors.New("collector already registered")
+
+// Func collects one sample. The sample is encoded as the RecordData of the
+// record sent; a nil sample sends nothing. Func should return when ctx is
+// done; a Func that does not is abandoned and its collector skips ticks
+// until it returns.
+type Func func(ctx context.Context) (any, error)
+
+// Config describes a collector.
+type Config struct {
+	Name       string        // Unique collector name
+	RecordType string        // RecordType of the records sent
+	Interval   time.Duration // Time between runs, must be > 0
+	Jitter     time.Duration // Random delay in [0, Jitter) added to each run
+	Timeout    time.Duration // Bounds each Collect call; if <= 0, uses Interval
+	Collect    Func
+
+	// Params overrides the scheduler's send parameters, e.g. to set a
+	// priority or URL for this collector only.
+	Params *push.SendParams
+}
+
+// Status reports the health of a collector.
+type Status struct {
+	Name       string
+	RecordType string
+
+	Runs     uint64 // Completed runs
+	Failures uint64 // Runs whose Collect or SendAsync failed
+	Skipped  uint64 // Ticks skipped because the previous run was still collecting or overran
+
+	ConsecutiveFailures int           // Failed runs since the last success
+	LastRun             time.Time     // Start of the last completed run
+	LastSuccess         time.Time     // Start of the last successful run
+	LastDuration        time.Duration // Duration of the last completed run
+	LastError           error         // Error of the last failed run, nil after a success
+}
+
+// Healthy reports whether the last run succeeded. A collector that has not
+// run yet is healthy.
+func (s Status) Healthy() bool {
+	return s.ConsecutiveFailures == 0
+}
+
+// Option configures a Scheduler.
+type Option func(*Scheduler)
+
+// WithNeUID sets the NeUID of every record sent.
+func WithNeUID(id string) Option {
+	return func(s *Scheduler) { s.neUID = id }
+}
+
+// WithCoreUID sets the CoreUID of every record sent.
+func WithCoreUID(id string) Option {
+	return func(s *Scheduler) { s.coreUID = id }
+}
+
+// WithSendParams sets the SendAsync parameters of collectors without
+// their own Config.Params.
+func WithSendParams(params *push.SendParams) Option {
+	return func(s *Scheduler) { s.params = params }
+}
+
+// Scheduler runs registered collectors. Safe for concurrent use.
+type Scheduler struct {
+	push    *push.Push
+	neUID   string
+	coreUID string
+	params  *push.SendParams
+
+	mu         sync.Mutex
+	collectors map[string]*collector
+	ctx        context.Context // Canceled by Stop, nil before Start
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// collector is a registered collector and its state.
+type collector struct {
+	cfg  Config
+	stop chan struct{}
+	busy chan struct{} // Holds a token while Collect runs
+
+	mu     sync.Mutex
+	status Status
+}
+
+// New creates a stopped Scheduler that sends through p.
+func New(p *push.Push, opts ...Option) *Scheduler {
+	s := &Scheduler{
+		push:       p,
+		collectors: make(map[string]*collector),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Register adds a collector. If the scheduler is running, the collector
+// starts at once. Returns ErrDuplicate if the name is taken.
+func (s *Scheduler) Register(cfg Config) error {
+	switch {
+	case cfg.Name == "":
+		return errors.New("collector name is empty")
+	case cfg.RecordType == "":
+		return fmt.Errorf("collector %q: record type is empty", cfg.Name)
+	case cfg.Interval <= 0:
+		return fmt.Errorf("collector %q: interval must be positive", cfg.Name)
+	case cfg.Jitter < 0:
+		return fmt.Errorf("collector %q: jitter must not be negative", cfg.Name)
+	case cfg.Collect == nil:
+		return fmt.Errorf("collector %q: Collect is nil", cfg.Name)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = cfg.Interval
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.collectors[cfg.Name]; ok {
+		return fmt.Errorf("collector %q: %w", cfg.Name, ErrDuplicate)
+	}
+	c := &collector{
+		cfg:    cfg,
+		busy:   make(chan struct{}, 1),
+		status: Status{Name: cfg.Name, RecordType: cfg.RecordType},
+	}
+	s.collectors[cfg.Name] = c
+	if s.ctx != nil {
+		s.startLocked(c)
+	}
+	return nil
+}
+
+// Unregister stops and removes a collector, reporting whether it existed.
+// A run in progress completes.
+func (s *Scheduler) Unregister(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.collectors[name]
+	if !ok {
+		return false
+	}
+	delete(s.collectors, name)
+	if c.stop != nil {
+		close(c.stop)
+	}
+	return true
+}
+
+// Start runs every registered collector. The first run of each happens
+// after its jitter. Calling Start on a running Scheduler has no effect.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ctx != nil {
+		return
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, c := range s.collectors {
+		s.startLocked(c)
+	}
+}
+
+// Stop stops every collector and waits for runs in progress to finish
+// sending. Collect calls that ignore their context are abandoned. The
+// Scheduler can be started again.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if s.ctx == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.cancel()
+	s.ctx, s.cancel = nil, nil
+	for _, c := range s.collectors {
+		close(c.stop)
+		c.stop = nil
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Status returns the status of the named collector.
+func (s *Scheduler) Status(name string) (Status, bool) {
+	s.mu.Lock()
+	c, ok := s.collectors[name]
+	s.mu.Unlock()
+	if !ok {
+		return Status{}, false
+	}
+	return c.snapshot(), true
+}
+
+// Statuses returns the status of every collector, sorted by name.
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	list := make([]Status, 0, len(s.collectors))
+	for _, c := range s.collectors {
+		list = append(list, c.snapshot())
+	}
+	s.mu.Unlock()
+	slices.SortFunc(list, func(a, b Status) int { return cmp.Compare(a.Name, b.Name) })
+	return list
+}
+
+// startLocked starts the loop of c. The caller holds s.mu.
+func (s *Scheduler) startLocked(c *collector) {
+	c.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.loop(s.ctx, c, c.stop)
+}
+
+// loop runs c at a fixed rate until stop is closed. Ticks missed while a
+// run overran are skipped rather than run back to back.
+func (s *Scheduler) loop(ctx context.Context, c *collector, stop chan struct{}) {
+	defer s.wg.Done()
+	next := time.Now()
+	timer := time.NewTimer(c.jitter())
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case c.busy <- struct{}{}:
+			s.run(ctx, c)
+		default:
+			// The abandoned Collect of an earlier run is still going.
+			c.skip(1)
+		}
+
+		next = next.Add(c.cfg.Interval)
+		if now := time.Now(); !next.After(now) {
+			missed := now.Sub(next)/c.cfg.Interval + 1
+			c.skip(uint64(missed))
+			next = next.Add(missed * c.cfg.Interval)
+		}
+		timer.Reset(time.Until(next) + c.jitter())
+	}
+}
+
+// run collects one sample and sends it. The caller has put a token in
+// c.busy, which is taken back when Collect returns.
+func (s *Scheduler) run(ctx context.Context, c *collector) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	type sample struct {
+		data any
+		err  error
+	}
+	done := make(chan sample, 1)
+	go func() {
+		defer func() { <-c.busy }()
+		data, err := c.cfg.Collect(ctx)
+		done <- sample{data, err}
+	}()
+
+	var smp sample
+	select {
+	case smp = <-done:
+	case <-ctx.Done():
+		smp.err = ctx.Err()
+	}
+	err := smp.err
+	if err != nil {
+		err = fmt.Errorf("collect %s: %w", c.cfg.Name, err)
+	} else if smp.data != nil {
+		err = s.send(c, smp.data)
+	}
+	c.record(start, time.Since(start), err)
+}
+
+// send sends a sample as a record of the collector's type.
+func (s *Scheduler) send(c *collector, data any) error {
+	rec, err := push.NewRecord(c.cfg.RecordType, s.neUID, data)
+	if err != nil {
+		return err
+	}
+	rec.CoreUID = s.coreUID
+	params := c.cfg.Params
+	if params == nil {
+		params = s.params
+	}
+	if err := s.push.SendAsync(rec, params); err != nil {
+		return fmt.Errorf("send %s: %w", c.cfg.Name, err)
+	}
+	return nil
+}
+
+// jitter returns a random delay in [0, Jitter).
+func (c *collector) jitter() time.Duration {
+	if c.cfg.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(c.cfg.Jitter)
+}
+
+func (c *collector) skip(n uint64) {
+	c.mu.Lock()
+	c.status.Skipped += n
+	c.mu.Unlock()
+}
+
+// record updates the status after a run.
+func (c *collector) record(start time.Time, d time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := &c.status
+	st.Runs++
+	st.LastRun = start
+	st.LastDuration = d
+	st.LastError = err
+	if err != nil {
+		st.Failures++
+		st.ConsecutiveFailures++
+		return
+	}
+	st.ConsecutiveFailures = 0
+	st.LastSuccess = start
+}
+
+func (c *collector) snapshot() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
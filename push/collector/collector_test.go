@@ -0,0 +1,157 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push"
+	"github.com/tsmask/go-oam/push/client"
+)
+
+// sink collects the records sent to it.
+type sink struct {
+	mu   sync.Mutex
+	recs []push.Record
+}
+
+func newSink(t *testing.T) (*sink, *push.Push) {
+	t.Helper()
+	s := &sink{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec push.Record
+		if err := json.NewDecoder(r.Body).Decode(&rec); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.recs = append(s.recs, rec)
+		s.mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+	p := push.New(push.WithBaseURL(srv.URL), push.WithPushURI("/"))
+	t.Cleanup(p.Close)
+	return s, p
+}
+
+func (s *sink) byType(recordType string) []push.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []push.Record
+	for _, rec := range s.recs {
+		if rec.RecordType == recordType {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func waitUntil(t *testing.T, d time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(d)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met within %v", d)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduler_SendsAndReportsHealth(t *testing.T) {
+	snk, p := newSink(t)
+	s := New(p, WithNeUID("ne-001"), WithCoreUID("core-1"),
+		WithSendParams(&push.SendParams{Priority: client.PriorityLow}))
+
+	var n atomic.Int64
+	if err := s.Register(Config{
+		Name:       "counter",
+		RecordType: "kpi",
+		Interval:   20 * time.Millisecond,
+		Jitter:     5 * time.Millisecond,
+		Collect: func(context.Context) (any, error) {
+			return map[string]int64{"n": n.Add(1)}, nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	failing := errors.New("probe down")
+	if err := s.Register(Config{
+		Name:       "broken",
+		RecordType: "kpi",
+		Interval:   20 * time.Millisecond,
+		Collect:    func(context.Context) (any, error) { return nil, failing },
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err := s.Register(Config{Name: "counter", RecordType: "kpi", Interval: time.Second, Collect: func(context.Context) (any, error) { return nil, nil }})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Fatalf("duplicate register: err = %v", err)
+	}
+
+	s.Start()
+	waitUntil(t, 2*time.Second, func() bool { return len(snk.byType("kpi")) >= 3 })
+	s.Stop()
+
+	rec := snk.byType("kpi")[0]
+	if rec.NeUID != "ne-001" || rec.CoreUID != "core-1" || string(rec.RecordData) != `{"n":1}` {
+		t.Fatalf("record = %+v", rec)
+	}
+	statuses := s.Statuses()
+	if len(statuses) != 2 || statuses[0].Name != "broken" {
+		t.Fatalf("statuses = %+v", statuses)
+	}
+	if st := statuses[0]; st.Healthy() || !errors.Is(st.LastError, failing) || st.Failures == 0 || st.Failures != st.Runs {
+		t.Fatalf("broken status = %+v", st)
+	}
+	if st := statuses[1]; !st.Healthy() || st.LastError != nil || st.Runs < 3 || st.LastSuccess.IsZero() {
+		t.Fatalf("counter status = %+v", st)
+	}
+}
+
+func TestScheduler_NoOverlap(t *testing.T) {
+	_, p := newSink(t)
+	s := New(p)
+
+	var running, maxRunning atomic.Int32
+	if err := s.Register(Config{
+		Name:       "slow",
+		RecordType: "kpi",
+		Interval:   10 * time.Millisecond,
+		Timeout:    20 * time.Millisecond,
+		Collect: func(context.Context) (any, error) {
+			// Ignores its context and overruns several intervals.
+			cur := running.Add(1)
+			if cur > maxRunning.Load() {
+				maxRunning.Store(cur)
+			}
+			time.Sleep(45 * time.Millisecond)
+			running.Add(-1)
+			return nil, nil
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	waitUntil(t, 2*time.Second, func() bool {
+		st, _ := s.Status("slow")
+		return st.Runs >= 3
+	})
+	s.Stop()
+
+	st, _ := s.Status("slow")
+	if maxRunning.Load() != 1 {
+		t.Fatalf("%d collections ran at once", maxRunning.Load())
+	}
+	if st.Skipped == 0 || !errors.Is(st.LastError, context.DeadlineExceeded) {
+		t.Fatalf("status = %+v, want skipped ticks and a timeout", st)
+	}
+	if !s.Unregister("slow") || s.Unregister("slow") {
+		t.Fatal("Unregister did not report existence")
+	}
+}
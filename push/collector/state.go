@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/tsmask/go-oam/pkg/state"
+)
+
+// Record types of the pkg/state collectors, for use as Config.RecordType.
+const (
+	TypeCPUMem = "cpu_mem" // state.MonitorCPUMemUsage
+	TypeDiskIO = "disk_io" // []state.MonitorDiskIO
+	TypeNetIO  = "net_io"  // []state.MonitorNetIO
+)
+
+// CPUMemUsage returns a Func sampling CPU and memory usage with
+// state.LoadCPUMemUsage over window. The collector's timeout must exceed
+// window.
+func CPUMemUsage(window time.Duration) Func {
+	return func(context.Context) (any, error) {
+		return state.LoadCPUMemUsage(window), nil
+	}
+}
+
+// DiskIO returns a Func sampling per-disk IO with state.LoadDiskIO over
+// window. Nothing is sent when no disk is found.
+func DiskIO(window time.Duration) Func {
+	return func(context.Context) (any, error) {
+		if io := state.LoadDiskIO(window); len(io) > 0 {
+			return io, nil
+		}
+		return nil, nil
+	}
+}
+
+// NetIO returns a Func sampling per-interface traffic with state.LoadNetIO
+// over window. Nothing is sent when no interface is found.
+func NetIO(window time.Duration) Func {
+	return func(context.Context) (any, error) {
+		if io := state.LoadNetIO(window); len(io) > 0 {
+			return io, nil
+		}
+		return nil, nil
+	}
+}
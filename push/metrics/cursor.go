@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+)
+
+// point 是 Cursor 读取时的单个指标状态。
+type point struct {
+	name  string
+	id    any // 存储实例，Register 覆盖同名指标后改变
+	desc  *Desc
+	value float64
+	init  float64
+	epoch uint64
+}
+
+// pointSource 由 Metrics 与 ShardedMetrics 实现。
+type pointSource interface {
+	points() []point
+}
+
+func (m *Metrics) points() []point {
+	var out []point
+	m.data.Range(func(key, value any) bool {
+		mt := value.(*metric)
+		mt.mu.Lock()
+		out = append(out, point{name: key.(string), id: mt, desc: mt.desc, value: mt.accum, init: mt.initVal, epoch: mt.epoch})
+		mt.mu.Unlock()
+		return true
+	})
+	return out
+}
+
+func (m *ShardedMetrics) points() []point {
+	var out []point
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.RLock()
+		for name, mt := range shard.data {
+			out = append(out, point{name: name, id: mt, desc: mt.desc, value: mt.accum, init: mt.initVal, epoch: mt.epoch})
+		}
+		shard.mu.RUnlock()
+	}
+	return out
+}
+
+// Reading Cursor 读取到的单个指标。
+type Reading struct {
+	Name   string  // 注册名
+	Family string  // 导出名称，未设置时同 Name
+	Labels []Label // 标签
+	Type   Type    // 导出类型
+	Value  float64 // 当前值
+	Delta  float64 // 自该游标上次读取以来的变化量
+	Rate   float64 // 每秒变化量，Delta / 读取间隔
+	Reset  bool    // 期间检测到计数器重置，Delta 为重置后的增量
+}
+
+type cursorEntry struct {
+	id    any
+	value float64
+	epoch uint64
+}
+
+/*
+Cursor 独立的增量读取游标。
+
+Flush/GetDelta 的增量基于指标内部唯一的 sent 值，多个导出方调用 Flush
+会互相“偷走”增量。Cursor 在自身保存每个指标上次读取的值，不修改指标，
+因此任意多个游标可同时读取同一注册表，互不影响，也不影响 Flush。
+
+计数器重置检测（仅 TypeCounter）：
+  - Clear/FlushAndReset/Counter.Reset 使指标重置
+  - Register 覆盖了同名指标
+  - 当前值小于上次读取的值（例如按名称 Set 了更小的值）
+
+检测到重置时 Reading.Reset 为 true，Delta 取重置后的增量（当前值 - 初始值），
+而不是负数。其他类型的 Delta 为当前值与上次读取值之差，可为负数。
+
+线程安全：所有方法都是并发安全的。
+*/
+type Cursor struct {
+	src  pointSource
+	now  func() time.Time
+	mu   sync.Mutex
+	last map[string]cursorEntry
+	at   time.Time
+}
+
+// NewCursor 创建以当前值为起点的游标，首次 Read 返回创建以来的变化量。
+func (m *Metrics) NewCursor() *Cursor {
+	return newCursor(m, time.Now)
+}
+
+// NewCursor 创建以当前值为起点的游标，首次 Read 返回创建以来的变化量。
+//
+// 使用示例：
+//
+//	prom := sm.NewCursor()
+//	nms := sm.NewCursor()
+//	for _, r := range nms.Read() { // 不影响 prom 的增量
+//	    log.Printf("%s %.0f/s", r.Name, r.Rate)
+//	}
+func (m *ShardedMetrics) NewCursor() *Cursor {
+	return newCursor(m, time.Now)
+}
+
+func newCursor(src pointSource, now func() time.Time) *Cursor {
+	c := &Cursor{src: src, now: now, last: make(map[string]cursorEntry)}
+	c.at = now()
+	for _, p := range src.points() {
+		c.last[p.name] = cursorEntry{id: p.id, value: p.value, epoch: p.epoch}
+	}
+	return c
+}
+
+// Read 返回所有指标自上次 Read 以来的变化，按名称排序。
+// 游标创建后才注册的指标以初始值为起点。
+func (c *Cursor) Read() []Reading {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	points := c.src.points()
+	now := c.now()
+	elapsed := now.Sub(c.at).Seconds()
+	c.at = now
+
+	out := make([]Reading, 0, len(points))
+	next := make(map[string]cursorEntry, len(points))
+	for _, p := range points {
+		r := Reading{Name: p.name, Family: p.name, Value: p.value}
+		if p.desc != nil {
+			r.Labels, r.Type = p.desc.Labels, p.desc.Type
+			if p.desc.Family != "" {
+				r.Family = p.desc.Family
+			}
+		}
+
+		prev, seen := c.last[p.name]
+		switch {
+		case !seen:
+			r.Delta = p.value - p.init
+		case r.Type == TypeCounter && (prev.id != p.id || prev.epoch != p.epoch || p.value < prev.value):
+			r.Reset = true
+			r.Delta = p.value - p.init
+		default:
+			r.Delta = p.value - prev.value
+		}
+		if elapsed > 0 {
+			r.Rate = r.Delta / elapsed
+		}
+
+		next[p.name] = cursorEntry{id: p.id, value: p.value, epoch: p.epoch}
+		out = append(out, r)
+	}
+	c.last = next
+
+	slices.SortFunc(out, func(a, b Reading) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func byName(rs []Reading) map[string]Reading {
+	out := make(map[string]Reading, len(rs))
+	for _, r := range rs {
+		out[r.Name] = r
+	}
+	return out
+}
+
+func TestCursor_IndependentConsumers(t *testing.T) {
+	sm := NewSharded()
+	pushed := sm.NewCounter("push_total", WithHelp("Records pushed."))
+	conns := sm.NewUpDownCounter("ws_conns")
+	temp := sm.NewGauge("cpu_temp")
+	pushed.Add(10)
+
+	clk := &fakeClock{t: time.Unix(1000, 0)}
+	a := newCursor(sm, clk.now)
+	b := newCursor(sm, clk.now)
+
+	pushed.Add(20)
+	pushed.Add(-5) // ignored
+	conns.Inc()
+	conns.Inc()
+	conns.Dec()
+	temp.Set(60)
+	clk.t = clk.t.Add(10 * time.Second)
+
+	got := byName(a.Read())
+	if r := got["push_total"]; r.Delta != 20 || r.Rate != 2 || r.Reset || r.Type != TypeCounter || r.Value != 30 {
+		t.Fatalf("push_total = %+v", r)
+	}
+	if r := got["ws_conns"]; r.Delta != 1 || r.Type != TypeGauge {
+		t.Fatalf("ws_conns = %+v", r)
+	}
+	if r := got["cpu_temp"]; r.Delta != 60 {
+		t.Fatalf("cpu_temp = %+v", r)
+	}
+
+	// a's read neither consumed b's delta nor the Flush delta.
+	pushed.Inc()
+	clk.t = clk.t.Add(10 * time.Second)
+	if r := byName(b.Read())["push_total"]; r.Delta != 21 || r.Rate != 1.05 {
+		t.Fatalf("second consumer = %+v", r)
+	}
+	if d := sm.Flush()["push_total"]; d != 31 {
+		t.Fatalf("Flush delta = %v, want 31", d)
+	}
+	if r := byName(a.Read())["push_total"]; r.Delta != 1 || r.Rate != 0.1 {
+		t.Fatalf("first consumer after flush = %+v", r)
+	}
+}
+
+func TestCursor_CounterResets(t *testing.T) {
+	sm := NewSharded()
+	c := sm.NewCounter("rx_total")
+	sm.Register("legacy_total", 0, 1, 0, 1e9, WithType(TypeCounter))
+	sm.Register("level", 5, 1, 0, 100)
+	c.Add(100)
+	sm.IncBy("legacy_total", 50)
+
+	clk := &fakeClock{t: time.Unix(0, 0)}
+	cur := newCursor(sm, clk.now)
+
+	c.Reset()
+	c.Add(7)
+	sm.Set("legacy_total", 3)
+	sm.Dec("level")
+	clk.t = clk.t.Add(time.Second)
+
+	got := byName(cur.Read())
+	if r := got["rx_total"]; !r.Reset || r.Delta != 7 {
+		t.Fatalf("rx_total = %+v", r)
+	}
+	if r := got["legacy_total"]; !r.Reset || r.Delta != 3 {
+		t.Fatalf("legacy_total = %+v", r)
+	}
+	if r := got["level"]; r.Reset || r.Delta != -1 {
+		t.Fatalf("level = %+v", r)
+	}
+
+	sm.FlushAndReset()
+	sm.Register("late_total", 0, 1, 0, 1e9, WithType(TypeCounter))
+	sm.IncBy("late_total", 4)
+	clk.t = clk.t.Add(time.Second)
+	got = byName(cur.Read())
+	if r := got["rx_total"]; !r.Reset || r.Delta != 0 {
+		t.Fatalf("rx_total after FlushAndReset = %+v", r)
+	}
+	if r := got["late_total"]; r.Reset || r.Delta != 4 {
+		t.Fatalf("late_total = %+v", r)
+	}
+
+	m := New()
+	m.Register("n", 0, 1, 0, 1e9, WithType(TypeCounter))
+	mc := m.NewCursor()
+	m.Inc("n")
+	m.Clear()
+	m.Inc("n")
+	if r := mc.Read()[0]; !r.Reset || r.Delta != 1 {
+		t.Fatalf("Metrics cursor = %+v", r)
+	}
+}
@@ -0,0 +1,373 @@
+package metrics
+
+import (
+	"bufio"
+	"cmp"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Type 指标导出类型，对应 Prometheus 的 TYPE 元数据。
+type Type int
+
+const (
+	TypeUntyped   Type = iota // 未声明类型（默认）
+	TypeCounter               // 只增计数器
+	TypeGauge                 // 可增可减的瞬时值
+	TypeHistogram             // 分桶直方图
+	TypeSummary               // 分位数摘要
+)
+
+// String 返回 Prometheus 文本格式中的类型名称。
+func (t Type) String() string {
+	switch t {
+	case TypeCounter:
+		return "counter"
+	case TypeGauge:
+		return "gauge"
+	case TypeHistogram:
+		return "histogram"
+	case TypeSummary:
+		return "summary"
+	default:
+		return "untyped"
+	}
+}
+
+// Label 指标标签。
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Desc 指标导出元数据，在 Register 时通过 Option 设置。
+type Desc struct {
+	Family string  // 导出名称，为空时使用注册名
+	Help   string  // HELP 说明
+	Type   Type    // TYPE 类型
+	Labels []Label // 标签集合，按名称排序
+}
+
+// Option 设置指标导出元数据。
+type Option func(*Desc)
+
+// WithHelp 设置 HELP 说明。
+func WithHelp(help string) Option {
+	return func(d *Desc) { d.Help = help }
+}
+
+// WithType 设置 TYPE 类型。
+func WithType(t Type) Option {
+	return func(d *Desc) { d.Type = t }
+}
+
+// WithFamily 设置导出名称。多个注册名可共用同一导出名称，以不同标签区分，
+// 例如 "rx_bytes:eth0" 与 "rx_bytes:eth1" 导出为带 iface 标签的 rx_bytes。
+func WithFamily(name string) Option {
+	return func(d *Desc) { d.Family = name }
+}
+
+// WithLabels 设置标签，参数为名称、值交替排列；多余的单个参数被忽略。
+//
+// 示例：
+//
+//	sm.Register("rx_bytes:eth0", 0, 1, 0, math.MaxFloat64,
+//	    metrics.WithFamily("rx_bytes"),
+//	    metrics.WithType(metrics.TypeCounter),
+//	    metrics.WithLabels("iface", "eth0"),
+//	)
+func WithLabels(kv ...string) Option {
+	return func(d *Desc) {
+		for i := 0; i+1 < len(kv); i += 2 {
+			d.Labels = append(d.Labels, Label{Name: kv[i], Value: kv[i+1]})
+		}
+		slices.SortFunc(d.Labels, func(a, b Label) int { return cmp.Compare(a.Name, b.Name) })
+	}
+}
+
+// newDesc 应用选项，未传入选项时返回 nil。
+func newDesc(opts []Option) *Desc {
+	if len(opts) == 0 {
+		return nil
+	}
+	d := &Desc{}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// Sample 导出时的单个样本。
+type Sample struct {
+	Suffix string // 样本名后缀，如直方图的 "_bucket"、"_sum"、"_count"
+	Labels []Label
+	Value  float64
+}
+
+// Family 同一导出名称下的全部样本。
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// Gatherer 提供可导出的指标，Metrics、ShardedMetrics、Histogram 与 Summary 均已实现。
+type Gatherer interface {
+	Gather() []Family
+}
+
+// familySet 按导出名称合并样本。
+type familySet map[string]*Family
+
+// add 加入一个指标的当前值。同名指标的 HELP/TYPE 以先加入者为准。
+func (fs familySet) add(name string, d *Desc, v float64) {
+	var labels []Label
+	family := Family{Name: name}
+	if d != nil {
+		if d.Family != "" {
+			family.Name = d.Family
+		}
+		family.Help, family.Type, labels = d.Help, d.Type, d.Labels
+	}
+	f := fs[family.Name]
+	if f == nil {
+		f = &family
+		fs[family.Name] = f
+	} else if f.Help == "" && f.Type == TypeUntyped {
+		f.Help, f.Type = family.Help, family.Type
+	}
+	f.Samples = append(f.Samples, Sample{Labels: labels, Value: v})
+}
+
+// list 返回按名称排序的指标族。
+func (fs familySet) list() []Family {
+	out := make([]Family, 0, len(fs))
+	for _, f := range fs {
+		out = append(out, *f)
+	}
+	slices.SortFunc(out, func(a, b Family) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
+
+// Gather 以当前累积值导出所有指标，不影响 Flush 的增量计算。
+func (m *Metrics) Gather() []Family {
+	fs := familySet{}
+	m.data.Range(func(key, value any) bool {
+		mt := value.(*metric)
+		mt.mu.Lock()
+		v := mt.accum
+		mt.mu.Unlock()
+		fs.add(key.(string), mt.desc, v)
+		return true
+	})
+	return fs.list()
+}
+
+// Gather 以当前累积值导出所有指标，不影响 Flush 的增量计算。
+func (m *ShardedMetrics) Gather() []Family {
+	fs := familySet{}
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.RLock()
+		for name, mt := range shard.data {
+			fs.add(name, mt.desc, mt.accum)
+		}
+		shard.mu.RUnlock()
+	}
+	return fs.list()
+}
+
+// 导出格式的 Content-Type。
+const (
+	ContentTypeText        = "text/plain; version=0.0.4; charset=utf-8"
+	ContentTypeOpenMetrics = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// Handler 返回以 Prometheus 文本格式导出 gs 中全部指标的 http.Handler。
+// 请求头 Accept 包含 application/openmetrics-text 时改为 OpenMetrics 格式。
+// 多个来源中同名指标族的样本合并输出，标签完全相同的重复样本只保留第一个。
+//
+// 示例：
+//
+//	http.Handle("/metrics", metrics.Handler(sm))
+func Handler(gs ...Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fams := gather(gs)
+		write, contentType := WriteText, ContentTypeText
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			write, contentType = WriteOpenMetrics, ContentTypeOpenMetrics
+		}
+		w.Header().Set("Content-Type", contentType)
+		_ = write(w, fams)
+	})
+}
+
+// gather 合并多个来源的指标族。
+func gather(gs []Gatherer) []Family {
+	if len(gs) == 1 {
+		return gs[0].Gather()
+	}
+	fs := familySet{}
+	for _, g := range gs {
+		for _, f := range g.Gather() {
+			if cur := fs[f.Name]; cur != nil {
+				cur.Samples = append(cur.Samples, f.Samples...)
+			} else {
+				fs[f.Name] = &f
+			}
+		}
+	}
+	return fs.list()
+}
+
+// WriteText 以 Prometheus 文本格式（0.0.4）写出指标族。
+func WriteText(w io.Writer, fams []Family) error {
+	return write(w, fams, false)
+}
+
+// WriteOpenMetrics 以 OpenMetrics 文本格式写出指标族，以 "# EOF" 结尾。
+// 计数器族名去掉 "_total" 后缀，样本名带 "_total" 后缀。
+func WriteOpenMetrics(w io.Writer, fams []Family) error {
+	return write(w, fams, true)
+}
+
+func write(w io.Writer, fams []Family, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range fams {
+		name := sanitizeName(f.Name, true)
+		sampleName := name
+		if openMetrics && f.Type == TypeCounter {
+			name = strings.TrimSuffix(name, "_total")
+			sampleName = name + "_total"
+		}
+		typ := f.Type.String()
+		if openMetrics && f.Type == TypeUntyped {
+			typ = "unknown"
+		}
+
+		if f.Help != "" {
+			bw.WriteString("# HELP " + name + " " + escapeHelp(f.Help, openMetrics) + "\n")
+		}
+		bw.WriteString("# TYPE " + name + " " + typ + "\n")
+
+		samples := slices.Clone(f.Samples)
+		for i := range samples {
+			samples[i].Labels = sanitizeLabels(samples[i].Labels)
+		}
+		// 直方图与摘要的样本已按桶、分位数排列，保持原有顺序。
+		if f.Type != TypeHistogram && f.Type != TypeSummary {
+			slices.SortStableFunc(samples, compareSamples)
+		}
+		for i, s := range samples {
+			if i > 0 && compareSamples(samples[i-1], s) == 0 {
+				continue
+			}
+			bw.WriteString(sampleName + s.Suffix)
+			writeLabels(bw, s.Labels)
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func writeLabels(bw *bufio.Writer, labels []Label) {
+	if len(labels) == 0 {
+		return
+	}
+	bw.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			bw.WriteByte(',')
+		}
+		bw.WriteString(l.Name + `="` + escapeLabelValue(l.Value) + `"`)
+	}
+	bw.WriteByte('}')
+}
+
+// sanitizeLabels 规范化标签名并按名称排序，同名标签只保留第一个。
+func sanitizeLabels(labels []Label) []Label {
+	out := make([]Label, 0, len(labels))
+	for _, l := range labels {
+		l.Name = sanitizeName(l.Name, false)
+		if !slices.ContainsFunc(out, func(o Label) bool { return o.Name == l.Name }) {
+			out = append(out, l)
+		}
+	}
+	slices.SortFunc(out, func(a, b Label) int { return cmp.Compare(a.Name, b.Name) })
+	return out
+}
+
+func compareSamples(a, b Sample) int {
+	if c := compareLabels(a.Labels, b.Labels); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Suffix, b.Suffix)
+}
+
+func compareLabels(a, b []Label) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := cmp.Compare(a[i].Name, b[i].Name); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a[i].Value, b[i].Value); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// sanitizeName 将非法字符替换为下划线。指标名允许 [a-zA-Z0-9_:]，
+// 标签名允许 [a-zA-Z0-9_]，且均不能以数字开头。
+func sanitizeName(name string, colon bool) string {
+	if name == "" {
+		return "_"
+	}
+	b := []byte(name)
+	for i, c := range b {
+		ok := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c >= '0' && c <= '9' && i > 0 || c == ':' && colon
+		if !ok {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	helpEscaperOM     = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string, openMetrics bool) string {
+	if openMetrics {
+		return helpEscaperOM.Replace(s)
+	}
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelValueEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
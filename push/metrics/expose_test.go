@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, h http.Handler, accept string) (string, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Body.String(), rec.Header().Get("Content-Type")
+}
+
+func TestHandler_Text(t *testing.T) {
+	sm := NewSharded()
+	for _, iface := range []string{"eth1", "eth0"} {
+		sm.Register("rx_bytes:"+iface, 0, 1, 0, math.MaxFloat64,
+			WithFamily("rx_bytes_total"),
+			WithHelp("Received bytes.\nPer interface."),
+			WithType(TypeCounter),
+			WithLabels("iface", iface),
+		)
+	}
+	sm.IncBy("rx_bytes:eth0", 1500)
+	sm.Register("queue-depth", 0, 1, math.Inf(-1), math.Inf(1), WithType(TypeGauge), WithLabels("path", `a"b\c`))
+	sm.Set("queue-depth", math.Inf(1))
+
+	m := New()
+	m.Register("uptime", 42, 1, 0, 1e9)
+	// Same series as in sm: only the first one is written.
+	m.Register("rx_bytes:eth0", 7, 1, 0, 1e9, WithFamily("rx_bytes_total"), WithLabels("iface", "eth0"))
+
+	body, ct := scrape(t, Handler(sm, m), "")
+	if ct != ContentTypeText {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	want := `# HELP queue_depth` // not set, so no HELP line
+	if strings.Contains(body, want) {
+		t.Fatalf("unexpected HELP line in\n%s", body)
+	}
+	want = strings.Join([]string{
+		`# TYPE queue_depth gauge`,
+		`queue_depth{path="a\"b\\c"} +Inf`,
+		`# HELP rx_bytes_total Received bytes.\nPer interface.`,
+		`# TYPE rx_bytes_total counter`,
+		`rx_bytes_total{iface="eth0"} 1500`,
+		`rx_bytes_total{iface="eth1"} 0`,
+		`# TYPE uptime untyped`,
+		`uptime 42`,
+		``,
+	}, "\n")
+	if body != want {
+		t.Fatalf("body =\n%s\nwant\n%s", body, want)
+	}
+}
+
+func TestHandler_OpenMetrics(t *testing.T) {
+	m := New()
+	m.Register("requests_total", 0, 1, 0, 1e9, WithType(TypeCounter), WithHelp(`say "hi"`))
+	m.Inc("requests_total")
+	m.Register("temp", 0, 1, 0, 100)
+
+	body, ct := scrape(t, Handler(m), "application/openmetrics-text;version=1.0.0,text/plain;q=0.5")
+	if ct != ContentTypeOpenMetrics {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	want := strings.Join([]string{
+		`# HELP requests say \"hi\"`,
+		`# TYPE requests counter`,
+		`requests_total 1`,
+		`# TYPE temp unknown`,
+		`temp 0`,
+		`# EOF`,
+		``,
+	}, "\n")
+	if body != want {
+		t.Fatalf("body =\n%s\nwant\n%s", body, want)
+	}
+	// Gathering does not consume the delta.
+	if d := m.Flush()["requests_total"]; d != 1 {
+		t.Fatalf("delta after scrape = %v, want 1", d)
+	}
+}
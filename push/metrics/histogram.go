@@ -0,0 +1,239 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrBucketsMismatch 表示合并的两个直方图快照桶边界不同。
+var ErrBucketsMismatch = errors.New("metrics: histogram buckets mismatch")
+
+// DefaultBuckets 是以秒为单位的默认延迟桶边界（5ms ~ 10s）。
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// LinearBuckets 返回从 start 开始、间隔 width 的 count 个桶边界。
+func LinearBuckets(start, width float64, count int) []float64 {
+	b := make([]float64, max(count, 0))
+	for i := range b {
+		b[i] = start + float64(i)*width
+	}
+	return b
+}
+
+// ExponentialBuckets 返回从 start 开始、每次乘以 factor 的 count 个桶边界。
+// start 须大于 0，factor 须大于 1。
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	b := make([]float64, max(count, 0))
+	for i := range b {
+		b[i] = start * math.Pow(factor, float64(i))
+	}
+	return b
+}
+
+// HistogramOpts 直方图配置。
+type HistogramOpts struct {
+	Name    string    // 导出名称
+	Help    string    // HELP 说明
+	Labels  []Label   // 固定标签
+	Buckets []float64 // 桶上界，为空时使用 DefaultBuckets；+Inf 桶自动追加
+}
+
+// Histogram 分桶直方图，记录观测值落入各桶的次数及总和。
+// 所有方法都是线程安全的。
+//
+// 使用示例：
+//
+//	h := metrics.NewHistogram(metrics.HistogramOpts{Name: "push_rtt_seconds"})
+//	start := time.Now()
+//	...
+//	h.ObserveDuration(time.Since(start))
+//	http.Handle("/metrics", metrics.Handler(sm, h))
+type Histogram struct {
+	name   string
+	help   string
+	labels []Label
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // 各桶计数（非累积），最后一个为 +Inf 桶
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram 创建直方图。桶边界会被排序去重，NaN 与 ±Inf 被忽略。
+func NewHistogram(opts HistogramOpts) *Histogram {
+	bounds := opts.Buckets
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets
+	}
+	bounds = slices.DeleteFunc(slices.Clone(bounds), func(b float64) bool {
+		return math.IsNaN(b) || math.IsInf(b, 0)
+	})
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+	return &Histogram{
+		name:   opts.Name,
+		help:   opts.Help,
+		labels: sanitizeLabels(opts.Labels),
+		bounds: bounds,
+		counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe 记录一个观测值，NaN 被忽略。
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += v
+	h.mu.Unlock()
+}
+
+// ObserveDuration 以秒为单位记录耗时。
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// Snapshot 返回自创建或上次 FlushAndReset 以来的累积快照。
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.snapshot()
+}
+
+// FlushAndReset 返回自上次 FlushAndReset 以来的快照并清零，
+// 与计数器 FlushAndReset 的增量语义一致：按周期调用即得到各周期的分布。
+// 清零对 Prometheus 抓取而言等同于计数器重置。
+func (h *Histogram) FlushAndReset() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.snapshot()
+	clear(h.counts)
+	h.count, h.sum = 0, 0
+	return s
+}
+
+func (h *Histogram) snapshot() HistogramSnapshot {
+	return HistogramSnapshot{
+		Bounds: h.bounds,
+		Counts: slices.Clone(h.counts),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
+
+// Gather 以累积桶（_bucket{le=...}）、_sum、_count 导出。
+func (h *Histogram) Gather() []Family {
+	s := h.Snapshot()
+	samples := make([]Sample, 0, len(s.Counts)+2)
+	var cum uint64
+	for i, c := range s.Counts {
+		cum += c
+		le := math.Inf(1)
+		if i < len(s.Bounds) {
+			le = s.Bounds[i]
+		}
+		samples = append(samples, Sample{
+			Suffix: "_bucket",
+			Labels: withLabel(h.labels, "le", formatValue(le)),
+			Value:  float64(cum),
+		})
+	}
+	samples = append(samples,
+		Sample{Suffix: "_sum", Labels: h.labels, Value: s.Sum},
+		Sample{Suffix: "_count", Labels: h.labels, Value: float64(s.Count)},
+	)
+	return []Family{{Name: h.name, Help: h.help, Type: TypeHistogram, Samples: samples}}
+}
+
+// withLabel 返回追加了一个标签的副本。
+func withLabel(labels []Label, name, value string) []Label {
+	return append(slices.Clip(labels), Label{Name: name, Value: value})
+}
+
+// HistogramSnapshot 直方图快照，可序列化为 JSON 并与同桶边界的快照合并。
+type HistogramSnapshot struct {
+	Bounds []float64 `json:"bounds"` // 桶上界，不含 +Inf
+	Counts []uint64  `json:"counts"` // 各桶计数（非累积），最后一个为 +Inf 桶
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// Merge 返回两个快照之和。零值快照可与任意快照合并，
+// 其余情况下桶边界不同时返回 ErrBucketsMismatch。
+func (s HistogramSnapshot) Merge(o HistogramSnapshot) (HistogramSnapshot, error) {
+	if s.Counts == nil {
+		return o.clone(), nil
+	}
+	if o.Counts == nil {
+		return s.clone(), nil
+	}
+	if !slices.Equal(s.Bounds, o.Bounds) || len(s.Counts) != len(o.Counts) {
+		return s, ErrBucketsMismatch
+	}
+	out := s.clone()
+	for i, c := range o.Counts {
+		out.Counts[i] += c
+	}
+	out.Count += o.Count
+	out.Sum += o.Sum
+	return out, nil
+}
+
+func (s HistogramSnapshot) clone() HistogramSnapshot {
+	s.Bounds = slices.Clone(s.Bounds)
+	s.Counts = slices.Clone(s.Counts)
+	return s
+}
+
+// Mean 返回平均值，无观测值时返回 NaN。
+func (s HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Quantile 在所在桶内线性插值估算 q 分位数（0 ≤ q ≤ 1）。
+// 落入 +Inf 桶时返回最大的有限桶边界；无观测值时返回 NaN。
+func (s HistogramSnapshot) Quantile(q float64) float64 {
+	if s.Count == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	q = min(max(q, 0), 1)
+	rank := q * float64(s.Count)
+	var cum float64
+	for i, c := range s.Counts {
+		if c == 0 {
+			continue
+		}
+		prev := cum
+		cum += float64(c)
+		if cum < rank {
+			continue
+		}
+		if i == len(s.Bounds) {
+			if len(s.Bounds) == 0 {
+				return math.NaN()
+			}
+			return s.Bounds[len(s.Bounds)-1]
+		}
+		upper := s.Bounds[i]
+		lower := 0.0
+		if i > 0 {
+			lower = s.Bounds[i-1]
+		} else if upper <= 0 {
+			return upper
+		}
+		return lower + (upper-lower)*(rank-prev)/float64(c)
+	}
+	return math.NaN()
+}
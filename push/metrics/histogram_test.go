@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogram_ObserveFlushMerge(t *testing.T) {
+	h := NewHistogram(HistogramOpts{Name: "push_rtt_seconds", Buckets: []float64{1, 0.1, 0.5, 0.1, math.Inf(1)}})
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 2, math.NaN()} {
+		h.Observe(v)
+	}
+	h.ObserveDuration(200 * time.Millisecond)
+
+	s := h.FlushAndReset()
+	if got, want := s.Counts, []uint64{2, 2, 1, 1}; len(got) != 4 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("bounds = %v counts = %v", s.Bounds, got)
+	}
+	if s.Count != 6 || math.Abs(s.Sum-3.35) > 1e-9 {
+		t.Fatalf("count = %d sum = %v", s.Count, s.Sum)
+	}
+	if q := s.Quantile(0.5); math.Abs(q-0.3) > 1e-9 {
+		t.Fatalf("p50 = %v, want 0.3", q)
+	}
+	if q := s.Quantile(1); q != 1 {
+		t.Fatalf("p100 = %v, want the largest finite bound", q)
+	}
+
+	h.Observe(0.2)
+	d := h.Snapshot()
+	if d.Count != 1 || d.Counts[1] != 1 {
+		t.Fatalf("snapshot after reset = %+v", d)
+	}
+	var total HistogramSnapshot
+	for _, part := range []HistogramSnapshot{s, d} {
+		var err error
+		if total, err = total.Merge(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if total.Count != 7 || total.Counts[1] != 3 {
+		t.Fatalf("merged = %+v", total)
+	}
+	other := NewHistogram(HistogramOpts{Buckets: []float64{1}}).Snapshot()
+	if _, err := total.Merge(other); !errors.Is(err, ErrBucketsMismatch) {
+		t.Fatalf("merge mismatched buckets: err = %v", err)
+	}
+}
+
+func TestSketch_AccuracyAndMerge(t *testing.T) {
+	const n = 20000
+	rng := rand.New(rand.NewPCG(1, 2))
+	values := make([]float64, n)
+	a, b := NewSketch(0.01, 0), NewSketch(0.01, 0)
+	for i := range values {
+		values[i] = rng.ExpFloat64() / 10
+		if i%2 == 0 {
+			a.Add(values[i])
+		} else {
+			b.Add(values[i])
+		}
+	}
+	var merged Sketch
+	if err := merged.Merge(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := merged.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if merged.Count() != n {
+		t.Fatalf("count = %d", merged.Count())
+	}
+
+	sorted := append([]float64(nil), values...)
+	slices.Sort(sorted)
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		want := sorted[int(q*(n-1))]
+		if got := merged.Quantile(q); math.Abs(got-want)/want > 0.011 {
+			t.Fatalf("p%v = %v, want %v within 1%%", q*100, got, want)
+		}
+	}
+
+	data, err := json.Marshal(&merged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Sketch
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Quantile(0.99) != merged.Quantile(0.99) || decoded.Max() != merged.Max() {
+		t.Fatal("sketch did not survive a JSON round-trip")
+	}
+	if err := decoded.Merge(NewSketch(0.05, 0)); err != nil {
+		t.Fatalf("merging an empty sketch: %v", err)
+	}
+	coarse := NewSketch(0.05, 0)
+	coarse.Add(1)
+	if err := decoded.Merge(coarse); !errors.Is(err, ErrSketchMismatch) {
+		t.Fatalf("merge mismatched accuracy: err = %v", err)
+	}
+}
+
+func TestSketch_FixedMemory(t *testing.T) {
+	s := NewSketch(0.01, 64)
+	for v := 1e-6; v < 1e6; v *= 1.01 {
+		s.Add(v)
+	}
+	if len(s.bins) > 64 {
+		t.Fatalf("%d bins, want at most 64", len(s.bins))
+	}
+	if got := s.Quantile(0.999); math.Abs(got-1e6)/1e6 > 0.05 {
+		t.Fatalf("p99.9 = %v after collapsing low bins", got)
+	}
+}
+
+func TestSummaryAndHistogram_Exposition(t *testing.T) {
+	h := NewHistogram(HistogramOpts{Name: "rtt_seconds", Buckets: []float64{0.1, 1}, Labels: []Label{{"target", "nms"}}})
+	h.Observe(0.05)
+	h.Observe(0.5)
+	s := NewSummary(SummaryOpts{Name: "exec_seconds", Objectives: []float64{0.5}})
+	s.Observe(2)
+
+	body, _ := scrape(t, Handler(h, s), "")
+	want := strings.Join([]string{
+		`# TYPE exec_seconds summary`,
+		`exec_seconds{quantile="0.5"} 2`,
+		`exec_seconds_sum 2`,
+		`exec_seconds_count 1`,
+		`# TYPE rtt_seconds histogram`,
+		`rtt_seconds_bucket{le="0.1",target="nms"} 1`,
+		`rtt_seconds_bucket{le="1",target="nms"} 2`,
+		`rtt_seconds_bucket{le="+Inf",target="nms"} 2`,
+		`rtt_seconds_sum{target="nms"} 0.55`,
+		`rtt_seconds_count{target="nms"} 2`,
+		``,
+	}, "\n")
+	if body != want {
+		t.Fatalf("body =\n%s\nwant\n%s", body, want)
+	}
+	if sk := s.FlushAndReset(); sk.Count() != 1 || s.Snapshot().Count() != 0 {
+		t.Fatal("FlushAndReset did not hand over the observations")
+	}
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"math"
+	"sync"
+)
+
+/*
+类型化指标句柄。
+
+按名称操作的 Register/Inc/Dec/Set 接口对所有指标一视同仁：accum 受 min/max
+截断，Dec 与负数 IncBy 同样作用于“计数器”。类型化句柄区分三种语义：
+
+  - Counter：只增不减，Add 忽略负数；只有 Reset 能使其回到 0，并被 Cursor 识别为重置
+  - Gauge：瞬时值，可任意 Set
+  - UpDownCounter：可增可减的累计值（如连接数），不提供 Set，以免丢失增量
+
+句柄缓存所在分片锁与存储位置，更新时无需哈希与查表。
+句柄对应的指标同样存于 ShardedMetrics，Flush/Snapshot/Gather/Cursor 均可见。
+*/
+
+// series 单个序列的句柄，缓存所在分片锁与存储位置。
+type series struct {
+	mu *sync.RWMutex
+	mt *shardMetric
+}
+
+// series 登记键为 key 的指标并返回句柄；已存在时复用，因此同名句柄共享数据。
+// 对同一键再次调用 Register 会替换存储，使已缓存的句柄失效。
+func (m *ShardedMetrics) series(key string, desc *Desc, min, max float64) *series {
+	shard := &m.shards[m.getShardIndex(key)]
+	shard.mu.Lock()
+	mt, ok := shard.data[key]
+	if !ok {
+		mt = &shardMetric{step: 1, minVal: min, maxVal: max, desc: desc}
+		shard.data[key] = mt
+	}
+	shard.mu.Unlock()
+	return &series{mu: &shard.mu, mt: mt}
+}
+
+func (s *series) add(delta float64) {
+	s.mu.Lock()
+	v := s.mt.accum + delta
+	if v > s.mt.maxVal {
+		v = s.mt.maxVal
+	}
+	if v < s.mt.minVal {
+		v = s.mt.minVal
+	}
+	s.mt.accum = v
+	s.mu.Unlock()
+}
+
+func (s *series) set(value float64) {
+	s.mu.Lock()
+	s.mt.accum = value
+	s.mu.Unlock()
+}
+
+func (s *series) get() float64 {
+	s.mu.RLock()
+	v := s.mt.accum
+	s.mu.RUnlock()
+	return v
+}
+
+// typedDesc 在 opts 之后强制设置类型。
+func typedDesc(t Type, opts []Option) *Desc {
+	return newDesc(append(opts[:len(opts):len(opts)], WithType(t)))
+}
+
+// NewCounter 返回名为 name 的计数器句柄，opts 设置导出元数据（类型固定为 TypeCounter）。
+//
+// 使用示例：
+//
+//	pushed := sm.NewCounter("push_total", metrics.WithHelp("Records pushed."))
+//	pushed.Inc()
+func (m *ShardedMetrics) NewCounter(name string, opts ...Option) *Counter {
+	return &Counter{m.series(name, typedDesc(TypeCounter, opts), 0, math.MaxFloat64)}
+}
+
+// NewGauge 返回名为 name 的瞬时值句柄（导出类型为 TypeGauge）。
+func (m *ShardedMetrics) NewGauge(name string, opts ...Option) *Gauge {
+	return &Gauge{m.series(name, typedDesc(TypeGauge, opts), math.Inf(-1), math.Inf(1))}
+}
+
+// NewUpDownCounter 返回名为 name 的增减计数器句柄（导出类型为 TypeGauge）。
+func (m *ShardedMetrics) NewUpDownCounter(name string, opts ...Option) *UpDownCounter {
+	return &UpDownCounter{m.series(name, typedDesc(TypeGauge, opts), math.Inf(-1), math.Inf(1))}
+}
+
+// Counter 计数器句柄，值只增不减。
+type Counter struct{ s *series }
+
+// Inc 加 1。
+func (c *Counter) Inc() { c.s.add(1) }
+
+// Add 加 delta，负数被忽略。
+func (c *Counter) Add(delta float64) {
+	if delta > 0 {
+		c.s.add(delta)
+	}
+}
+
+// Get 返回当前累积值。
+func (c *Counter) Get() float64 { return c.s.get() }
+
+// Reset 将计数器归零，例如被镜像的设备计数器回绕时。
+// Cursor 下次读取时报告重置，增量从 0 重新计算。
+func (c *Counter) Reset() {
+	c.s.mu.Lock()
+	c.s.mt.accum, c.s.mt.sent = c.s.mt.initVal, c.s.mt.initVal
+	c.s.mt.epoch++
+	c.s.mu.Unlock()
+}
+
+// Gauge 瞬时值句柄。
+type Gauge struct{ s *series }
+
+// Set 设为 value。
+func (g *Gauge) Set(value float64) { g.s.set(value) }
+
+// Inc 加 1。
+func (g *Gauge) Inc() { g.s.add(1) }
+
+// Dec 减 1。
+func (g *Gauge) Dec() { g.s.add(-1) }
+
+// Add 加 delta，可为负数。
+func (g *Gauge) Add(delta float64) { g.s.add(delta) }
+
+// Get 返回当前值。
+func (g *Gauge) Get() float64 { return g.s.get() }
+
+// UpDownCounter 增减计数器句柄，只能以增量方式更新。
+type UpDownCounter struct{ s *series }
+
+// Inc 加 1。
+func (u *UpDownCounter) Inc() { u.s.add(1) }
+
+// Dec 减 1。
+func (u *UpDownCounter) Dec() { u.s.add(-1) }
+
+// Add 加 delta，可为负数。
+func (u *UpDownCounter) Add(delta float64) { u.s.add(delta) }
+
+// Get 返回当前值。
+func (u *UpDownCounter) Get() float64 { return u.s.get() }
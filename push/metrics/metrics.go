@@ -100,6 +100,12 @@ type metric struct {
 	// mu 保护此 metric 实例的所有字段。
 	// 使用 Mutex 而非 RWMutex，因为更新操作需要原子性。
 	mu sync.Mutex
+
+	// desc 是导出元数据（HELP/TYPE/标签），未传入 Option 时为 nil。
+	desc *Desc
+
+	// epoch 在 Clear/FlushAndReset 重置指标时递增，供 Cursor 识别计数器重置。
+	epoch uint64
 }
 
 /*
@@ -154,13 +160,14 @@ func New() *Metrics {
 //   - step: 增量步长，用于 Inc/Dec 操作
 //   - min: 最小值约束，Dec 操作不会低于此值
 //   - max: 最大值约束，Inc 操作不会超过此值
+//   - opts: 可选的导出元数据（WithHelp/WithType/WithLabels/WithFamily），供 Handler 使用
 //
 // 线程安全：此方法是并发安全的
 //
 // 注意：
 //   - 如果指标已存在，Register 不会覆盖已有值
 //   - 建议在程序启动时注册所有指标
-func (m *Metrics) Register(name string, init, step, min, max float64) {
+func (m *Metrics) Register(name string, init, step, min, max float64, opts ...Option) {
 	m.data.Store(name, &metric{
 		accum:   init,
 		sent:    init,
@@ -168,6 +175,7 @@ func (m *Metrics) Register(name string, init, step, min, max float64) {
 		step:    step,
 		minVal:  min,
 		maxVal:  max,
+		desc:    newDesc(opts),
 	})
 }
 
@@ -379,6 +387,7 @@ func (m *Metrics) FlushAndReset() map[string]float64 {
 		result[key.(string)] = mt.accum
 		mt.accum = mt.initVal
 		mt.sent = mt.initVal
+		mt.epoch++
 		mt.mu.Unlock()
 		return true
 	})
@@ -432,6 +441,7 @@ func (m *Metrics) Clear() {
 		mt.mu.Lock()
 		mt.accum = mt.initVal
 		mt.sent = mt.initVal
+		mt.epoch++
 		mt.mu.Unlock()
 		return true
 	})
@@ -61,6 +61,8 @@ type shardMetric struct {
 	step    float64
 	minVal  float64
 	maxVal  float64
+	desc    *Desc  // 导出元数据，未传入 Option 时为 nil
+	epoch   uint64 // 重置次数，供 Cursor 识别计数器重置
 }
 
 // ShardedMetrics 使用 16 个分片实现高性能指标收集。
@@ -162,6 +164,7 @@ func (m *ShardedMetrics) getShardIndex(name string) int {
 //   - step: 增量步长，用于 Inc/Dec 操作
 //   - min: 最小值约束
 //   - max: 最大值约束
+//   - opts: 可选的导出元数据（WithHelp/WithType/WithLabels/WithFamily），供 Handler 使用
 //
 // 线程安全：此方法是并发安全的
 //
@@ -170,7 +173,7 @@ func (m *ShardedMetrics) getShardIndex(name string) int {
 // 注意：
 //   - 如果指标已存在，Register 不会覆盖
 //   - 相同名称总是落入同一分片（确定性哈希）
-func (m *ShardedMetrics) Register(name string, init, step, min, max float64) {
+func (m *ShardedMetrics) Register(name string, init, step, min, max float64, opts ...Option) {
 	idx := m.getShardIndex(name)
 	shard := &m.shards[idx]
 	shard.mu.Lock()
@@ -181,6 +184,7 @@ func (m *ShardedMetrics) Register(name string, init, step, min, max float64) {
 		step:    step,
 		minVal:  min,
 		maxVal:  max,
+		desc:    newDesc(opts),
 	}
 	shard.mu.Unlock()
 }
@@ -384,6 +388,7 @@ func (m *ShardedMetrics) FlushAndReset() map[string]float64 {
 			result[name] = mt.accum
 			mt.accum = mt.initVal
 			mt.sent = mt.initVal
+			mt.epoch++
 		}
 		shard.mu.Unlock()
 	}
@@ -429,6 +434,7 @@ func (m *ShardedMetrics) Clear() {
 		for _, mt := range shard.data {
 			mt.accum = mt.initVal
 			mt.sent = mt.initVal
+			mt.epoch++
 		}
 		shard.mu.Unlock()
 	}
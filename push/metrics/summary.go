@@ -0,0 +1,334 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrSketchMismatch 表示合并的两个 Sketch 相对精度不同。
+var ErrSketchMismatch = errors.New("metrics: sketch accuracy mismatch")
+
+// Sketch 默认参数。
+const (
+	DefaultRelativeAccuracy = 0.01
+	DefaultMaxBins          = 2048
+)
+
+// DefaultObjectives 是 Summary 默认导出的分位数。
+var DefaultObjectives = []float64{0.5, 0.9, 0.99}
+
+// minIndexable 以下的观测值（含 0 与负数）计入零桶。
+const minIndexable = 1e-9
+
+/*
+Sketch 固定内存的流式分位数草图（DDSketch 算法）。
+
+原理：
+  - 以 γ = (1+α)/(1-α) 为底对观测值取对数，向上取整得到桶号
+  - 同一桶内的值相对误差不超过 α，因此任意分位数的估算值相对误差 ≤ α
+  - 桶连续存储，超过 maxBins 时合并最低的桶，只影响最低分位数的精度
+
+特性：
+  - 内存固定：最多 maxBins 个 uint64 计数
+  - 可合并：相同 α 的草图逐桶相加即可，结果与直接记录全部观测值一致
+  - 适用于延迟等非负量；≤ 1e-9 的值（含负数）计入零桶，估算为 0
+
+线程安全：Sketch 本身不是线程安全的，并发场景请使用 Summary。
+*/
+type Sketch struct {
+	alpha   float64
+	gamma   float64
+	lnGamma float64
+	maxBins int
+
+	offset int      // bins[0] 对应的桶号
+	bins   []uint64 // 连续桶计数
+	zero   uint64   // 零桶计数
+	count  uint64
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// NewSketch 创建相对精度为 alpha（0 < alpha < 1）、最多 maxBins 个桶的草图。
+// 参数越界时使用 DefaultRelativeAccuracy 与 DefaultMaxBins。
+func NewSketch(alpha float64, maxBins int) *Sketch {
+	if !(alpha > 0 && alpha < 1) {
+		alpha = DefaultRelativeAccuracy
+	}
+	if maxBins <= 0 {
+		maxBins = DefaultMaxBins
+	}
+	gamma := (1 + alpha) / (1 - alpha)
+	return &Sketch{alpha: alpha, gamma: gamma, lnGamma: math.Log(gamma), maxBins: maxBins}
+}
+
+// Add 记录一个观测值，NaN 与 ±Inf 被忽略。
+func (s *Sketch) Add(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	if s.lnGamma == 0 {
+		*s = *NewSketch(0, 0)
+	}
+	if v > minIndexable {
+		s.addKey(int(math.Ceil(math.Log(v)/s.lnGamma)), 1)
+	} else {
+		s.zero++
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+}
+
+// addKey 向桶 k 加 n，必要时扩展或合并最低的桶。
+func (s *Sketch) addKey(k int, n uint64) {
+	if len(s.bins) == 0 {
+		s.offset = k
+		s.bins = append(s.bins[:0], n)
+		return
+	}
+	lo, hi := min(k, s.offset), max(k, s.offset+len(s.bins)-1)
+	if hi-lo+1 > s.maxBins {
+		lo = hi - s.maxBins + 1
+	}
+	if lo != s.offset || hi != s.offset+len(s.bins)-1 {
+		bins := make([]uint64, hi-lo+1)
+		for i, c := range s.bins {
+			bins[max(s.offset+i, lo)-lo] += c
+		}
+		s.offset, s.bins = lo, bins
+	}
+	s.bins[max(k, lo)-lo] += n
+}
+
+// value 返回桶 k 的代表值，使桶内相对误差最小。
+func (s *Sketch) value(k int) float64 {
+	return 2 * math.Pow(s.gamma, float64(k)) / (s.gamma + 1)
+}
+
+// Quantile 估算 q 分位数（0 ≤ q ≤ 1），结果限制在 [Min, Max] 内。
+// 无观测值时返回 NaN。
+func (s *Sketch) Quantile(q float64) float64 {
+	if s.count == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return s.min
+	}
+	if q >= 1 {
+		return s.max
+	}
+	rank := q * float64(s.count-1)
+	n := float64(s.zero)
+	if n > rank {
+		return min(max(0, s.min), s.max)
+	}
+	for i, c := range s.bins {
+		n += float64(c)
+		if n > rank {
+			return min(max(s.value(s.offset+i), s.min), s.max)
+		}
+	}
+	return s.max
+}
+
+// Count 返回观测值个数。
+func (s *Sketch) Count() uint64 { return s.count }
+
+// Sum 返回观测值之和。
+func (s *Sketch) Sum() float64 { return s.sum }
+
+// Min 返回最小观测值，无观测值时返回 NaN。
+func (s *Sketch) Min() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.min
+}
+
+// Max 返回最大观测值，无观测值时返回 NaN。
+func (s *Sketch) Max() float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	return s.max
+}
+
+// RelativeAccuracy 返回相对精度 α。
+func (s *Sketch) RelativeAccuracy() float64 { return s.alpha }
+
+// Merge 将 o 合并到 s。零值 Sketch 采用 o 的参数；
+// 相对精度不同时返回 ErrSketchMismatch，s 不变。
+func (s *Sketch) Merge(o *Sketch) error {
+	if o == nil || o.count == 0 {
+		return nil
+	}
+	if s.lnGamma == 0 {
+		*s = *NewSketch(o.alpha, o.maxBins)
+	}
+	if s.alpha != o.alpha {
+		return ErrSketchMismatch
+	}
+	for i, c := range o.bins {
+		if c > 0 {
+			s.addKey(o.offset+i, c)
+		}
+	}
+	if s.count == 0 || o.min < s.min {
+		s.min = o.min
+	}
+	if s.count == 0 || o.max > s.max {
+		s.max = o.max
+	}
+	s.zero += o.zero
+	s.count += o.count
+	s.sum += o.sum
+	return nil
+}
+
+// Clone 返回深拷贝。
+func (s *Sketch) Clone() *Sketch {
+	c := *s
+	c.bins = slices.Clone(s.bins)
+	return &c
+}
+
+// Reset 清空观测值，保留参数。
+func (s *Sketch) Reset() {
+	s.offset, s.bins = 0, s.bins[:0]
+	s.zero, s.count, s.sum, s.min, s.max = 0, 0, 0, 0, 0
+}
+
+// sketchJSON 是 Sketch 的序列化格式，便于跨进程推送后合并。
+type sketchJSON struct {
+	Alpha   float64  `json:"alpha"`
+	MaxBins int      `json:"maxBins"`
+	Offset  int      `json:"offset"`
+	Bins    []uint64 `json:"bins"`
+	Zero    uint64   `json:"zero"`
+	Count   uint64   `json:"count"`
+	Sum     float64  `json:"sum"`
+	Min     float64  `json:"min"`
+	Max     float64  `json:"max"`
+}
+
+// MarshalJSON 实现 json.Marshaler。
+func (s *Sketch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(sketchJSON{
+		Alpha: s.alpha, MaxBins: s.maxBins, Offset: s.offset, Bins: s.bins,
+		Zero: s.zero, Count: s.count, Sum: s.sum, Min: s.min, Max: s.max,
+	})
+}
+
+// UnmarshalJSON 实现 json.Unmarshaler。
+func (s *Sketch) UnmarshalJSON(data []byte) error {
+	var j sketchJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*s = *NewSketch(j.Alpha, j.MaxBins)
+	s.offset, s.bins = j.Offset, j.Bins
+	s.zero, s.count, s.sum, s.min, s.max = j.Zero, j.Count, j.Sum, j.Min, j.Max
+	return nil
+}
+
+// SummaryOpts 摘要配置。
+type SummaryOpts struct {
+	Name             string    // 导出名称
+	Help             string    // HELP 说明
+	Labels           []Label   // 固定标签
+	Objectives       []float64 // 导出的分位数，为空时使用 DefaultObjectives
+	RelativeAccuracy float64   // Sketch 相对精度，0 表示 DefaultRelativeAccuracy
+	MaxBins          int       // Sketch 桶数上限，0 表示 DefaultMaxBins
+}
+
+// Summary 基于 Sketch 的流式分位数摘要，内存固定且快照可合并。
+// 所有方法都是线程安全的。
+//
+// 使用示例：
+//
+//	s := metrics.NewSummary(metrics.SummaryOpts{Name: "ssh_exec_seconds"})
+//	s.ObserveDuration(time.Since(start))
+//	p99 := s.Snapshot().Quantile(0.99)
+type Summary struct {
+	name       string
+	help       string
+	labels     []Label
+	objectives []float64
+
+	mu sync.Mutex
+	sk *Sketch
+}
+
+// NewSummary 创建摘要。
+func NewSummary(opts SummaryOpts) *Summary {
+	objectives := opts.Objectives
+	if len(objectives) == 0 {
+		objectives = DefaultObjectives
+	}
+	objectives = slices.Clone(objectives)
+	slices.Sort(objectives)
+	return &Summary{
+		name:       opts.Name,
+		help:       opts.Help,
+		labels:     sanitizeLabels(opts.Labels),
+		objectives: slices.Compact(objectives),
+		sk:         NewSketch(opts.RelativeAccuracy, opts.MaxBins),
+	}
+}
+
+// Observe 记录一个观测值。
+func (s *Summary) Observe(v float64) {
+	s.mu.Lock()
+	s.sk.Add(v)
+	s.mu.Unlock()
+}
+
+// ObserveDuration 以秒为单位记录耗时。
+func (s *Summary) ObserveDuration(d time.Duration) {
+	s.Observe(d.Seconds())
+}
+
+// Snapshot 返回自创建或上次 FlushAndReset 以来的草图副本。
+func (s *Summary) Snapshot() *Sketch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sk.Clone()
+}
+
+// FlushAndReset 返回自上次 FlushAndReset 以来的草图并清空，语义同 Histogram.FlushAndReset。
+func (s *Summary) FlushAndReset() *Sketch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.sk
+	s.sk = NewSketch(out.alpha, out.maxBins)
+	return out
+}
+
+// Gather 以 {quantile=...}、_sum、_count 导出。
+func (s *Summary) Gather() []Family {
+	sk := s.Snapshot()
+	samples := make([]Sample, 0, len(s.objectives)+2)
+	for _, q := range s.objectives {
+		samples = append(samples, Sample{
+			Labels: withLabel(s.labels, "quantile", strconv.FormatFloat(q, 'g', -1, 64)),
+			Value:  sk.Quantile(q),
+		})
+	}
+	samples = append(samples,
+		Sample{Suffix: "_sum", Labels: s.labels, Value: sk.Sum()},
+		Sample{Suffix: "_count", Labels: s.labels, Value: float64(sk.Count())},
+	)
+	return []Family{{Name: s.name, Help: s.help, Type: TypeSummary, Samples: samples}}
+}
@@ -0,0 +1,178 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaxSeries 是 VecOpts.MaxSeries 为 0 时每个指标族的序列上限。
+const DefaultMaxSeries = 1000
+
+// OverflowValue 是溢出序列的标签值。序列数达到上限后，新的标签组合
+// 全部计入所有标签值均为 OverflowValue 的溢出序列。
+const OverflowValue = "__overflow__"
+
+// VecOpts 带标签指标族的配置。
+type VecOpts struct {
+	Name       string   // 指标族名称
+	Help       string   // HELP 说明
+	LabelNames []string // 标签名，With 的参数按此顺序给出标签值
+	MaxSeries  int      // 序列数上限（不含溢出序列），0 表示 DefaultMaxSeries
+}
+
+// vec 是 CounterVec 与 GaugeVec 的公共实现。
+// 每个序列以 `name{k="v",...}` 为键注册到所属 ShardedMetrics，
+// 因此 Flush/Snapshot/Gather 均能看到这些序列。
+type vec struct {
+	m        *ShardedMetrics
+	opts     VecOpts
+	typ      Type
+	min, max float64
+
+	mu       sync.RWMutex
+	series   map[string]*series // key 为以 0xff 连接的标签值
+	overflow *series
+	dropped  atomic.Uint64
+}
+
+func newVec(m *ShardedMetrics, opts VecOpts, typ Type, min, max float64) *vec {
+	if opts.MaxSeries <= 0 {
+		opts.MaxSeries = DefaultMaxSeries
+	}
+	opts.LabelNames = append([]string(nil), opts.LabelNames...)
+	return &vec{m: m, opts: opts, typ: typ, min: min, max: max, series: make(map[string]*series)}
+}
+
+// with 返回标签值对应的序列句柄，首次出现时注册。
+// 标签值个数与 LabelNames 不一致时，缺少的按空串补齐，多余的被忽略。
+func (v *vec) with(values []string) *series {
+	values = v.normalize(values)
+	key := strings.Join(values, "\xff")
+
+	v.mu.RLock()
+	s := v.series[key]
+	v.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s = v.series[key]; s != nil {
+		return s
+	}
+	if len(v.series) >= v.opts.MaxSeries {
+		v.dropped.Add(1)
+		if v.overflow == nil {
+			ov := make([]string, len(v.opts.LabelNames))
+			for i := range ov {
+				ov[i] = OverflowValue
+			}
+			v.overflow = v.register(ov)
+		}
+		return v.overflow
+	}
+	s = v.register(values)
+	v.series[key] = s
+	return s
+}
+
+func (v *vec) normalize(values []string) []string {
+	n := len(v.opts.LabelNames)
+	if len(values) == n {
+		return values
+	}
+	out := make([]string, n)
+	copy(out, values)
+	return out
+}
+
+// register 在 ShardedMetrics 中登记序列；同名序列已存在时复用，
+// 因此同名的两个 Vec 共享序列。
+func (v *vec) register(values []string) *series {
+	kv := make([]string, 0, 2*len(values))
+	for i, name := range v.opts.LabelNames {
+		kv = append(kv, name, values[i])
+	}
+	desc := newDesc([]Option{WithFamily(v.opts.Name), WithHelp(v.opts.Help), WithType(v.typ), WithLabels(kv...)})
+	return v.m.series(seriesKey(v.opts.Name, desc.Labels), desc, v.min, v.max)
+}
+
+// seriesKey 生成序列在 ShardedMetrics 中的键，格式同 Prometheus 文本格式。
+func seriesKey(name string, labels []Label) string {
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, l := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.Name + `="` + escapeLabelValue(l.Value) + `"`)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Len 返回已创建的序列数（不含溢出序列）。
+func (v *vec) Len() int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	return len(v.series)
+}
+
+// Overflowed 返回因超出 MaxSeries 而计入溢出序列的标签组合查找次数。
+func (v *vec) Overflowed() uint64 {
+	return v.dropped.Load()
+}
+
+// CounterVec 带标签的计数器族，值只增不减。
+//
+// 使用示例：
+//
+//	rx := sm.NewCounterVec(metrics.VecOpts{Name: "rx_bytes_total", LabelNames: []string{"iface"}})
+//	eth0 := rx.With("eth0") // 缓存句柄，热路径上直接使用
+//	eth0.Add(1500)
+type CounterVec struct{ *vec }
+
+// NewCounterVec 创建带标签的计数器族。
+func (m *ShardedMetrics) NewCounterVec(opts VecOpts) *CounterVec {
+	return &CounterVec{newVec(m, opts, TypeCounter, 0, math.MaxFloat64)}
+}
+
+// With 返回标签值对应的计数器句柄。句柄可缓存复用；对同一序列键
+// 再次调用 ShardedMetrics.Register 会使已缓存的句柄失效。
+func (c *CounterVec) With(values ...string) *Counter {
+	return &Counter{c.with(values)}
+}
+
+// GaugeVec 带标签的瞬时值族，可增可减、可直接设值。
+type GaugeVec struct{ *vec }
+
+// NewGaugeVec 创建带标签的瞬时值族。
+func (m *ShardedMetrics) NewGaugeVec(opts VecOpts) *GaugeVec {
+	return &GaugeVec{newVec(m, opts, TypeGauge, math.Inf(-1), math.Inf(1))}
+}
+
+// With 返回标签值对应的瞬时值句柄，缓存规则同 CounterVec.With。
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return &Gauge{g.with(values)}
+}
+
+// FlushFamilies 与 Flush 相同，返回自上次 Flush 以来的增量并更新 sent，
+// 但按指标族分组并保留标签，不必再从 `name{k="v"}` 形式的键中解析标签。
+// 未设置导出元数据的普通指标作为无标签样本返回。
+func (m *ShardedMetrics) FlushFamilies() []Family {
+	fs := familySet{}
+	for i := range m.shards {
+		shard := &m.shards[i]
+		shard.mu.Lock()
+		for name, mt := range shard.data {
+			fs.add(name, mt.desc, mt.accum-mt.sent)
+			mt.sent = mt.accum
+		}
+		shard.mu.Unlock()
+	}
+	return fs.list()
+}
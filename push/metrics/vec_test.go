@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCounterVec_HandlesAndFlush(t *testing.T) {
+	sm := NewSharded()
+	rx := sm.NewCounterVec(VecOpts{Name: "rx_bytes_total", Help: "Received bytes.", LabelNames: []string{"iface", "dir"}})
+
+	eth0 := rx.With("eth0", "in")
+	if rx.With("eth0", "in").s != eth0.s {
+		t.Fatal("With did not return the cached series")
+	}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				rx.With("eth0", "in").Inc()
+			}
+		}()
+	}
+	wg.Wait()
+	eth0.Add(-5) // ignored
+	rx.With("eth1", "in").Add(2.5)
+
+	if got := sm.Get(`rx_bytes_total{dir="in",iface="eth0"}`); got != 800 {
+		t.Fatalf("flat key value = %v, want 800", got)
+	}
+	fams := sm.FlushFamilies()
+	if len(fams) != 1 || fams[0].Name != "rx_bytes_total" || fams[0].Type != TypeCounter || len(fams[0].Samples) != 2 {
+		t.Fatalf("families = %+v", fams)
+	}
+	for _, s := range fams[0].Samples {
+		if len(s.Labels) != 2 || s.Labels[0] != (Label{"dir", "in"}) {
+			t.Fatalf("labels = %+v", s.Labels)
+		}
+		want := map[string]float64{"eth0": 800, "eth1": 2.5}[s.Labels[1].Value]
+		if s.Value != want {
+			t.Fatalf("%s delta = %v, want %v", s.Labels[1].Value, s.Value, want)
+		}
+	}
+	eth0.Inc()
+	if d := sm.FlushFamilies()[0].Samples; d[0].Value+d[1].Value != 1 {
+		t.Fatalf("second flush = %+v, want a delta of 1", d)
+	}
+}
+
+func TestGaugeVec_Overflow(t *testing.T) {
+	sm := NewSharded()
+	conns := sm.NewGaugeVec(VecOpts{Name: "ws_conns", LabelNames: []string{"client"}, MaxSeries: 2})
+
+	conns.With("a").Set(3)
+	conns.With("b").Dec()
+	conns.With("c").Inc()
+	conns.With("d").Add(4)
+	conns.With("a").Inc()
+
+	if conns.Len() != 2 || conns.Overflowed() != 2 {
+		t.Fatalf("len = %d overflowed = %d", conns.Len(), conns.Overflowed())
+	}
+	if got := conns.With("zzz").Get(); got != 5 {
+		t.Fatalf("overflow series = %v, want 5", got)
+	}
+
+	body, _ := scrape(t, Handler(sm), "")
+	for _, line := range []string{
+		`# TYPE ws_conns gauge`,
+		`ws_conns{client="__overflow__"} 5`,
+		`ws_conns{client="a"} 4`,
+		`ws_conns{client="b"} -1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, body)
+		}
+	}
+}
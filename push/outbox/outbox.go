@@ -0,0 +1,712 @@
+// Package outbox provides a durable write-ahead outbox for async push delivery.
+//
+// Records are appended to segment files before they are queued, acknowledged
+// after the receiver answers 2xx, and replayed after a restart. Segments are
+// only deleted from the head once every record in them is acknowledged or
+// evicted, so disk usage can briefly exceed the logical backlog.
+//
+// Usage Example:
+//
+//	ob, err := outbox.Open("/var/lib/oam/outbox",
+//	    outbox.WithSync(outbox.SyncInterval),
+//	    outbox.WithMaxBytes(256<<20),
+//	    outbox.WithMaxAge(24*time.Hour),
+//	)
+//	if err != nil {
+//	    return err
+//	}
+//	defer ob.Close()
+//
+//	cli := client.New(client.WithOutbox(ob))
+//	defer cli.Close() // close the client before the outbox
+package outbox
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSegmentSize  = 16 << 20
+	defaultSyncInterval = time.Second
+	segmentExt          = ".seg"
+	frameHeaderSize     = 8 // length(4) + crc32c(4)
+)
+
+// Record types stored in segment files. Unknown types are skipped on replay,
+// so new types can be added without breaking older segments.
+const (
+	recData    byte = 1 // Delivery record: seq, time, timeout, url, body
+	recAck     byte = 2 // Acknowledgement or eviction of a delivery record: seq
+	recDataKey byte = 3 // Delivery record with an idempotency key: seq, time, timeout, url, key, body
+)
+
+var (
+	// ErrClosed is returned by operations on a closed outbox.
+	ErrClosed = errors.New("outbox: closed")
+	// ErrTooLarge is returned when a single record exceeds the MaxBytes cap.
+	ErrTooLarge = errors.New("outbox: record exceeds max bytes")
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// SyncPolicy controls when segment writes are flushed to stable storage.
+type SyncPolicy int
+
+const (
+	// SyncAlways fsyncs after every append and ack. Safest, slowest.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval fsyncs in the background every sync interval (default 1s).
+	// A crash may lose the records appended in the last interval.
+	SyncInterval
+	// SyncNone leaves flushing to the operating system.
+	SyncNone
+)
+
+// Entry is a pending delivery record.
+type Entry struct {
+	Seq     uint64        // Monotonic sequence number, used for Ack/Release
+	URL     string        // Destination URL
+	Key     string        // Idempotency key, empty when none was given
+	Body    []byte        // Encoded request body
+	Timeout time.Duration // Delivery timeout, 0 means the client default
+	Time    time.Time     // Time the record was appended
+}
+
+// Stats holds outbox backlog statistics.
+type Stats struct {
+	Records  int64 // Records not yet acknowledged
+	Bytes    int64 // On-disk size of unacknowledged records
+	Segments int   // Segment files on disk
+	Evicted  int64 // Records dropped by MaxBytes/MaxAge since Open
+}
+
+// Option configures an Outbox.
+type Option func(*Outbox)
+
+// WithSegmentSize sets the size at which the active segment is rotated.
+//
+// If not set, defaults to 16 MiB.
+func WithSegmentSize(n int64) Option {
+	return func(o *Outbox) {
+		if n > 0 {
+			o.segmentSize = n
+		}
+	}
+}
+
+// WithSync sets the fsync policy. If not set, defaults to SyncAlways.
+func WithSync(p SyncPolicy) Option {
+	return func(o *Outbox) { o.sync = p }
+}
+
+// WithSyncInterval sets the flush interval used by SyncInterval.
+//
+// If not set, defaults to 1 second.
+func WithSyncInterval(d time.Duration) Option {
+	return func(o *Outbox) {
+		if d > 0 {
+			o.syncInterval = d
+		}
+	}
+}
+
+// WithMaxBytes caps the unacknowledged backlog size. When an append would
+// exceed the cap, the oldest records are evicted first. 0 means unlimited.
+func WithMaxBytes(n int64) Option {
+	return func(o *Outbox) {
+		if n >= 0 {
+			o.maxBytes = n
+		}
+	}
+}
+
+// WithMaxAge evicts records older than d on append and claim. 0 means unlimited.
+func WithMaxAge(d time.Duration) Option {
+	return func(o *Outbox) {
+		if d >= 0 {
+			o.maxAge = d
+		}
+	}
+}
+
+type segment struct {
+	first uint64 // First sequence number, also the file name
+	path  string
+	f     *os.File
+	size  int64
+	live  int // Unacknowledged data records in this segment
+}
+
+type item struct {
+	seq      uint64
+	seg      *segment
+	off      int64  // Frame offset within the segment
+	size     int64  // Frame size including header
+	ts       int64  // Append time, Unix nanoseconds
+	url      string // Destination URL, indexed for ClaimFunc
+	inflight bool   // Handed out by Append/Claim and not yet released
+	dead     bool   // Acknowledged or evicted
+}
+
+// Outbox is a segmented write-ahead log of pending push records.
+//
+// Thread-safe for concurrent use.
+type Outbox struct {
+	dir          string
+	segmentSize  int64
+	sync         SyncPolicy
+	syncInterval time.Duration
+	maxBytes     int64
+	maxAge       time.Duration
+
+	mu      sync.Mutex
+	segs    []*segment
+	active  *segment
+	items   map[uint64]*item
+	order   []*item // Live items in sequence order; dead items are trimmed from the head
+	nextSeq uint64
+	bytes   int64
+	evicted int64
+	dirty   bool
+	closed  bool
+	urls    map[string]string // Interned record URLs, only used while loading
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// Open opens or creates an outbox in dir and replays its segments.
+//
+// Records that were appended but not acknowledged before the previous
+// shutdown become pending again and are returned by Claim. A torn frame at
+// the tail of the last segment (from a crash mid-write) is truncated.
+func Open(dir string, opts ...Option) (*Outbox, error) {
+	o := &Outbox{
+		dir:          dir,
+		segmentSize:  defaultSegmentSize,
+		sync:         SyncAlways,
+		syncInterval: defaultSyncInterval,
+		items:        make(map[uint64]*item),
+		nextSeq:      1,
+		stopCh:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("outbox: create dir: %w", err)
+	}
+	err := o.load()
+	o.urls = nil
+	if err != nil {
+		o.closeFiles()
+		return nil, err
+	}
+
+	if o.sync == SyncInterval {
+		o.wg.Add(1)
+		go o.syncLoop()
+	}
+	return o, nil
+}
+
+// Append persists a delivery record and returns its sequence number.
+//
+// The record is handed out to the caller (in flight) and will not be
+// returned by Claim until it is released with Release. Call Ack after a
+// successful delivery.
+func (o *Outbox) Append(url string, body []byte, timeout time.Duration) (uint64, error) {
+	return o.AppendKey(url, "", body, timeout)
+}
+
+// AppendKey is like Append and also persists the idempotency key of the
+// record, returned as Entry.Key on replay.
+func (o *Outbox) AppendKey(url, key string, body []byte, timeout time.Duration) (uint64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return 0, ErrClosed
+	}
+
+	// Rotate first: starting a segment may advance nextSeq.
+	if err := o.maybeRotateLocked(); err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixNano()
+	seq := o.nextSeq
+	var frame []byte
+	if key == "" {
+		frame = encodeFrame(recData, appendData(nil, seq, now, timeout, url, "", body))
+	} else {
+		frame = encodeFrame(recDataKey, appendData(nil, seq, now, timeout, url, key, body))
+	}
+	size := int64(len(frame))
+	if o.maxBytes > 0 && size > o.maxBytes {
+		return 0, ErrTooLarge
+	}
+	if err := o.evictLocked(now, size); err != nil {
+		return 0, err
+	}
+
+	off, err := o.writeLocked(frame)
+	if err != nil {
+		return 0, err
+	}
+
+	o.nextSeq++
+	it := &item{seq: seq, seg: o.active, off: off, size: size, ts: now, url: url, inflight: true}
+	o.items[seq] = it
+	o.order = append(o.order, it)
+	o.active.live++
+	o.bytes += size
+	return seq, nil
+}
+
+// Ack marks a record as delivered. Unknown or already evicted sequence
+// numbers are ignored.
+func (o *Outbox) Ack(seq uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return ErrClosed
+	}
+	it, ok := o.items[seq]
+	if !ok {
+		return nil
+	}
+	if err := o.dropLocked(it); err != nil {
+		return err
+	}
+	return o.trimLocked()
+}
+
+// Release returns an in-flight record to the pending set after a failed
+// delivery, making it eligible for Claim again.
+func (o *Outbox) Release(seq uint64) {
+	o.mu.Lock()
+	if it, ok := o.items[seq]; ok {
+		it.inflight = false
+	}
+	o.mu.Unlock()
+}
+
+// Claim returns up to max pending records, oldest first, and marks them in
+// flight. Each returned record must be passed to Ack or Release.
+func (o *Outbox) Claim(max int) ([]Entry, error) {
+	return o.ClaimFunc(max, nil)
+}
+
+// ClaimFunc is like Claim but skips pending records whose URL is rejected
+// by accept, leaving them pending. A nil accept claims every record.
+func (o *Outbox) ClaimFunc(max int, accept func(url string) bool) ([]Entry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.closed {
+		return nil, ErrClosed
+	}
+	if err := o.evictLocked(time.Now().UnixNano(), 0); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, it := range o.order {
+		if len(entries) >= max {
+			break
+		}
+		if it.dead || it.inflight || (accept != nil && !accept(it.url)) {
+			continue
+		}
+		e, err := o.readLocked(it)
+		if err != nil {
+			return entries, err
+		}
+		it.inflight = true
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// Pending returns the number of unacknowledged records, including in-flight ones.
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.items)
+}
+
+// Stats returns current backlog statistics.
+func (o *Outbox) Stats() Stats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return Stats{
+		Records:  int64(len(o.items)),
+		Bytes:    o.bytes,
+		Segments: len(o.segs),
+		Evicted:  o.evicted,
+	}
+}
+
+// Close flushes and closes all segment files. Safe to call multiple times.
+//
+// Close the client that uses the outbox first so in-flight records are
+// acknowledged or released before the files are closed.
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	if o.closed {
+		o.mu.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.mu.Unlock()
+
+	close(o.stopCh)
+	o.wg.Wait()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var err error
+	if o.active != nil && o.sync != SyncNone {
+		err = o.active.f.Sync()
+	}
+	if cerr := o.closeFiles(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ============================================================================
+// Internal
+// ============================================================================
+
+// load scans existing segments in order and rebuilds the pending index.
+func (o *Outbox) load() error {
+	names, err := filepath.Glob(filepath.Join(o.dir, "*"+segmentExt))
+	if err != nil {
+		return fmt.Errorf("outbox: list segments: %w", err)
+	}
+	sort.Strings(names)
+
+	for i, path := range names {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("outbox: open segment: %w", err)
+		}
+		seg := &segment{first: first, path: path, f: f}
+		o.segs = append(o.segs, seg)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("outbox: read segment: %w", err)
+		}
+		valid := o.scan(seg, data)
+		seg.size = valid
+		if valid < int64(len(data)) && i == len(names)-1 {
+			// Torn write at the tail: drop the partial frame so appends stay aligned.
+			if err := f.Truncate(valid); err != nil {
+				return fmt.Errorf("outbox: truncate segment: %w", err)
+			}
+		}
+		if first >= o.nextSeq {
+			o.nextSeq = first
+		}
+	}
+
+	if n := len(o.segs); n > 0 && o.segs[n-1].size < o.segmentSize {
+		o.active = o.segs[n-1]
+	} else if err := o.rotateLocked(o.nextSeq); err != nil {
+		return err
+	}
+	return o.trimLocked()
+}
+
+// scan indexes the frames in data and returns the length of the valid prefix.
+func (o *Outbox) scan(seg *segment, data []byte) int64 {
+	var off int64
+	for int64(len(data))-off >= frameHeaderSize {
+		n := int64(binary.BigEndian.Uint32(data[off:]))
+		sum := binary.BigEndian.Uint32(data[off+4:])
+		end := off + frameHeaderSize + n
+		if n == 0 || end > int64(len(data)) {
+			break
+		}
+		payload := data[off+frameHeaderSize : end]
+		if crc32.Checksum(payload, crcTable) != sum {
+			break
+		}
+
+		switch payload[0] {
+		case recData, recDataKey:
+			if e, ok := decodeData(payload[0], payload[1:]); ok {
+				seq := e.Seq
+				it := &item{seq: seq, seg: seg, off: off, size: end - off, ts: e.Time.UnixNano(), url: o.intern(e.URL)}
+				o.items[seq] = it
+				o.order = append(o.order, it)
+				seg.live++
+				o.bytes += it.size
+				if seq >= o.nextSeq {
+					o.nextSeq = seq + 1
+				}
+			}
+		case recAck:
+			if len(payload) >= 9 {
+				if it, ok := o.items[binary.BigEndian.Uint64(payload[1:])]; ok {
+					o.removeLocked(it)
+				}
+			}
+		}
+		off = end
+	}
+	return off
+}
+
+// intern returns a shared copy of url so replayed records for the same
+// destination do not each hold their own string.
+func (o *Outbox) intern(url string) string {
+	if s, ok := o.urls[url]; ok {
+		return s
+	}
+	if o.urls == nil {
+		o.urls = make(map[string]string)
+	}
+	o.urls[url] = url
+	return url
+}
+
+// evictLocked drops records older than maxAge, then the oldest records until
+// incoming more bytes fit under maxBytes.
+func (o *Outbox) evictLocked(now, incoming int64) error {
+	for len(o.order) > 0 {
+		it := o.order[0]
+		expired := o.maxAge > 0 && now-it.ts > int64(o.maxAge)
+		full := o.maxBytes > 0 && o.bytes+incoming > o.maxBytes
+		if !expired && !full {
+			break
+		}
+		if err := o.dropLocked(it); err != nil {
+			return err
+		}
+		o.evicted++
+	}
+	return o.trimLocked()
+}
+
+// dropLocked writes an ack record for it and removes it from the index.
+func (o *Outbox) dropLocked(it *item) error {
+	var body [8]byte
+	binary.BigEndian.PutUint64(body[:], it.seq)
+	if err := o.maybeRotateLocked(); err != nil {
+		return err
+	}
+	if _, err := o.writeLocked(encodeFrame(recAck, body[:])); err != nil {
+		return err
+	}
+	o.removeLocked(it)
+	return nil
+}
+
+func (o *Outbox) removeLocked(it *item) {
+	it.dead = true
+	delete(o.items, it.seq)
+	it.seg.live--
+	o.bytes -= it.size
+	for len(o.order) > 0 && o.order[0].dead {
+		o.order[0] = nil
+		o.order = o.order[1:]
+	}
+}
+
+// trimLocked deletes fully acknowledged segments from the head.
+func (o *Outbox) trimLocked() error {
+	for len(o.segs) > 0 && o.segs[0] != o.active && o.segs[0].live == 0 {
+		seg := o.segs[0]
+		_ = seg.f.Close()
+		if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("outbox: remove segment: %w", err)
+		}
+		o.segs[0] = nil
+		o.segs = o.segs[1:]
+	}
+	return nil
+}
+
+// maybeRotateLocked starts a new segment once the active one reaches
+// segmentSize. Both data and ack frames go through it, so ack-heavy segments
+// are bounded too.
+func (o *Outbox) maybeRotateLocked() error {
+	if o.active.size < o.segmentSize {
+		return nil
+	}
+	return o.rotateLocked(o.nextSeq)
+}
+
+// rotateLocked seals the active segment and starts a new one named after first.
+// first must be nextSeq, which may be advanced to keep segment names unique.
+func (o *Outbox) rotateLocked(first uint64) error {
+	// A segment holding only acks is named after the next sequence number
+	// too; skip one so the new file does not reuse its name.
+	if n := len(o.segs); n > 0 && o.segs[n-1].first >= first {
+		first = o.segs[n-1].first + 1
+		o.nextSeq = max(o.nextSeq, first)
+	}
+	if o.active != nil && o.sync != SyncNone {
+		if err := o.active.f.Sync(); err != nil {
+			return fmt.Errorf("outbox: sync segment: %w", err)
+		}
+	}
+	path := filepath.Join(o.dir, fmt.Sprintf("%020d%s", first, segmentExt))
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("outbox: create segment: %w", err)
+	}
+	seg := &segment{first: first, path: path, f: f}
+	o.segs = append(o.segs, seg)
+	o.active = seg
+	return nil
+}
+
+// writeLocked appends frame to the active segment and applies the sync policy.
+func (o *Outbox) writeLocked(frame []byte) (int64, error) {
+	off := o.active.size
+	if _, err := o.active.f.Write(frame); err != nil {
+		return 0, fmt.Errorf("outbox: write segment: %w", err)
+	}
+	o.active.size += int64(len(frame))
+	switch o.sync {
+	case SyncAlways:
+		if err := o.active.f.Sync(); err != nil {
+			return 0, fmt.Errorf("outbox: sync segment: %w", err)
+		}
+	case SyncInterval:
+		o.dirty = true
+	}
+	return off, nil
+}
+
+func (o *Outbox) readLocked(it *item) (Entry, error) {
+	frame := make([]byte, it.size)
+	if _, err := it.seg.f.ReadAt(frame, it.off); err != nil {
+		return Entry{}, fmt.Errorf("outbox: read record %d: %w", it.seq, err)
+	}
+	e, ok := decodeData(frame[frameHeaderSize], frame[frameHeaderSize+1:])
+	if !ok {
+		return Entry{}, fmt.Errorf("outbox: corrupt record %d", it.seq)
+	}
+	return e, nil
+}
+
+func (o *Outbox) syncLoop() {
+	defer o.wg.Done()
+	ticker := time.NewTicker(o.syncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-o.stopCh:
+			return
+		case <-ticker.C:
+			o.mu.Lock()
+			if o.dirty && !o.closed {
+				_ = o.active.f.Sync()
+				o.dirty = false
+			}
+			o.mu.Unlock()
+		}
+	}
+}
+
+func (o *Outbox) closeFiles() error {
+	var err error
+	for _, seg := range o.segs {
+		if cerr := seg.f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// ============================================================================
+// Record encoding
+// ============================================================================
+
+// encodeFrame wraps a typed record as length(4) | crc32c(4) | type(1) | body.
+func encodeFrame(typ byte, body []byte) []byte {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+1+len(body))
+	frame = append(frame, typ)
+	frame = append(frame, body...)
+	payload := frame[frameHeaderSize:]
+	binary.BigEndian.PutUint32(frame[0:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(frame[4:], crc32.Checksum(payload, crcTable))
+	return frame
+}
+
+// appendData encodes a data record body: seq(8) | time(8) | timeout(8) | uvarint url length | url | body.
+// A non-empty key is written after the url as uvarint key length | key, for
+// recDataKey records.
+func appendData(dst []byte, seq uint64, ts int64, timeout time.Duration, url, key string, body []byte) []byte {
+	dst = binary.BigEndian.AppendUint64(dst, seq)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(ts))
+	dst = binary.BigEndian.AppendUint64(dst, uint64(timeout))
+	dst = binary.AppendUvarint(dst, uint64(len(url)))
+	dst = append(dst, url...)
+	if key != "" {
+		dst = binary.AppendUvarint(dst, uint64(len(key)))
+		dst = append(dst, key...)
+	}
+	return append(dst, body...)
+}
+
+func decodeDataHeader(b []byte) (seq uint64, ts int64, ok bool) {
+	if len(b) < 24 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(b), int64(binary.BigEndian.Uint64(b[8:])), true
+}
+
+// decodeData decodes a recData or recDataKey record body.
+func decodeData(typ byte, b []byte) (Entry, bool) {
+	seq, ts, ok := decodeDataHeader(b)
+	if !ok {
+		return Entry{}, false
+	}
+	e := Entry{
+		Seq:     seq,
+		Timeout: time.Duration(binary.BigEndian.Uint64(b[16:])),
+		Time:    time.Unix(0, ts),
+	}
+	b = b[24:]
+
+	url, b, ok := decodeString(b)
+	if !ok {
+		return Entry{}, false
+	}
+	e.URL = url
+	if typ == recDataKey {
+		if e.Key, b, ok = decodeString(b); !ok {
+			return Entry{}, false
+		}
+	}
+	e.Body = b
+	return e, true
+}
+
+// decodeString decodes a uvarint length-prefixed string and returns the rest of b.
+func decodeString(b []byte) (string, []byte, bool) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || uint64(len(b)-k) < n {
+		return "", nil, false
+	}
+	return string(b[k : k+int(n)]), b[k+int(n):], true
+}
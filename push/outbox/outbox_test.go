@@ -0,0 +1,281 @@
+package outbox
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustOpen(t *testing.T, dir string, opts ...Option) *Outbox {
+	t.Helper()
+	o, err := Open(dir, opts...)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = o.Close() })
+	return o
+}
+
+func TestOutbox_ReplayAfterReopen(t *testing.T) {
+	dir := t.TempDir()
+	o := mustOpen(t, dir)
+
+	var seqs []uint64
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		seq, err := o.Append("http://nms/push", []byte(body), 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	if err := o.Ack(seqs[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	o = mustOpen(t, dir)
+	entries, err := o.Claim(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Seq != seqs[0] || entries[1].Seq != seqs[2] {
+		t.Fatalf("entries = %+v, want seq %d and %d", entries, seqs[0], seqs[2])
+	}
+	e := entries[1]
+	if e.URL != "http://nms/push" || string(e.Body) != `{"n":3}` || e.Timeout != 5*time.Second {
+		t.Fatalf("entry = %+v", e)
+	}
+
+	// New sequence numbers continue after the replayed ones
+	seq, err := o.Append("http://nms/push", []byte(`{}`), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq <= seqs[2] {
+		t.Fatalf("seq after reopen = %d, want > %d", seq, seqs[2])
+	}
+}
+
+func TestOutbox_KeyedRecordsSurviveReopen(t *testing.T) {
+	dir := t.TempDir()
+	o := mustOpen(t, dir)
+	if _, err := o.AppendKey("http://nms/push", "rec-1", []byte(`{"id":"rec-1"}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Append("http://nms/push", []byte(`{}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	o = mustOpen(t, dir)
+	entries, err := o.Claim(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want 2", entries)
+	}
+	if e := entries[0]; e.Key != "rec-1" || e.URL != "http://nms/push" || string(e.Body) != `{"id":"rec-1"}` {
+		t.Fatalf("keyed entry = %+v", e)
+	}
+	if e := entries[1]; e.Key != "" || string(e.Body) != `{}` {
+		t.Fatalf("plain entry = %+v", e)
+	}
+}
+
+func TestOutbox_ClaimSkipsInFlight(t *testing.T) {
+	o := mustOpen(t, t.TempDir(), WithSync(SyncNone))
+
+	seq, _ := o.Append("u", []byte("a"), 0)
+	if entries, _ := o.Claim(10); len(entries) != 0 {
+		t.Fatalf("claimed in-flight record: %+v", entries)
+	}
+	o.Release(seq)
+	entries, _ := o.Claim(10)
+	if len(entries) != 1 || entries[0].Seq != seq {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if entries, _ := o.Claim(10); len(entries) != 0 {
+		t.Fatalf("claimed twice: %+v", entries)
+	}
+}
+
+func TestOutbox_ClaimFuncFiltersByURL(t *testing.T) {
+	dir := t.TempDir()
+	o := mustOpen(t, dir)
+	for _, url := range []string{"http://down/push", "http://up/push", "http://down/push"} {
+		seq, err := o.Append(url, []byte(`{}`), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Release(seq)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// URLs are indexed on reopen as well as on append
+	o = mustOpen(t, dir)
+	up := func(url string) bool { return url != "http://down/push" }
+	entries, err := o.ClaimFunc(10, up)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].URL != "http://up/push" {
+		t.Fatalf("entries = %+v, want only the up record", entries)
+	}
+	if entries, _ = o.Claim(10); len(entries) != 2 {
+		t.Fatalf("skipped records claimed = %d, want 2", len(entries))
+	}
+}
+
+func TestOutbox_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	o := mustOpen(t, dir)
+	seq, _ := o.Append("u", []byte("complete"), 0)
+	_ = o.Close()
+
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	f, err := os.OpenFile(names[len(names)-1], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0, 40, 1, 2, 3})
+	_ = f.Close()
+
+	o = mustOpen(t, dir)
+	if _, err := o.Append("u", []byte("next"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = o.Close()
+
+	o = mustOpen(t, dir)
+	entries, _ := o.Claim(10)
+	if len(entries) != 2 || entries[0].Seq != seq || string(entries[1].Body) != "next" {
+		t.Fatalf("entries = %+v", entries)
+	}
+}
+
+func TestOutbox_MaxBytesEvictsOldest(t *testing.T) {
+	body := make([]byte, 100)
+	o := mustOpen(t, t.TempDir(), WithMaxBytes(350))
+
+	var seqs []uint64
+	for range 5 {
+		seq, err := o.Append("u", body, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	st := o.Stats()
+	if st.Bytes > 350 || st.Records != 2 || st.Evicted != 3 {
+		t.Fatalf("stats = %+v", st)
+	}
+	for _, seq := range seqs[3:] {
+		o.Release(seq)
+	}
+	entries, _ := o.Claim(10)
+	if len(entries) != 2 || entries[0].Seq != seqs[3] {
+		t.Fatalf("entries = %+v, want newest two", entries)
+	}
+
+	if _, err := o.Append("u", make([]byte, 400), 0); err != ErrTooLarge {
+		t.Fatalf("err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestOutbox_MaxAgeEvicts(t *testing.T) {
+	o := mustOpen(t, t.TempDir(), WithMaxAge(20*time.Millisecond))
+	seq, _ := o.Append("u", []byte("old"), 0)
+	o.Release(seq)
+	time.Sleep(40 * time.Millisecond)
+
+	if entries, _ := o.Claim(10); len(entries) != 0 {
+		t.Fatalf("expired record claimed: %+v", entries)
+	}
+	if st := o.Stats(); st.Records != 0 || st.Evicted != 1 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestOutbox_DeletesAckedHeadSegments(t *testing.T) {
+	dir := t.TempDir()
+	o := mustOpen(t, dir, WithSegmentSize(64), WithSync(SyncNone))
+
+	var seqs []uint64
+	for range 4 {
+		seq, _ := o.Append("u", make([]byte, 64), 0)
+		seqs = append(seqs, seq)
+	}
+	if n := o.Stats().Segments; n != 4 {
+		t.Fatalf("segments = %d, want 4", n)
+	}
+
+	// Acked middle segments stay until the head is cleared. The full active
+	// segment rotates before the ack is written.
+	_ = o.Ack(seqs[1])
+	if n := o.Stats().Segments; n != 5 {
+		t.Fatalf("segments after middle ack = %d, want 5", n)
+	}
+	_ = o.Ack(seqs[0])
+	if n := o.Stats().Segments; n != 3 {
+		t.Fatalf("segments after head ack = %d, want 3", n)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if len(names) != 3 {
+		t.Fatalf("segment files = %v", names)
+	}
+}
+
+func TestOutbox_AcksRotateSegments(t *testing.T) {
+	dir := t.TempDir()
+	o := mustOpen(t, dir, WithSegmentSize(256), WithSync(SyncNone))
+
+	// Many small records kept alive by an unacked head: the ack frames for
+	// the rest must not grow a single segment without bound.
+	var seqs []uint64
+	for range 200 {
+		seq, err := o.Append("u", []byte("x"), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, seq)
+	}
+	for _, seq := range seqs[1:] {
+		if err := o.Ack(seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// One frame past the threshold at most.
+		if fi.Size() > 256+64 {
+			t.Fatalf("%s is %d bytes, want about 256", filepath.Base(name), fi.Size())
+		}
+	}
+
+	// Segments made of acks only must not clash with later appends.
+	next, err := o.Append("u", []byte("z"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+	o = mustOpen(t, dir, WithSegmentSize(256), WithSync(SyncNone))
+	entries, _ := o.Claim(10)
+	if len(entries) != 2 || entries[0].Seq != seqs[0] || entries[1].Seq != next || string(entries[1].Body) != "z" {
+		t.Fatalf("after reopen = %+v, want the head record and %d", entries, next)
+	}
+	if seq, _ := o.Append("u", nil, 0); seq <= next {
+		t.Fatalf("sequence went back to %d after reopen", seq)
+	}
+}
@@ -1,12 +1,20 @@
 package push
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"net/http"
+	"sync"
 	"time"
 
+	"github.com/tsmask/go-oam/pkg/generate"
+	"github.com/tsmask/go-oam/push/auth"
 	"github.com/tsmask/go-oam/push/client"
 	"github.com/tsmask/go-oam/push/history"
 	"github.com/tsmask/go-oam/push/metrics"
+	"github.com/tsmask/go-oam/push/outbox"
+	"github.com/tsmask/go-oam/push/schema"
 	"github.com/tsmask/go-oam/push/timer"
 )
 
@@ -16,6 +24,7 @@ const DefaultPushURI = "/api/push/receive"
 // Record represents a generic data record for push operations.
 //
 // Fields:
+//   - ID: Unique record ID, used as the idempotency key
 //   - CoreUID: Core network ID
 //   - NeUID: Network element ID
 //   - RecordTime: Record timestamp (UTC milliseconds)
@@ -30,6 +39,7 @@ const DefaultPushURI = "/api/push/receive"
 //	    RecordData: map[string]any{"level": "critical", "message": "CPU overload"},
 //	}
 type Record struct {
+	ID         string            `json:"id,omitempty"`          // Unique record ID
 	CoreUID    string            `json:"core_uid,omitempty"`    // Core network ID
 	NeUID      string            `json:"ne_uid,omitempty"`      // Network element ID
 	RecordTime int64             `json:"record_time,omitempty"` // Record time (UTC milliseconds)
@@ -38,6 +48,26 @@ type Record struct {
 	Params     map[string]string `json:"params,omitempty"`      // Additional parameters
 }
 
+// recordIDSize is the length of generated record IDs (about 119 bits).
+const recordIDSize = 20
+
+// IdempotencyKey implements client.Idempotent. The ID is sent as the
+// Idempotency-Key header on every attempt, so receivers can drop repeats
+// caused by retries and outbox replays.
+func (r *Record) IdempotencyKey() string {
+	return r.ID
+}
+
+// fill sets RecordTime and ID when they are unset.
+func (r *Record) fill() {
+	if r.RecordTime == 0 {
+		r.RecordTime = time.Now().UnixMilli()
+	}
+	if r.ID == "" {
+		r.ID = generate.String(recordIDSize)
+	}
+}
+
 // SendParams defines parameters for Send and SendAsync operations.
 //
 // Timeout interpretation: timeout <= 0 uses client's default timeout.
@@ -51,11 +81,21 @@ type Record struct {
 //	}
 //	p.Send(record, params)
 type SendParams struct {
-	// URL is the destination endpoint. If empty, uses the default push URL.
+	// URL is the destination endpoint. If empty, uses the matching route or
+	// the default push URL.
 	URL string
 
 	// Timeout specifies the request timeout. If <= 0, uses the client's default timeout.
 	Timeout time.Duration
+
+	// OnResult is called with the delivery outcome of a SendAsync record.
+	// Use ResultRecord to recover the record. Ignored by Send.
+	OnResult func(client.Result)
+
+	// Priority selects the async queue lane of a SendAsync record, e.g.
+	// client.PriorityHigh for critical alarms. Defaults to
+	// client.PriorityNormal. Ignored by Send.
+	Priority client.Priority
 }
 
 // Push is the core client for sending data records to push endpoints.
@@ -84,7 +124,18 @@ type Push struct {
 	pushURL string
 	timeout time.Duration
 	retry   int
+	outbox  *outbox.Outbox
+	batch   *client.BatchConfig
+	cliOpts []client.Option
 	cli     *client.Client
+	schemas *schema.Registry
+
+	routes    []Route
+	healthCfg HealthConfig
+	health    map[string]*destHealth // Failover destinations, read-only after New
+	stopProbe chan struct{}
+	probeOnce sync.Once
+	probeWg   sync.WaitGroup
 }
 
 // Option configures Push client behavior using functional options pattern.
@@ -144,6 +195,183 @@ func WithRetry(n int) Option {
 	}
 }
 
+// WithOutbox persists SendAsync records in ob until the receiver answers 2xx.
+//
+// Undelivered records survive Close and process restarts and are replayed
+// in the background. The outbox is owned by the caller and must be closed
+// after the Push client.
+//
+// Example:
+//
+//	ob, _ := outbox.Open("/var/lib/oam/outbox", outbox.WithMaxBytes(256<<20))
+//	p := push.New(push.WithOutbox(ob))
+//	defer ob.Close()
+//	defer p.Close()
+func WithOutbox(ob *outbox.Outbox) Option {
+	return func(p *Push) { p.outbox = ob }
+}
+
+// WithBatch sends SendAsync records in batches per URL.
+//
+// A batch is POSTed as a JSON array or NDJSON body once it reaches
+// cfg.MaxRecords records, cfg.MaxBytes bytes, or cfg.Linger after its first
+// record. See client.BatchResult for the partial-failure response contract.
+//
+// Example:
+//
+//	p := push.New(push.WithBatch(client.BatchConfig{
+//	    MaxRecords: 500,
+//	    Linger:     200 * time.Millisecond,
+//	    Format:     client.BatchNDJSON,
+//	}))
+func WithBatch(cfg client.BatchConfig) Option {
+	return func(p *Push) { p.batch = &cfg }
+}
+
+// WithCompression compresses request bodies of at least minSize bytes with
+// gzip or zstd. Receivers that answer 415 get uncompressed bodies from then on.
+//
+// Example:
+//
+//	p := push.New(push.WithCompression(client.CompressZstd, 1024))
+func WithCompression(alg client.Compression, minSize int) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithCompression(alg, minSize))
+	}
+}
+
+// WithAuth authenticates every push request with a.
+//
+// Example:
+//
+//	p := push.New(push.WithAuth(auth.Bearer(token)))
+//	p := push.New(push.WithAuth(auth.NewHMAC("site-01", secret)))
+func WithAuth(a auth.Authenticator) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithAuth(a))
+	}
+}
+
+// WithTLSConfig sets the TLS configuration, e.g. client certificates for mTLS.
+//
+// Example:
+//
+//	tlsCfg, _ := auth.LoadClientTLS("client.crt", "client.key", "ca.crt")
+//	p := push.New(push.WithTLSConfig(tlsCfg))
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithTLSConfig(cfg))
+	}
+}
+
+// WithCircuitBreaker enables a circuit breaker per destination host.
+//
+// Example:
+//
+//	p := push.New(push.WithCircuitBreaker(client.BreakerConfig{
+//	    FailureThreshold: 5,
+//	    OpenTimeout:      30 * time.Second,
+//	}))
+func WithCircuitBreaker(cfg client.BreakerConfig) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithCircuitBreaker(cfg))
+	}
+}
+
+// WithRetryPolicy sets the policy that classifies failures and computes
+// retry delays. If not set, defaults to client.ExponentialBackoff.
+func WithRetryPolicy(rp client.RetryPolicy) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithRetryPolicy(rp))
+	}
+}
+
+// WithRetryBudget caps retries at perSecond on average with bursts of up
+// to burst, so an outage cannot multiply the request rate.
+func WithRetryBudget(perSecond float64, burst int) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithRetryBudget(perSecond, burst))
+	}
+}
+
+// WithOnResult sets a handler called with the delivery outcome of every
+// SendAsync record, including records replayed from the outbox.
+//
+// Example:
+//
+//	p := push.New(push.WithOnResult(func(r client.Result) {
+//	    if r.Err != nil && !r.Retained {
+//	        rec, _ := push.ResultRecord(r)
+//	        log.Printf("lost %s from %s: %v", rec.RecordType, rec.NeUID, r.Err)
+//	    }
+//	}))
+func WithOnResult(fn func(client.Result)) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithOnResult(fn))
+	}
+}
+
+// WithDeadLetter sends permanently failed SendAsync records to sink.
+//
+// Example:
+//
+//	dlq := client.NewDeadLetterQueue(1000)
+//	p := push.New(push.WithDeadLetter(dlq))
+func WithDeadLetter(sink client.DeadLetterSink) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithDeadLetter(sink))
+	}
+}
+
+// WithTransport replaces the default HTTP transport, keeping the retry,
+// queue, outbox, and statistics of the client. The base URL and route
+// destinations select the transport's connection.
+//
+// Example:
+//
+//	p := push.New(
+//	    push.WithBaseURL("ws://nms.example.com:8080"),
+//	    push.WithPushURI("/ws"),
+//	    push.WithTransport(transport.NewWS()),
+//	)
+func WithTransport(t client.Transport) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithTransport(t))
+	}
+}
+
+// WithOverflow sets what SendAsync does when the async queue or the
+// memory budget is full. Defaults to client.OverflowSync.
+//
+// Example:
+//
+//	p := push.New(
+//	    push.WithOverflow(client.OverflowReject),
+//	    push.WithMemoryBudget(32<<20),
+//	)
+func WithOverflow(policy client.OverflowPolicy) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithOverflow(policy))
+	}
+}
+
+// WithPriorityWeights sets how often workers serve the high, normal, and
+// low priority lanes while several have records (see SendParams.Priority).
+// Defaults to 8, 2, 1.
+func WithPriorityWeights(high, normal, low int) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithPriorityWeights(high, normal, low))
+	}
+}
+
+// WithMemoryBudget bounds the encoded bytes of queued SendAsync records.
+// Records beyond it are handled by the overflow policy (see WithOverflow).
+func WithMemoryBudget(n int64) Option {
+	return func(p *Push) {
+		p.cliOpts = append(p.cliOpts, client.WithMemoryBudget(n))
+	}
+}
+
 // New creates a new Push client with optional configuration.
 //
 // The client must be closed after use to release resources.
@@ -178,10 +406,17 @@ func New(opts ...Option) *Push {
 	}
 	p.pushURL = p.baseURL + p.pushURI
 
-	p.cli = client.New(
+	cliOpts := []client.Option{
 		client.WithTimeout(p.timeout),
 		client.WithRetry(p.retry),
-	)
+		client.WithOutbox(p.outbox),
+	}
+	if p.batch != nil {
+		cliOpts = append(cliOpts, client.WithBatch(*p.batch))
+	}
+	cliOpts = append(cliOpts, p.cliOpts...)
+	p.cli = client.New(cliOpts...)
+	p.initRoutes()
 
 	return p
 }
@@ -191,21 +426,41 @@ func New(opts ...Option) *Push {
 // It should be called when the client is no longer needed.
 // Safe to call multiple times.
 func (p *Push) Close() {
+	if p.stopProbe != nil {
+		p.probeOnce.Do(func() { close(p.stopProbe) })
+		p.probeWg.Wait()
+	}
 	if p.cli != nil {
 		p.cli.Close()
 	}
 }
 
+// Stats returns statistics of the underlying client, including the outbox
+// backlog when WithOutbox is set.
+func (p *Push) Stats() client.PoolStats {
+	return p.cli.Stats()
+}
+
+// Redrive submits the records of q again through the underlying client.
+// See client.DeadLetterQueue.Redrive.
+func (p *Push) Redrive(q *client.DeadLetterQueue) (int, error) {
+	return q.Redrive(p.cli)
+}
+
 // Send synchronously sends a record to the push endpoint.
 //
 // Blocks until the request completes or times out. If record.RecordTime is zero,
-// it will be set to the current UTC time.
+// it will be set to the current UTC time. If record.ID is empty, a random ID
+// is assigned; reuse the record to resend it under the same ID.
 //
 // Parameters:
 //   - record: The data record to send
-//   - params: Send parameters (nil for defaults: URL uses baseURL+pushURI, Timeout uses client default)
+//   - params: Send parameters (nil for defaults: URL uses routes or baseURL+pushURI, Timeout uses client default)
 //
-// Returns an error if the request fails after all retries.
+// Returns an error if the request fails after all retries. For a fan-out
+// route the error is a *FanoutError with the outcome of every destination.
+// With WithSchemas, a record whose data does not match its schema is not
+// sent and a *schema.ValidationError is returned.
 //
 // Example:
 //
@@ -236,8 +491,14 @@ func (p *Push) Send(record *Record, params *SendParams) error {
 		}
 	}
 
-	if record.RecordTime == 0 {
-		record.RecordTime = time.Now().UnixMilli()
+	if err := p.validate(record); err != nil {
+		return err
+	}
+	record.fill()
+	if params == nil || params.URL == "" {
+		if r := p.route(record); r != nil {
+			return p.sendRoute(r, record, timeout)
+		}
 	}
 	return p.cli.PushTimeout(url, record, timeout)
 }
@@ -246,11 +507,18 @@ func (p *Push) Send(record *Record, params *SendParams) error {
 //
 // Non-blocking: returns immediately after queuing the request.
 // Uses an internal goroutine pool for efficient concurrent execution.
-// Returns an error if the record cannot be queued.
+// Returns an error if the record cannot be queued; what happens when the
+// queue is full depends on the overflow policy (see WithOverflow).
 //
 // Parameters:
 //   - record: The data record to send
-//   - params: Send parameters (nil for defaults: URL uses baseURL+pushURI, Timeout uses client default)
+//   - params: Send parameters (nil for defaults: URL uses routes or baseURL+pushURI, Timeout uses client default)
+//
+// With WithSchemas, the record is validated before it is queued, as in Send.
+//
+// A failover route queues the record for the first healthy destination.
+// A fan-out route queues it for every destination and returns a
+// *FanoutError if any of them could not be queued.
 //
 // Example:
 //
@@ -265,6 +533,18 @@ func (p *Push) Send(record *Record, params *SendParams) error {
 //	    Timeout: 10 * time.Second,
 //	})
 func (p *Push) SendAsync(record *Record, params *SendParams) error {
+	return p.SendAsyncContext(context.Background(), record, params)
+}
+
+// SendAsyncContext is SendAsync with a context bounding the wait for queue
+// room under client.OverflowBlock. Delivery is bounded by the send timeout.
+//
+// Example:
+//
+//	ctx, cancel := context.WithTimeout(ctx, time.Second)
+//	defer cancel()
+//	err := p.SendAsyncContext(ctx, record, nil)
+func (p *Push) SendAsyncContext(ctx context.Context, record *Record, params *SendParams) error {
 	url := p.pushURL
 	timeout := p.timeout
 
@@ -277,10 +557,34 @@ func (p *Push) SendAsync(record *Record, params *SendParams) error {
 		}
 	}
 
-	if record.RecordTime == 0 {
-		record.RecordTime = time.Now().UnixMilli()
+	if err := p.validate(record); err != nil {
+		return err
+	}
+	record.fill()
+	opts := client.JobOptions{Timeout: timeout}
+	if params != nil {
+		opts.OnResult = params.OnResult
+		opts.Priority = params.Priority
+	}
+	if params == nil || params.URL == "" {
+		if r := p.route(record); r != nil {
+			return p.sendRouteAsync(ctx, r, record, opts)
+		}
+	}
+	return p.cli.AsyncPushContext(ctx, url, record, opts)
+}
+
+// ResultRecord returns the record a SendAsync result refers to. Records
+// replayed from the outbox are decoded from the result body.
+func ResultRecord(r client.Result) (*Record, error) {
+	if rec, ok := r.Payload.(*Record); ok {
+		return rec, nil
+	}
+	var rec Record
+	if err := json.Unmarshal(r.Body, &rec); err != nil {
+		return nil, err
 	}
-	return p.cli.AsyncPushTimeout(url, record, timeout)
+	return &rec, nil
 }
 
 // NewMetrics creates a new non-sharded metrics collector.
@@ -310,6 +614,18 @@ func NewShardedMetrics() *metrics.ShardedMetrics {
 	return metrics.NewSharded()
 }
 
+// MetricsHandler returns an http.Handler exposing the given collectors in
+// Prometheus text format, or OpenMetrics when the scraper asks for it.
+//
+// Example:
+//
+//	m := push.NewShardedMetrics()
+//	m.Register("requests_total", 0, 1, 0, 1e9, metrics.WithType(metrics.TypeCounter))
+//	http.Handle("/metrics", push.MetricsHandler(m))
+func MetricsHandler(gs ...metrics.Gatherer) http.Handler {
+	return metrics.Handler(gs...)
+}
+
 // NewTimer creates a a new timer for measuring operation durations.
 //
 // Useful for performance monitoring and profiling.
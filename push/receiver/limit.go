@@ -0,0 +1,181 @@
+package receiver
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// limiterPruneSize is the number of tracked NeUIDs above which idle
+// buckets are dropped.
+const limiterPruneSize = 10000
+
+// DedupWindow remembers keys for a fixed duration, up to a maximum number
+// of keys; when full, the oldest keys are forgotten first. Thread-safe.
+//
+// It backs WithDedup and can be used directly in handlers that dedupe on
+// their own keys.
+//
+// Example:
+//
+//	seen := receiver.NewDedupWindow(10*time.Minute, 100000)
+//	http.HandleFunc("/api/alarm", func(w http.ResponseWriter, r *http.Request) {
+//	    if key := r.Header.Get(client.HeaderIdempotencyKey); key != "" && !seen.Add(key) {
+//	        w.WriteHeader(http.StatusOK) // repeat: already processed
+//	        return
+//	    }
+//	    // ...
+//	})
+type DedupWindow struct {
+	ttl time.Duration
+	max int
+	now func() time.Time
+
+	mu    sync.Mutex
+	seq   uint64
+	keys  map[string]uint64 // key → seq of its current entry
+	order []windowEntry     // insertion order, oldest first
+}
+
+type windowEntry struct {
+	key string
+	seq uint64
+	at  time.Time
+}
+
+// NewDedupWindow creates a window remembering keys for ttl, up to max keys.
+// If max <= 0, the number of keys is not limited.
+func NewDedupWindow(ttl time.Duration, max int) *DedupWindow {
+	if max <= 0 {
+		max = math.MaxInt
+	}
+	return &DedupWindow{ttl: ttl, max: max, now: time.Now, keys: make(map[string]uint64)}
+}
+
+// Add records key and reports whether it was new. It returns false for a
+// key added within the window that has not been removed.
+func (w *DedupWindow) Add(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	w.expire(now)
+	if _, ok := w.keys[key]; ok {
+		return false
+	}
+	w.seq++
+	w.keys[key] = w.seq
+	w.order = append(w.order, windowEntry{key: key, seq: w.seq, at: now})
+	for len(w.keys) > w.max {
+		w.evictOldest()
+	}
+	return true
+}
+
+// Seen reports whether key was added within the window.
+func (w *DedupWindow) Seen(key string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expire(w.now())
+	_, ok := w.keys[key]
+	return ok
+}
+
+// Remove forgets key, so a later Add of it succeeds.
+func (w *DedupWindow) Remove(key string) {
+	w.mu.Lock()
+	delete(w.keys, key)
+	w.mu.Unlock()
+}
+
+// Len returns the number of keys in the window.
+func (w *DedupWindow) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expire(w.now())
+	return len(w.keys)
+}
+
+// expire drops keys older than the window.
+func (w *DedupWindow) expire(now time.Time) {
+	for len(w.order) > 0 && now.Sub(w.order[0].at) >= w.ttl {
+		w.evictOldest()
+	}
+}
+
+// evictOldest drops the oldest entry. Entries of removed or re-added keys
+// are skipped without touching the newer state.
+func (w *DedupWindow) evictOldest() {
+	e := w.order[0]
+	w.order[0] = windowEntry{}
+	w.order = w.order[1:]
+	if seq, ok := w.keys[e.key]; ok && seq == e.seq {
+		delete(w.keys, e.key)
+	}
+}
+
+// limiter holds a token bucket per NeUID. Thread-safe.
+type limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(perSecond float64, burst int) *limiter {
+	return &limiter{
+		rate:    perSecond,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow consumes one token of neUID and reports whether one was available.
+func (l *limiter) allow(neUID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b := l.buckets[neUID]
+	if b == nil {
+		if len(l.buckets) >= limiterPruneSize {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[neUID] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// prune drops buckets that have refilled completely; they behave the same
+// as new buckets.
+func (l *limiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// retryAfter returns the Retry-After hint in whole seconds: the time one
+// token takes to refill, at least 1.
+func (l *limiter) retryAfter() int {
+	if l == nil {
+		return 1
+	}
+	return max(1, int(math.Ceil(1/l.rate)))
+}
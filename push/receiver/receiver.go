@@ -0,0 +1,443 @@
+// Package receiver implements the receiving side of push: an http.Handler
+// that decodes records sent by push.Push and push/client and dispatches
+// them to handlers registered by RecordType.
+//
+// Example:
+//
+//	rcv := receiver.New(
+//	    receiver.WithHMAC(map[string]string{"agent-1": secret}, 0),
+//	    receiver.WithDedup(10*time.Minute, 100000),
+//	    receiver.WithRateLimit(100, 200),
+//	)
+//	receiver.HandleData(rcv, "alarm", func(ctx context.Context, rec *push.Record, a Alarm) error {
+//	    return store.SaveAlarm(ctx, rec.NeUID, a)
+//	})
+//	http.Handle(push.DefaultPushURI, rcv)
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/tsmask/go-oam/push"
+	"github.com/tsmask/go-oam/push/auth"
+	"github.com/tsmask/go-oam/push/client"
+)
+
+const defaultMaxBodySize = 10 << 20 // 10MB
+
+// HandlerFunc processes one record. A nil error accepts the record.
+//
+// Return an *Error (see Reject) to reject the record with a specific code;
+// any other error rejects it with 500, which senders retry.
+type HandlerFunc func(ctx context.Context, rec *push.Record) error
+
+// Error rejects a record with an HTTP-like status code. Codes 429 and 5xx
+// ask the sender to retry; other 4xx codes are final.
+type Error struct {
+	Code int    // HTTP-like status code
+	Msg  string // Reason reported to the sender
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Msg)
+}
+
+// Reject returns an *Error with the given code and formatted reason.
+func Reject(code int, format string, args ...any) error {
+	return &Error{Code: code, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Stats holds receiver counters, counted per record unless noted.
+type Stats struct {
+	Requests     int64 // HTTP requests served
+	Unauthorized int64 // Requests rejected by signature verification
+	Received     int64 // Records decoded
+	Accepted     int64 // Records accepted by a handler
+	Duplicates   int64 // Records accepted without dispatch as repeats
+	RateLimited  int64 // Records rejected with 429 by the rate limit
+	Rejected     int64 // Records rejected for any other reason
+}
+
+// Option configures a Receiver.
+type Option func(*Receiver)
+
+// WithHMAC requires requests to be signed with auth.HMAC.
+//
+// keys maps the key ID sent by the client to its secret; use the empty key
+// for clients created with an empty key ID. maxSkew bounds the signature
+// age, see auth.VerifyHMAC. Nonces are remembered for maxSkew and
+// repeated nonces are rejected as replays.
+func WithHMAC(keys map[string]string, maxSkew time.Duration) Option {
+	return func(r *Receiver) {
+		if maxSkew <= 0 {
+			maxSkew = auth.DefaultHMACMaxSkew
+		}
+		r.hmacKeys = keys
+		r.hmacSkew = maxSkew
+		// Signatures older than maxSkew fail verification, so nonces only
+		// need to be kept that long.
+		r.nonces = NewDedupWindow(2*maxSkew, 0)
+	}
+}
+
+// WithDedup drops records already accepted within window. At most max
+// record keys are remembered; when full, the oldest keys are forgotten.
+// Repeats are answered as accepted so the sender stops retrying.
+//
+// Records are keyed by their ID. Records without an ID are keyed by the
+// Idempotency-Key header of a single-record request, or else by the
+// SHA-256 of their JSON encoding. All three stay the same across client
+// retries and outbox replays.
+func WithDedup(window time.Duration, max int) Option {
+	return func(r *Receiver) {
+		if window > 0 && max > 0 {
+			r.dedup = NewDedupWindow(window, max)
+		}
+	}
+}
+
+// WithRateLimit limits each NeUID to perSecond records on average, with
+// bursts of up to burst records. Records over the limit are rejected with
+// 429 and a Retry-After hint.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(r *Receiver) {
+		if perSecond > 0 && burst > 0 {
+			r.limiter = newLimiter(perSecond, burst)
+		}
+	}
+}
+
+// WithMaxBodySize limits the request body, before and after
+// decompression, to n bytes. If n <= 0, defaults to 10MB.
+func WithMaxBodySize(n int64) Option {
+	return func(r *Receiver) {
+		if n <= 0 {
+			n = defaultMaxBodySize
+		}
+		r.maxBody = n
+	}
+}
+
+// WithDefaultHandler handles records whose RecordType has no handler.
+// Without it such records are rejected with 422.
+func WithDefaultHandler(h HandlerFunc) Option {
+	return func(r *Receiver) { r.fallback = h }
+}
+
+// Receiver is an http.Handler for push records. It accepts single JSON
+// records, JSON arrays, and NDJSON batches, optionally compressed with
+// gzip or zstd. Thread-safe.
+//
+// A single record is answered with the status of its outcome. A batch is
+// answered with 200 and a client.BatchResult listing rejected records, so
+// push/client retries only the records that need it.
+type Receiver struct {
+	maxBody  int64
+	hmacKeys map[string]string
+	hmacSkew time.Duration
+	nonces   *DedupWindow
+	dedup    *DedupWindow
+	limiter  *limiter
+	fallback HandlerFunc
+
+	mu       sync.RWMutex
+	handlers map[string]HandlerFunc
+
+	requests     atomic.Int64
+	unauthorized atomic.Int64
+	received     atomic.Int64
+	accepted     atomic.Int64
+	duplicates   atomic.Int64
+	rateLimited  atomic.Int64
+	rejected     atomic.Int64
+}
+
+// New creates a Receiver with optional configuration.
+func New(opts ...Option) *Receiver {
+	r := &Receiver{
+		maxBody:  defaultMaxBodySize,
+		handlers: make(map[string]HandlerFunc),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Handle registers h for records of recordType, replacing any previous
+// handler.
+func (r *Receiver) Handle(recordType string, h HandlerFunc) {
+	r.mu.Lock()
+	r.handlers[recordType] = h
+	r.mu.Unlock()
+}
+
+// HandleData registers fn for records of recordType with RecordData
+// decoded into T. Records whose data does not decode are rejected with 400.
+//
+// Example:
+//
+//	receiver.HandleData(rcv, "kpi", func(ctx context.Context, rec *push.Record, kpi map[string]float64) error {
+//	    return tsdb.Write(ctx, rec.NeUID, rec.RecordTime, kpi)
+//	})
+func HandleData[T any](r *Receiver, recordType string, fn func(ctx context.Context, rec *push.Record, data T) error) {
+	r.Handle(recordType, func(ctx context.Context, rec *push.Record) error {
+		var data T
+		if len(rec.RecordData) > 0 {
+			if err := json.Unmarshal(rec.RecordData, &data); err != nil {
+				return Reject(http.StatusBadRequest, "record_data: %v", err)
+			}
+		}
+		return fn(ctx, rec, data)
+	})
+}
+
+// Stats returns a snapshot of the receiver counters.
+func (r *Receiver) Stats() Stats {
+	return Stats{
+		Requests:     r.requests.Load(),
+		Unauthorized: r.unauthorized.Load(),
+		Received:     r.received.Load(),
+		Accepted:     r.accepted.Load(),
+		Duplicates:   r.duplicates.Load(),
+		RateLimited:  r.rateLimited.Load(),
+		Rejected:     r.rejected.Load(),
+	}
+}
+
+// ServeHTTP implements http.Handler.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(req.Body, r.maxBody+1))
+	if err != nil {
+		http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(raw)) > r.maxBody {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err := r.verify(req, raw); err != nil {
+		r.unauthorized.Add(1)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	body, status, err := r.decompress(req.Header.Get("Content-Encoding"), raw)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	items, batch, err := split(req.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !batch {
+		res := r.process(req.Context(), items[0], req.Header.Get(client.HeaderIdempotencyKey))
+		if res == nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if res.Code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(r.limiter.retryAfter()))
+		}
+		http.Error(w, res.Msg, res.Code)
+		return
+	}
+
+	result := client.BatchResult{}
+	for i, item := range items {
+		if res := r.process(req.Context(), item, ""); res != nil {
+			result.Rejected = append(result.Rejected, client.BatchRejection{Index: i, Code: res.Code, Msg: res.Msg})
+			continue
+		}
+		result.Accepted++
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&result)
+}
+
+// verify checks the request signature when WithHMAC is set.
+func (r *Receiver) verify(req *http.Request, body []byte) error {
+	if r.hmacKeys == nil {
+		return nil
+	}
+	secret, ok := r.hmacKeys[req.Header.Get(auth.HeaderKeyID)]
+	if !ok {
+		return auth.ErrSignatureInvalid
+	}
+	if err := auth.VerifyHMAC(req, body, secret, r.hmacSkew); err != nil {
+		return err
+	}
+	if !r.nonces.Add(req.Header.Get(auth.HeaderNonce)) {
+		return errors.New("auth: nonce replayed")
+	}
+	return nil
+}
+
+// decompress decodes body according to its Content-Encoding. The returned
+// status is used when decoding fails.
+func (r *Receiver) decompress(encoding string, body []byte) ([]byte, int, error) {
+	var rd io.Reader
+	switch encoding {
+	case "", "identity":
+		return body, 0, nil
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("gzip: %w", err)
+		}
+		defer zr.Close()
+		rd = zr
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("zstd: %w", err)
+		}
+		defer zr.Close()
+		rd = zr
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(rd, r.maxBody+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("%s: %w", encoding, err)
+	}
+	if int64(len(out)) > r.maxBody {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("decompressed body too large")
+	}
+	return out, 0, nil
+}
+
+// split returns the raw records of body and whether it is a batch.
+func split(contentType string, body []byte) ([]json.RawMessage, bool, error) {
+	if mt, _, _ := mime.ParseMediaType(contentType); mt == "application/x-ndjson" {
+		var items []json.RawMessage
+		for line := range bytes.SplitSeq(body, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				items = append(items, json.RawMessage(line))
+			}
+		}
+		return items, true, nil
+	}
+
+	body = bytes.TrimSpace(body)
+	switch {
+	case len(body) > 0 && body[0] == '[':
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, false, fmt.Errorf("decode batch: %w", err)
+		}
+		return items, true, nil
+	case len(body) > 0 && body[0] == '{':
+		return []json.RawMessage{body}, false, nil
+	default:
+		return nil, false, errors.New("body is not a JSON record, array, or NDJSON batch")
+	}
+}
+
+// process decodes and dispatches one record. Returns nil when accepted.
+// header is the Idempotency-Key header of a single-record request.
+func (r *Receiver) process(ctx context.Context, raw json.RawMessage, header string) *Error {
+	var rec push.Record
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		r.rejected.Add(1)
+		return &Error{Code: http.StatusBadRequest, Msg: "decode record: " + err.Error()}
+	}
+	r.received.Add(1)
+
+	var key string
+	if r.dedup != nil {
+		key = dedupKey(&rec, header, raw)
+		if r.dedup.Seen(key) {
+			r.duplicates.Add(1)
+			return nil
+		}
+	}
+
+	if r.limiter != nil && !r.limiter.allow(rec.NeUID) {
+		r.rateLimited.Add(1)
+		return &Error{Code: http.StatusTooManyRequests, Msg: "rate limit exceeded for ne_uid " + strconv.Quote(rec.NeUID)}
+	}
+
+	// Reserve the key while the handler runs so a concurrent repeat is
+	// not dispatched twice; release it if the record is not accepted.
+	if key != "" && !r.dedup.Add(key) {
+		r.duplicates.Add(1)
+		return nil
+	}
+	if err := r.dispatch(ctx, &rec); err != nil {
+		if key != "" {
+			r.dedup.Remove(key)
+		}
+		r.rejected.Add(1)
+		var re *Error
+		if errors.As(err, &re) {
+			return re
+		}
+		return &Error{Code: http.StatusInternalServerError, Msg: err.Error()}
+	}
+	r.accepted.Add(1)
+	return nil
+}
+
+// dedupKey returns the dedup key of rec: its ID, else header, else the
+// hash of its encoding.
+func dedupKey(rec *push.Record, header string, raw []byte) string {
+	switch {
+	case rec.ID != "":
+		return "id:" + rec.ID
+	case header != "":
+		return "id:" + header
+	default:
+		sum := sha256.Sum256(raw)
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// dispatch calls the handler registered for rec.RecordType.
+func (r *Receiver) dispatch(ctx context.Context, rec *push.Record) (err error) {
+	r.mu.RLock()
+	h := r.handlers[rec.RecordType]
+	r.mu.RUnlock()
+	if h == nil {
+		h = r.fallback
+	}
+	if h == nil {
+		return Reject(http.StatusUnprocessableEntity, "no handler for record type %q", rec.RecordType)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("handler panic: %v", v)
+		}
+	}()
+	return h(ctx, rec)
+}
@@ -0,0 +1,284 @@
+package receiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push"
+	"github.com/tsmask/go-oam/push/auth"
+	"github.com/tsmask/go-oam/push/client"
+)
+
+type alarm struct {
+	Severity string `json:"severity"`
+}
+
+// sink collects handled records.
+type sink struct {
+	mu   sync.Mutex
+	recs []string
+}
+
+func (s *sink) add(v string) {
+	s.mu.Lock()
+	s.recs = append(s.recs, v)
+	s.mu.Unlock()
+}
+
+func (s *sink) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.recs...)
+}
+
+func TestReceiver_EndToEndSignedCompressed(t *testing.T) {
+	var got sink
+	rcv := New(WithHMAC(map[string]string{"agent-1": "s3cret"}, 0))
+	HandleData(rcv, "alarm", func(ctx context.Context, rec *push.Record, a alarm) error {
+		if a.Severity == "" {
+			return Reject(http.StatusBadRequest, "severity required")
+		}
+		got.add(rec.NeUID + "/" + a.Severity)
+		return nil
+	})
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	p := push.New(
+		push.WithBaseURL(srv.URL),
+		push.WithAuth(auth.NewHMAC("agent-1", "s3cret")),
+		push.WithCompression(client.CompressGzip, 1),
+	)
+	defer p.Close()
+
+	if err := p.Send(&push.Record{NeUID: "ne-1", RecordType: "alarm", RecordData: json.RawMessage(`{"severity":"major"}`)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	err := p.Send(&push.Record{NeUID: "ne-1", RecordType: "alarm", RecordData: json.RawMessage(`{}`)}, nil)
+	if client.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("err = %v, want http 400", err)
+	}
+	err = p.Send(&push.Record{NeUID: "ne-1", RecordType: "kpi"}, nil)
+	if client.StatusCode(err) != http.StatusUnprocessableEntity {
+		t.Fatalf("unhandled type err = %v, want http 422", err)
+	}
+
+	if g := got.get(); len(g) != 1 || g[0] != "ne-1/major" {
+		t.Fatalf("handled = %v", g)
+	}
+
+	// Wrong key
+	bad := push.New(push.WithBaseURL(srv.URL), push.WithAuth(auth.NewHMAC("agent-1", "wrong")))
+	defer bad.Close()
+	if err := bad.Send(&push.Record{NeUID: "ne-1", RecordType: "alarm"}, nil); client.StatusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("bad signature err = %v, want http 401", err)
+	}
+	if s := rcv.Stats(); s.Accepted != 1 || s.Rejected != 2 || s.Unauthorized != 1 {
+		t.Fatalf("stats = %+v", s)
+	}
+}
+
+func TestReceiver_BatchRateLimitAndDedup(t *testing.T) {
+	var got sink
+	rcv := New(WithRateLimit(0.001, 2), WithDedup(time.Minute, 100))
+	rcv.Handle("kpi", func(ctx context.Context, rec *push.Record) error {
+		got.add(rec.NeUID)
+		return nil
+	})
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	recs := []*push.Record{
+		{NeUID: "ne-1", RecordType: "kpi", RecordTime: 1},
+		{NeUID: "ne-1", RecordType: "kpi", RecordTime: 1}, // duplicate
+		{NeUID: "ne-1", RecordType: "kpi", RecordTime: 2},
+		{NeUID: "ne-1", RecordType: "kpi", RecordTime: 3}, // over the limit
+		{NeUID: "ne-2", RecordType: "kpi", RecordTime: 1},
+	}
+	var body strings.Builder
+	for _, rec := range recs {
+		b, _ := json.Marshal(rec)
+		body.Write(b)
+		body.WriteByte('\n')
+	}
+	resp, err := http.Post(srv.URL, "application/x-ndjson", strings.NewReader(body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var result client.BatchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Accepted != 4 || len(result.Rejected) != 1 {
+		t.Fatalf("status %d, result %+v", resp.StatusCode, result)
+	}
+	if r := result.Rejected[0]; r.Index != 3 || r.Code != http.StatusTooManyRequests {
+		t.Fatalf("rejection = %+v, want index 3 with 429", r)
+	}
+	if g := got.get(); len(g) != 3 {
+		t.Fatalf("handled = %v, want 3 records", g)
+	}
+	if s := rcv.Stats(); s.Duplicates != 1 || s.RateLimited != 1 || s.Received != 5 {
+		t.Fatalf("stats = %+v", s)
+	}
+
+	// A single record over the limit gets 429 with Retry-After
+	b, _ := json.Marshal(&push.Record{NeUID: "ne-1", RecordType: "kpi", RecordTime: 4})
+	resp2, err := http.Post(srv.URL, "application/json", strings.NewReader(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusTooManyRequests || resp2.Header.Get("Retry-After") == "" {
+		t.Fatalf("status %d, Retry-After %q", resp2.StatusCode, resp2.Header.Get("Retry-After"))
+	}
+}
+
+func TestReceiver_ClientBatchEndToEnd(t *testing.T) {
+	var got sink
+	rcv := New()
+	rcv.Handle("kpi", func(ctx context.Context, rec *push.Record) error {
+		if rec.NeUID == "bad" {
+			return Reject(http.StatusBadRequest, "unknown ne")
+		}
+		got.add(rec.NeUID)
+		return nil
+	})
+	srv := httptest.NewServer(rcv)
+	defer srv.Close()
+
+	dlq := client.NewDeadLetterQueue(10)
+	p := push.New(
+		push.WithBaseURL(srv.URL),
+		push.WithBatch(client.BatchConfig{MaxRecords: 3, Linger: time.Second}),
+		push.WithCompression(client.CompressZstd, 1),
+		push.WithDeadLetter(dlq),
+	)
+	for _, ne := range []string{"ne-1", "bad", "ne-2"} {
+		if err := p.SendAsync(&push.Record{NeUID: ne, RecordType: "kpi"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Close()
+
+	if g := got.get(); len(g) != 2 {
+		t.Fatalf("handled = %v", g)
+	}
+	items := dlq.Items()
+	if len(items) != 1 || items[0].Status != http.StatusBadRequest {
+		t.Fatalf("dead letters = %+v", items)
+	}
+}
+
+func TestReceiver_RequestErrors(t *testing.T) {
+	rcv := New(WithDefaultHandler(func(ctx context.Context, rec *push.Record) error { return nil }))
+	for name, tc := range map[string]struct {
+		encoding, body string
+		want           int
+	}{
+		"not json":         {"", "hello", http.StatusBadRequest},
+		"bad encoding":     {"br", "{}", http.StatusUnsupportedMediaType},
+		"corrupt gzip":     {"gzip", "{}", http.StatusBadRequest},
+		"default handler":  {"", `{"record_type":"other"}`, http.StatusOK},
+		"bad record field": {"", `{"record_time":"x"}`, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, push.DefaultPushURI, strings.NewReader(tc.body))
+		req.Header.Set("Content-Encoding", tc.encoding)
+		w := httptest.NewRecorder()
+		rcv.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestReceiver_RejectsReplayedNonce(t *testing.T) {
+	rcv := New(WithHMAC(map[string]string{"": "k"}, 0), WithDefaultHandler(func(ctx context.Context, rec *push.Record) error { return nil }))
+	body := []byte(`{"ne_uid":"ne-1"}`)
+	req := httptest.NewRequest(http.MethodPost, push.DefaultPushURI, nil)
+	if err := auth.NewHMAC("", "k").Authenticate(req, body); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		r := req.Clone(context.Background())
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		rcv.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("attempt %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+}
+
+func TestDedupWindow_ExpiresAndEvicts(t *testing.T) {
+	now := time.Unix(0, 0)
+	w := NewDedupWindow(time.Minute, 2)
+	w.now = func() time.Time { return now }
+
+	if !w.Add("a") || w.Add("a") {
+		t.Fatal("duplicate not detected")
+	}
+	w.Add("b")
+	w.Add("c") // evicts a
+	if w.Seen("a") || !w.Seen("b") {
+		t.Fatal("oldest key not evicted at capacity")
+	}
+	w.Remove("b")
+	if !w.Add("b") {
+		t.Fatal("removed key still present")
+	}
+	now = now.Add(time.Minute)
+	if w.Seen("c") || w.Seen("b") {
+		t.Fatal("keys not expired after the window")
+	}
+}
+
+func TestReceiver_DedupAcrossClientRetries(t *testing.T) {
+	var handled sink
+	rcv := New(WithDedup(time.Minute, 100))
+	rcv.Handle("alarm", func(ctx context.Context, rec *push.Record) error {
+		handled.add(rec.ID)
+		return nil
+	})
+	// The first response is lost: the record is handled but the client
+	// sees a 503 and retries.
+	var lost sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		first := false
+		lost.Do(func() { first = true })
+		if first {
+			rcv.ServeHTTP(httptest.NewRecorder(), req)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		rcv.ServeHTTP(w, req)
+	}))
+	defer srv.Close()
+
+	p := push.New(push.WithBaseURL(srv.URL), push.WithRetry(2))
+	defer p.Close()
+
+	rec := &push.Record{NeUID: "ne-1", RecordType: "alarm"}
+	if err := p.Send(rec, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID == "" {
+		t.Fatal("Send did not assign a record ID")
+	}
+	if g := handled.get(); len(g) != 1 || g[0] != rec.ID {
+		t.Fatalf("handled = %v, want [%s] once", g, rec.ID)
+	}
+	if s := rcv.Stats(); s.Duplicates != 1 {
+		t.Fatalf("stats = %+v, want 1 duplicate", s)
+	}
+}
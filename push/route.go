@@ -0,0 +1,432 @@
+package push
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsmask/go-oam/push/client"
+)
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	defaultHealthTimeout  = 2 * time.Second
+)
+
+// RouteMode selects how a route delivers to its destinations.
+type RouteMode int
+
+const (
+	// RouteFailover sends to the first healthy destination in order and
+	// moves on to the next one when a destination fails.
+	RouteFailover RouteMode = iota
+	// RouteFanout sends every record to all destinations.
+	RouteFanout
+)
+
+// Route sends matching records to a set of destinations.
+//
+// A record matches when its RecordType is in RecordTypes (or RecordTypes
+// is empty), its NeUID is in NeUIDs (or NeUIDs is empty), and Match
+// returns true (or Match is nil). A route without conditions matches every
+// record.
+//
+// Example:
+//
+//	push.Route{
+//	    RecordTypes:  []string{"alarm"},
+//	    Destinations: []string{"http://nms-a:8080/api/alarm", "http://nms-b:8080/api/alarm"},
+//	    Mode:         push.RouteFailover,
+//	}
+type Route struct {
+	Name         string             // Optional name for logs and errors
+	RecordTypes  []string           // Record types to match, empty matches all
+	NeUIDs       []string           // Network element IDs to match, empty matches all
+	Match        func(*Record) bool // Optional extra condition
+	Destinations []string           // Full destination URLs; failover order for RouteFailover
+	Mode         RouteMode          // Delivery mode, default RouteFailover
+}
+
+// matches reports whether r applies to record.
+func (r *Route) matches(record *Record) bool {
+	if len(r.RecordTypes) > 0 && !slices.Contains(r.RecordTypes, record.RecordType) {
+		return false
+	}
+	if len(r.NeUIDs) > 0 && !slices.Contains(r.NeUIDs, record.NeUID) {
+		return false
+	}
+	return r.Match == nil || r.Match(record)
+}
+
+// HealthConfig configures health probing of failover destinations.
+//
+// Destinations start healthy. A destination is marked unhealthy when a send
+// to it fails with a transport error, timeout, 429, 5xx, or open circuit,
+// and healthy again when a probe or a send succeeds. Zero fields use the
+// defaults.
+type HealthConfig struct {
+	Interval time.Duration // Probe interval, default 10s
+	Timeout  time.Duration // Timeout of a single probe, default 2s
+
+	// Probe checks a destination URL. If nil, a TCP connection to the
+	// destination host is opened and closed; udp:// and syslog://
+	// destinations are not probed.
+	Probe func(ctx context.Context, url string) error
+
+	// OnChange is called when a destination changes health. It must not block.
+	OnChange func(url string, healthy bool)
+}
+
+// Outcome is the delivery result for one destination of a fan-out route.
+type Outcome struct {
+	URL string // Destination URL
+	Err error  // nil when the destination accepted the record
+}
+
+// FanoutError is returned when a fan-out send fails for at least one
+// destination. Outcomes lists every destination, including the successful
+// ones, in route order.
+type FanoutError struct {
+	Route    string    // Route.Name of the fan-out route
+	Outcomes []Outcome // Outcome of every destination
+}
+
+// Error implements error.
+func (e *FanoutError) Error() string {
+	var failed []string
+	for _, o := range e.Outcomes {
+		if o.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", o.URL, o.Err))
+		}
+	}
+	return fmt.Sprintf("fan-out to %d of %d destinations failed: %s",
+		len(failed), len(e.Outcomes), strings.Join(failed, "; "))
+}
+
+// Unwrap returns the per-destination errors for errors.Is and errors.As.
+func (e *FanoutError) Unwrap() []error {
+	var errs []error
+	for _, o := range e.Outcomes {
+		if o.Err != nil {
+			errs = append(errs, o.Err)
+		}
+	}
+	return errs
+}
+
+// WithRoutes routes records to destinations by record type or network element.
+//
+// Routes are evaluated in order and the first matching route is used.
+// Records that match no route, and sends with an explicit SendParams.URL,
+// go to the default push URL. Routes without destinations are ignored.
+//
+// Example:
+//
+//	p := push.New(push.WithRoutes(
+//	    push.Route{
+//	        RecordTypes:  []string{"alarm"},
+//	        Destinations: []string{"http://nms-a:8080/api/alarm", "http://nms-b:8080/api/alarm"},
+//	    },
+//	    push.Route{
+//	        RecordTypes:  []string{"kpi"},
+//	        Destinations: []string{"http://pm:8080/api/kpi", "http://bigdata:9000/ingest"},
+//	        Mode:         push.RouteFanout,
+//	    },
+//	))
+func WithRoutes(routes ...Route) Option {
+	return func(p *Push) {
+		for _, r := range routes {
+			if len(r.Destinations) > 0 {
+				p.routes = append(p.routes, r)
+			}
+		}
+	}
+}
+
+// WithHealthCheck configures health probing of failover destinations.
+//
+// Probing runs whenever a failover route has more than one destination,
+// with the defaults of HealthConfig unless this option is set.
+func WithHealthCheck(cfg HealthConfig) Option {
+	return func(p *Push) { p.healthCfg = cfg }
+}
+
+// destHealth is the health state of one failover destination.
+type destHealth struct {
+	healthy atomic.Bool
+}
+
+// initRoutes indexes failover destinations and starts the prober.
+func (p *Push) initRoutes() {
+	if p.healthCfg.Interval <= 0 {
+		p.healthCfg.Interval = defaultHealthInterval
+	}
+	if p.healthCfg.Timeout <= 0 {
+		p.healthCfg.Timeout = defaultHealthTimeout
+	}
+	if p.healthCfg.Probe == nil {
+		p.healthCfg.Probe = dialProbe
+	}
+
+	for _, r := range p.routes {
+		if r.Mode != RouteFailover || len(r.Destinations) < 2 {
+			continue
+		}
+		if p.health == nil {
+			p.health = make(map[string]*destHealth)
+		}
+		for _, dst := range r.Destinations {
+			if _, ok := p.health[dst]; !ok {
+				h := &destHealth{}
+				h.healthy.Store(true)
+				p.health[dst] = h
+			}
+		}
+	}
+	if p.health != nil {
+		p.stopProbe = make(chan struct{})
+		p.probeWg.Add(1)
+		go p.probeLoop()
+	}
+}
+
+// route returns the first route matching record, or nil.
+func (p *Push) route(record *Record) *Route {
+	for i := range p.routes {
+		if p.routes[i].matches(record) {
+			return &p.routes[i]
+		}
+	}
+	return nil
+}
+
+// sendRoute delivers record through r synchronously.
+func (p *Push) sendRoute(r *Route, record *Record, timeout time.Duration) error {
+	if r.Mode == RouteFanout {
+		outcomes := make([]Outcome, len(r.Destinations))
+		var wg sync.WaitGroup
+		for i, dst := range r.Destinations {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				outcomes[i] = Outcome{URL: dst, Err: p.cli.PushTimeout(dst, record, timeout)}
+			}()
+		}
+		wg.Wait()
+		return fanoutResult(r, outcomes)
+	}
+
+	return p.failover(r, func(dst string) error {
+		return p.cli.PushTimeout(dst, record, timeout)
+	})
+}
+
+// sendRouteAsync queues record through r. For a fan-out route, the
+// OnResult callback is called once per destination.
+func (p *Push) sendRouteAsync(ctx context.Context, r *Route, record *Record, opts client.JobOptions) error {
+	if r.Mode == RouteFanout {
+		outcomes := make([]Outcome, len(r.Destinations))
+		for i, dst := range r.Destinations {
+			outcomes[i] = Outcome{URL: dst, Err: p.cli.AsyncPushContext(ctx, dst, record, opts)}
+		}
+		return fanoutResult(r, outcomes)
+	}
+
+	return p.failoverAsync(ctx, record, opts, p.failoverOrder(r))
+}
+
+// failoverAsync queues record to the first destination in order that takes
+// it. The delivery result drives failover as well: when the job fails with
+// a destination failure and destinations remain, the destination is marked
+// unhealthy and the client hands the record back (JobOptions.Failover) to
+// be queued to the remaining destinations. Only the last attempt is settled
+// by the client, so opts.OnResult, the dead-letter sink and the failure
+// count only see the final outcome.
+func (p *Push) failoverAsync(ctx context.Context, record *Record, opts client.JobOptions, order []string) error {
+	return p.failoverTo(order, func(i int, dst string) error {
+		job := opts
+		job.OnResult = func(res client.Result) {
+			switch {
+			case res.Err == nil:
+				p.setHealthy(dst, true)
+			case isDestinationFailure(res.Err):
+				p.setHealthy(dst, false)
+			}
+			if opts.OnResult != nil {
+				opts.OnResult(res)
+			}
+		}
+		if rest := order[i+1:]; len(rest) > 0 {
+			job.Failover = func(res client.Result) bool {
+				if !isDestinationFailure(res.Err) {
+					return false
+				}
+				p.setHealthy(dst, false)
+				// Queue from a new goroutine: Failover runs on a worker
+				// and must not block on a full queue.
+				go func() {
+					if err := p.failoverAsync(context.WithoutCancel(ctx), record, opts, rest); err != nil && opts.OnResult != nil {
+						res.Err = errors.Join(res.Err, err)
+						opts.OnResult(res)
+					}
+				}()
+				return true
+			}
+		}
+		return p.cli.AsyncPushContext(ctx, dst, record, job)
+	})
+}
+
+// failover calls send for each destination of r, healthy ones first, until
+// one succeeds or fails with an error that is not the destination's fault.
+func (p *Push) failover(r *Route, send func(dst string) error) error {
+	return p.failoverTo(p.failoverOrder(r), func(_ int, dst string) error {
+		err := send(dst)
+		if err == nil {
+			p.setHealthy(dst, true)
+		}
+		return err
+	})
+}
+
+// failoverTo calls send for each destination of order until one succeeds
+// or fails with an error that is not the destination's fault, marking the
+// destinations that failed unhealthy.
+func (p *Push) failoverTo(order []string, send func(i int, dst string) error) error {
+	var lastErr error
+	for i, dst := range order {
+		err := send(i, dst)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !isDestinationFailure(err) {
+			return err
+		}
+		p.setHealthy(dst, false)
+	}
+	return lastErr
+}
+
+// failoverOrder returns the destinations of r with healthy ones first,
+// keeping the configured order within each group. Unhealthy destinations
+// are still tried last so a stale health state cannot block delivery.
+func (p *Push) failoverOrder(r *Route) []string {
+	if p.health == nil {
+		return r.Destinations
+	}
+	order := make([]string, 0, len(r.Destinations))
+	for _, dst := range r.Destinations {
+		if p.health[dst].healthy.Load() {
+			order = append(order, dst)
+		}
+	}
+	for _, dst := range r.Destinations {
+		if !p.health[dst].healthy.Load() {
+			order = append(order, dst)
+		}
+	}
+	return order
+}
+
+// setHealthy records the health of a failover destination.
+func (p *Push) setHealthy(dst string, healthy bool) {
+	h := p.health[dst]
+	if h == nil || h.healthy.Swap(healthy) == healthy {
+		return
+	}
+	if p.healthCfg.OnChange != nil {
+		p.healthCfg.OnChange(dst, healthy)
+	}
+}
+
+// Health returns the health of every failover destination, keyed by URL.
+// Returns nil when no route uses failover between several destinations.
+func (p *Push) Health() map[string]bool {
+	if p.health == nil {
+		return nil
+	}
+	m := make(map[string]bool, len(p.health))
+	for dst, h := range p.health {
+		m[dst] = h.healthy.Load()
+	}
+	return m
+}
+
+// probeLoop probes every failover destination until Close.
+func (p *Push) probeLoop() {
+	defer p.probeWg.Done()
+	ticker := time.NewTicker(p.healthCfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stopProbe:
+			return
+		case <-ticker.C:
+		}
+
+		var wg sync.WaitGroup
+		for dst := range p.health {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ctx, cancel := context.WithTimeout(context.Background(), p.healthCfg.Timeout)
+				defer cancel()
+				p.setHealthy(dst, p.healthCfg.Probe(ctx, dst) == nil)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// dialProbe opens and closes a TCP connection to the host of rawURL.
+// UDP destinations are connectionless and always pass.
+func dialProbe(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "udp" || u.Scheme == "syslog" {
+		return nil
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// isDestinationFailure reports whether err means the destination is
+// unavailable, as opposed to rejecting the record itself.
+func isDestinationFailure(err error) bool {
+	return errors.Is(err, client.ErrCircuitOpen) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		client.Retryable(client.StatusCode(err), err)
+}
+
+// fanoutResult returns a FanoutError when any outcome failed.
+func fanoutResult(r *Route, outcomes []Outcome) error {
+	for _, o := range outcomes {
+		if o.Err != nil {
+			return &FanoutError{Route: r.Name, Outcomes: outcomes}
+		}
+	}
+	return nil
+}
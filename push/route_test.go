@@ -0,0 +1,380 @@
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push/client"
+	"github.com/tsmask/go-oam/push/outbox"
+)
+
+// receiver is a test endpoint that records the NeUIDs it accepted.
+type receiver struct {
+	srv    *httptest.Server
+	status atomic.Int32
+	hits   atomic.Int32
+
+	mu    sync.Mutex
+	neUID []string
+}
+
+func newReceiver(t *testing.T, status int) *receiver {
+	r := &receiver{}
+	r.status.Store(int32(status))
+	r.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.hits.Add(1)
+		var rec Record
+		_ = json.NewDecoder(req.Body).Decode(&rec)
+		code := int(r.status.Load())
+		if code < 300 {
+			r.mu.Lock()
+			r.neUID = append(r.neUID, rec.NeUID)
+			r.mu.Unlock()
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(r.srv.Close)
+	return r
+}
+
+func (r *receiver) got() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.neUID...)
+}
+
+func TestRoutes_MatchByTypeAndNeUID(t *testing.T) {
+	alarms, ne9, def := newReceiver(t, 200), newReceiver(t, 200), newReceiver(t, 200)
+	p := New(
+		WithBaseURL(def.srv.URL),
+		WithRoutes(
+			Route{RecordTypes: []string{"alarm"}, Destinations: []string{alarms.srv.URL}},
+			Route{NeUIDs: []string{"ne-9"}, Destinations: []string{ne9.srv.URL}},
+			Route{Name: "empty"}, // ignored: no destinations
+		),
+	)
+	defer p.Close()
+
+	for _, rec := range []*Record{
+		{NeUID: "ne-1", RecordType: "alarm"},
+		{NeUID: "ne-9", RecordType: "alarm"}, // first matching route wins
+		{NeUID: "ne-9", RecordType: "kpi"},
+		{NeUID: "ne-2", RecordType: "kpi"},
+	} {
+		if err := p.Send(rec, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// An explicit URL bypasses routing
+	if err := p.Send(&Record{NeUID: "ne-3", RecordType: "alarm"}, &SendParams{URL: def.srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		r    *receiver
+		want []string
+	}{
+		"alarms":  {alarms, []string{"ne-1", "ne-9"}},
+		"ne-9":    {ne9, []string{"ne-9"}},
+		"default": {def, []string{"ne-2", "ne-3"}},
+	} {
+		if got := tc.r.got(); len(got) != len(tc.want) || got[0] != tc.want[0] || got[len(got)-1] != tc.want[len(tc.want)-1] {
+			t.Errorf("%s received %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestRoutes_FailoverAndProbe(t *testing.T) {
+	primary, secondary := newReceiver(t, http.StatusServiceUnavailable), newReceiver(t, 200)
+
+	var probeOK atomic.Bool
+	var changes atomic.Int32
+	p := New(
+		WithRoutes(Route{Destinations: []string{primary.srv.URL, secondary.srv.URL}}),
+		WithHealthCheck(HealthConfig{
+			Interval: 10 * time.Millisecond,
+			Probe: func(ctx context.Context, url string) error {
+				if url == primary.srv.URL && !probeOK.Load() {
+					return errors.New("down")
+				}
+				return nil
+			},
+			OnChange: func(url string, healthy bool) { changes.Add(1) },
+		}),
+	)
+	defer p.Close()
+
+	if err := p.Send(&Record{NeUID: "ne-1"}, nil); err != nil {
+		t.Fatalf("Send with healthy secondary = %v", err)
+	}
+	if h := p.Health(); h[primary.srv.URL] || !h[secondary.srv.URL] {
+		t.Fatalf("health = %v, want primary down", h)
+	}
+
+	// While the primary is unhealthy, sends go straight to the secondary.
+	// The first send or the first probe, whichever came first, marked it down.
+	if err := p.SendAsync(&Record{NeUID: "ne-2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Send(&Record{NeUID: "ne-3"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := primary.hits.Load(); n > 1 {
+		t.Fatalf("primary hits = %d, want at most 1", n)
+	}
+
+	// A successful probe restores the primary
+	primary.status.Store(200)
+	probeOK.Store(true)
+	deadline := time.Now().Add(time.Second)
+	for !p.Health()[primary.srv.URL] {
+		if time.Now().After(deadline) {
+			t.Fatal("primary not restored by probe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := p.Send(&Record{NeUID: "ne-4"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := primary.got(); len(got) != 1 || got[0] != "ne-4" {
+		t.Fatalf("primary received %v, want [ne-4]", got)
+	}
+	if n := changes.Load(); n != 2 {
+		t.Fatalf("health changes = %d, want 2", n)
+	}
+}
+
+func TestRoutes_FailoverAsyncOnDeliveryFailure(t *testing.T) {
+	primary, secondary := newReceiver(t, http.StatusServiceUnavailable), newReceiver(t, 200)
+	dlq := client.NewDeadLetterQueue(10)
+	var reported atomic.Int32
+	p := New(
+		WithRoutes(Route{Destinations: []string{primary.srv.URL, secondary.srv.URL}}),
+		WithHealthCheck(HealthConfig{Interval: time.Hour}),
+		WithDeadLetter(dlq),
+		WithOnResult(func(client.Result) { reported.Add(1) }),
+	)
+	defer p.Close()
+
+	// The primary takes the job at enqueue time and fails it with 503.
+	results := make(chan client.Result, 2)
+	err := p.SendAsync(&Record{NeUID: "ne-1"}, &SendParams{
+		OnResult: func(r client.Result) { results <- r },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-results:
+		if r.Err != nil || r.URL != secondary.srv.URL {
+			t.Fatalf("result = %+v, want success on the secondary", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result")
+	}
+	select {
+	case r := <-results:
+		t.Fatalf("extra result %+v, want only the final outcome", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The primary failure was handed over, not settled.
+	if n := reported.Load(); n != 1 {
+		t.Fatalf("WithOnResult calls = %d, want 1", n)
+	}
+	if st := p.Stats(); dlq.Len() != 0 || st.FailedCount != 0 || st.TotalProcessed != 1 {
+		t.Fatalf("dead letters = %d, stats = %+v, want no failure", dlq.Len(), st)
+	}
+	if h := p.Health(); h[primary.srv.URL] || !h[secondary.srv.URL] {
+		t.Fatalf("health = %v, want primary down", h)
+	}
+	if got := secondary.got(); len(got) != 1 || got[0] != "ne-1" {
+		t.Fatalf("secondary received %v, want [ne-1]", got)
+	}
+
+	// The next async send skips the unhealthy primary.
+	if err := p.SendAsync(&Record{NeUID: "ne-2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(secondary.got()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("second record not delivered to the secondary")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := primary.hits.Load(); n != 1 {
+		t.Fatalf("primary hits = %d, want 1", n)
+	}
+}
+
+func TestRoutes_FailoverAsyncWithOutbox(t *testing.T) {
+	primary, secondary := newReceiver(t, http.StatusServiceUnavailable), newReceiver(t, 200)
+	ob, err := outbox.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Close()
+	p := New(
+		WithRoutes(Route{Destinations: []string{primary.srv.URL, secondary.srv.URL}}),
+		WithHealthCheck(HealthConfig{Interval: time.Hour}),
+		WithOutbox(ob),
+	)
+	defer p.Close()
+
+	// The failed record leaves the primary's outbox entry and is not
+	// retained for replay to the primary.
+	results := make(chan client.Result, 2)
+	err = p.SendAsync(&Record{NeUID: "ne-1"}, &SendParams{
+		OnResult: func(r client.Result) { results <- r },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case r := <-results:
+		if r.Err != nil || r.Retained || r.URL != secondary.srv.URL {
+			t.Fatalf("result = %+v, want success on the secondary", r)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no result")
+	}
+	if st := p.Stats(); st.OutboxRecords != 0 || st.FailedCount != 0 {
+		t.Fatalf("stats = %+v, want empty outbox and no failure", st)
+	}
+	if n := primary.hits.Load(); n != 1 {
+		t.Fatalf("primary hits = %d, want 1", n)
+	}
+}
+
+func TestRoutes_FailoverStopsOnRecordRejection(t *testing.T) {
+	primary, secondary := newReceiver(t, http.StatusBadRequest), newReceiver(t, 200)
+	p := New(WithRoutes(Route{Destinations: []string{primary.srv.URL, secondary.srv.URL}}))
+	defer p.Close()
+
+	err := p.Send(&Record{NeUID: "ne-1"}, nil)
+	if client.StatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("err = %v, want http 400", err)
+	}
+	if n := secondary.hits.Load(); n != 0 {
+		t.Fatalf("secondary hits = %d, want 0", n)
+	}
+	if !p.Health()[primary.srv.URL] {
+		t.Fatal("400 marked the primary unhealthy")
+	}
+}
+
+func TestRoutes_FanoutOutcomes(t *testing.T) {
+	a, b := newReceiver(t, 200), newReceiver(t, http.StatusInternalServerError)
+	p := New(WithRoutes(Route{
+		Name:         "kpi",
+		RecordTypes:  []string{"kpi"},
+		Destinations: []string{a.srv.URL, b.srv.URL},
+		Mode:         RouteFanout,
+	}))
+	defer p.Close()
+
+	err := p.Send(&Record{NeUID: "ne-1", RecordType: "kpi"}, nil)
+	var fe *FanoutError
+	if !errors.As(err, &fe) {
+		t.Fatalf("err = %v, want *FanoutError", err)
+	}
+	if fe.Route != "kpi" || len(fe.Outcomes) != 2 {
+		t.Fatalf("fan-out error = %+v", fe)
+	}
+	if o := fe.Outcomes[0]; o.URL != a.srv.URL || o.Err != nil {
+		t.Fatalf("outcome[0] = %+v, want success", o)
+	}
+	if o := fe.Outcomes[1]; o.URL != b.srv.URL || client.StatusCode(o.Err) != 500 {
+		t.Fatalf("outcome[1] = %+v, want http 500", o)
+	}
+	if client.StatusCode(err) != 500 {
+		t.Fatal("per-destination errors not reachable with errors.As")
+	}
+
+	b.status.Store(200)
+	if err := p.Send(&Record{NeUID: "ne-2", RecordType: "kpi"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.got()) != 2 || len(b.got()) != 1 {
+		t.Fatalf("a received %v, b received %v", a.got(), b.got())
+	}
+}
+
+func TestDialProbe(t *testing.T) {
+	up := newReceiver(t, 200)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := dialProbe(ctx, up.srv.URL+"/api/push"); err != nil {
+		t.Fatalf("probe of listening receiver = %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	if err := dialProbe(ctx, "http://"+addr+"/api/push"); err == nil {
+		t.Fatal("probe of closed port succeeded")
+	}
+}
+
+func TestRoutes_FanoutAsyncReportsEachDestination(t *testing.T) {
+	a, b := newReceiver(t, 200), newReceiver(t, http.StatusBadRequest)
+	dlq := client.NewDeadLetterQueue(10)
+	p := New(
+		WithDeadLetter(dlq),
+		WithRoutes(Route{Destinations: []string{a.srv.URL, b.srv.URL}, Mode: RouteFanout}),
+	)
+	defer p.Close()
+
+	results := make(chan client.Result, 2)
+	err := p.SendAsync(&Record{NeUID: "ne-1"}, &SendParams{
+		OnResult: func(r client.Result) { results <- r },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]client.Result{}
+	for range 2 {
+		select {
+		case r := <-results:
+			got[r.URL] = r
+		case <-time.After(time.Second):
+			t.Fatalf("results = %v, want one per destination", got)
+		}
+	}
+	if r := got[a.srv.URL]; r.Err != nil {
+		t.Fatalf("result for a = %+v, want success", r)
+	}
+	if r := got[b.srv.URL]; r.Status != http.StatusBadRequest {
+		t.Fatalf("result for b = %+v, want http 400", r)
+	}
+	if rec, err := ResultRecord(got[b.srv.URL]); err != nil || rec.NeUID != "ne-1" {
+		t.Fatalf("ResultRecord = %+v, %v", rec, err)
+	}
+	if dlq.Len() != 1 {
+		t.Fatalf("dead letters = %d, want 1", dlq.Len())
+	}
+
+	b.status.Store(200)
+	if n, err := p.Redrive(dlq); n != 1 || err != nil {
+		t.Fatalf("Redrive = %d, %v; want 1", n, err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(b.got()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("redriven record not delivered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
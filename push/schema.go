@@ -0,0 +1,95 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tsmask/go-oam/push/schema"
+)
+
+// WithSchemas validates RecordData against reg before Send and SendAsync.
+//
+// Records whose RecordType has a schema and whose data does not match are
+// not sent; Send and SendAsync return a *schema.ValidationError listing
+// the invalid fields. Record types without a schema are sent unchecked.
+//
+// Example:
+//
+//	reg := schema.Builtin()
+//	reg.Register("backup", schema.Struct[BackupReport]())
+//	p := push.New(push.WithSchemas(reg))
+//
+//	var ve *schema.ValidationError
+//	if err := p.Send(record, nil); errors.As(err, &ve) {
+//	    for _, f := range ve.Fields {
+//	        log.Printf("%s: %s", f.Path, f.Msg)
+//	    }
+//	}
+func WithSchemas(reg *schema.Registry) Option {
+	return func(p *Push) { p.schemas = reg }
+}
+
+// validate checks record against the configured schemas.
+func (p *Push) validate(record *Record) error {
+	if p.schemas == nil {
+		return nil
+	}
+	return p.schemas.Validate(record.RecordType, record.RecordData)
+}
+
+// NewRecord creates a record of recordType for neUID with data encoded as
+// RecordData. RecordTime and ID are set when the record is sent.
+func NewRecord(recordType, neUID string, data any) (*Record, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode %s record data: %w", recordType, err)
+	}
+	return &Record{NeUID: neUID, RecordType: recordType, RecordData: b}, nil
+}
+
+// newChecked validates data with the built-in struct rules and creates a
+// record of recordType.
+func newChecked(recordType, neUID string, data any) (*Record, error) {
+	if err := schema.Check(data); err != nil {
+		var ve *schema.ValidationError
+		if errors.As(err, &ve) {
+			ve.RecordType = recordType
+		}
+		return nil, err
+	}
+	return NewRecord(recordType, neUID, data)
+}
+
+// NewAlarm creates an "alarm" record. Returns a *schema.ValidationError
+// when a is invalid.
+//
+// Example:
+//
+//	rec, err := push.NewAlarm("ne-001", schema.Alarm{
+//	    AlarmID:  "link-down-eth0",
+//	    Severity: schema.SeverityMajor,
+//	    Object:   "eth0",
+//	    Text:     "link down",
+//	})
+func NewAlarm(neUID string, a schema.Alarm) (*Record, error) {
+	return newChecked(schema.TypeAlarm, neUID, &a)
+}
+
+// NewKPI creates a "kpi" record. Returns a *schema.ValidationError when k
+// is invalid.
+func NewKPI(neUID string, k schema.KPI) (*Record, error) {
+	return newChecked(schema.TypeKPI, neUID, &k)
+}
+
+// NewEvent creates an "event" record. Returns a *schema.ValidationError
+// when e is invalid.
+func NewEvent(neUID string, e schema.Event) (*Record, error) {
+	return newChecked(schema.TypeEvent, neUID, &e)
+}
+
+// NewHeartbeat creates a "heartbeat" record. Returns a
+// *schema.ValidationError when h is invalid.
+func NewHeartbeat(neUID string, h schema.Heartbeat) (*Record, error) {
+	return newChecked(schema.TypeHeartbeat, neUID, &h)
+}
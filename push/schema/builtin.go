@@ -0,0 +1,90 @@
+package schema
+
+// Built-in record types.
+const (
+	TypeAlarm     = "alarm"
+	TypeKPI       = "kpi"
+	TypeEvent     = "event"
+	TypeHeartbeat = "heartbeat"
+	TypeAlarmSync = "alarm_sync"
+)
+
+// Alarm severities, in decreasing order of severity.
+const (
+	SeverityCritical      = "critical"
+	SeverityMajor         = "major"
+	SeverityMinor         = "minor"
+	SeverityWarning       = "warning"
+	SeverityIndeterminate = "indeterminate"
+	SeverityCleared       = "cleared"
+)
+
+// Alarm is the record data of an "alarm" record.
+type Alarm struct {
+	AlarmID       string            `json:"alarm_id" validate:"required"`                                                          // Alarm type identifier, e.g. "link-down"
+	CorrelationID string            `json:"correlation_id,omitempty"`                                                              // Links the raise and clear of one alarm instance
+	Code          string            `json:"code,omitempty"`                                                                        // Vendor alarm code
+	Severity      string            `json:"severity" validate:"required,oneof=critical major minor warning indeterminate cleared"` // Perceived severity
+	Object        string            `json:"object,omitempty"`                                                                      // Managed object the alarm is raised on
+	ProbableCause string            `json:"probable_cause,omitempty"`                                                              // Probable cause
+	Text          string            `json:"text,omitempty" validate:"max=1024"`                                                    // Additional text
+	EventTime     int64             `json:"event_time,omitempty" validate:"min=0"`                                                 // Time the condition was detected (UTC milliseconds)
+	Extra         map[string]string `json:"extra,omitempty"`                                                                       // Additional attributes
+}
+
+// AlarmSync is the record data of an "alarm_sync" record: the complete
+// set of active alarms of one NE. Receivers clear alarms of the NE that
+// are not in the snapshot.
+type AlarmSync struct {
+	Alarms []Alarm `json:"alarms"` // Active alarms, may be empty
+}
+
+// KPI is the record data of a "kpi" record: counters or gauges measured
+// over one collection period.
+type KPI struct {
+	Object string             `json:"object,omitempty"`                  // Measured object, e.g. an interface or a cell
+	Period int                `json:"period,omitempty" validate:"min=0"` // Collection period in seconds
+	Values map[string]float64 `json:"values" validate:"required"`        // KPI name → value
+}
+
+// Event is the record data of an "event" record: a notable occurrence
+// that has no raise/clear lifecycle, such as a configuration change.
+type Event struct {
+	Name      string            `json:"name" validate:"required"`                                              // Event name
+	Object    string            `json:"object,omitempty"`                                                      // Object the event concerns
+	Severity  string            `json:"severity,omitempty" validate:"oneof=critical major minor warning info"` // Optional severity
+	Text      string            `json:"text,omitempty" validate:"max=1024"`                                    // Description
+	EventTime int64             `json:"event_time,omitempty" validate:"min=0"`                                 // Time of the event (UTC milliseconds)
+	Params    map[string]string `json:"params,omitempty"`                                                      // Event parameters
+}
+
+// Heartbeat is the record data of a "heartbeat" record.
+type Heartbeat struct {
+	Status  string `json:"status" validate:"required,oneof=up degraded down"` // Overall NE status
+	Uptime  int64  `json:"uptime,omitempty" validate:"min=0"`                 // Seconds since start
+	Version string `json:"version,omitempty"`                                 // Software version
+	Seq     uint64 `json:"seq,omitempty"`                                     // Heartbeat counter, for gap detection
+}
+
+// Validate implements Validator.
+func (k *KPI) Validate() error {
+	for name := range k.Values {
+		if name == "" {
+			return &ValidationError{Fields: []FieldError{{Path: "values", Msg: "KPI name must not be empty"}}}
+		}
+	}
+	return nil
+}
+
+// Builtin returns a new registry with schemas for the built-in record
+// types: alarm, alarm_sync, kpi, event, and heartbeat. More schemas can be registered
+// on it.
+func Builtin() *Registry {
+	r := NewRegistry()
+	r.Register(TypeAlarm, Struct[Alarm]())
+	r.Register(TypeAlarmSync, Struct[AlarmSync]())
+	r.Register(TypeKPI, Struct[KPI]())
+	r.Register(TypeEvent, Struct[Event]())
+	r.Register(TypeHeartbeat, Struct[Heartbeat]())
+	return r
+}
@@ -0,0 +1,334 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchema is a compiled JSON Schema node.
+type jsonSchema struct {
+	types      []string
+	properties map[string]*jsonSchema
+	required   []string
+	additional *bool // additionalProperties: false rejects unknown properties
+	items      *jsonSchema
+	enum       []any
+	minimum    *float64
+	maximum    *float64
+	minLength  *int
+	maxLength  *int
+	minItems   *int
+	maxItems   *int
+	pattern    *regexp.Regexp
+}
+
+// rawSchema is the decoded form of a JSON Schema node. Subschemas are kept
+// raw so that each node's keywords can be checked before it is compiled.
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties *bool                      `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []any                      `json:"enum"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	Pattern              string                     `json:"pattern"`
+}
+
+// keywords lists the keywords JSON accepts: the validation keywords of
+// rawSchema plus annotations that do not affect validation.
+var keywords = map[string]bool{
+	"type": true, "properties": true, "required": true, "additionalProperties": true,
+	"items": true, "enum": true, "minimum": true, "maximum": true,
+	"minLength": true, "maxLength": true, "minItems": true, "maxItems": true, "pattern": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// JSON compiles a JSON Schema document.
+//
+// The supported subset covers what record data schemas typically need:
+// type (a name or a list of names), properties, required,
+// additionalProperties (boolean only), items, enum, minimum, maximum,
+// minLength, maxLength, minItems, maxItems, and pattern. Annotations such
+// as $schema, title, and description are accepted and ignored. Any other
+// keyword, such as format or oneOf, is an error rather than being silently
+// skipped, so a schema never validates less than it appears to.
+//
+// Example:
+//
+//	s, err := schema.JSON([]byte(`{
+//	    "type": "object",
+//	    "required": ["license_id", "expires"],
+//	    "properties": {
+//	        "license_id": {"type": "string", "minLength": 1},
+//	        "expires":    {"type": "integer", "minimum": 0}
+//	    },
+//	    "additionalProperties": false
+//	}`))
+func JSON(doc []byte) (Schema, error) {
+	return compile(doc, "")
+}
+
+func compile(doc json.RawMessage, path string) (*jsonSchema, error) {
+	var node map[string]json.RawMessage
+	if err := json.Unmarshal(doc, &node); err != nil {
+		return nil, fmt.Errorf("decode json schema: %s: %w", schemaPath(path), err)
+	}
+	names := make([]string, 0, len(node))
+	for name := range node {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !keywords[name] {
+			return nil, fmt.Errorf("%s: unsupported keyword %q", schemaPath(path), name)
+		}
+	}
+	var raw rawSchema
+	if err := json.Unmarshal(doc, &raw); err != nil {
+		return nil, fmt.Errorf("decode json schema: %s: %w", schemaPath(path), err)
+	}
+
+	s := &jsonSchema{
+		required:   raw.Required,
+		additional: raw.AdditionalProperties,
+		enum:       raw.Enum,
+		minimum:    raw.Minimum,
+		maximum:    raw.Maximum,
+		minLength:  raw.MinLength,
+		maxLength:  raw.MaxLength,
+		minItems:   raw.MinItems,
+		maxItems:   raw.MaxItems,
+	}
+
+	if len(raw.Type) > 0 {
+		var one string
+		if err := json.Unmarshal(raw.Type, &one); err == nil {
+			s.types = []string{one}
+		} else if err := json.Unmarshal(raw.Type, &s.types); err != nil {
+			return nil, fmt.Errorf("%s: type must be a string or an array of strings", schemaPath(path))
+		}
+		for _, t := range s.types {
+			switch t {
+			case "object", "array", "string", "number", "integer", "boolean", "null":
+			default:
+				return nil, fmt.Errorf("%s: unknown type %q", schemaPath(path), t)
+			}
+		}
+	}
+	if raw.Pattern != "" {
+		re, err := regexp.Compile(raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: pattern: %w", schemaPath(path), err)
+		}
+		s.pattern = re
+	}
+	if len(raw.Properties) > 0 {
+		s.properties = make(map[string]*jsonSchema, len(raw.Properties))
+		for name, p := range raw.Properties {
+			if isNull(p) {
+				continue
+			}
+			c, err := compile(p, joinPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			s.properties[name] = c
+		}
+	}
+	if !isNull(raw.Items) {
+		c, err := compile(raw.Items, path+"[]")
+		if err != nil {
+			return nil, err
+		}
+		s.items = c
+	}
+	return s, nil
+}
+
+// isNull reports whether a subschema is absent or JSON null.
+func isNull(raw json.RawMessage) bool {
+	return len(raw) == 0 || string(raw) == "null"
+}
+
+func schemaPath(path string) string {
+	if path == "" {
+		return "schema"
+	}
+	return "schema " + path
+}
+
+// Validate implements Schema.
+func (s *jsonSchema) Validate(data json.RawMessage) error {
+	var v any
+	if len(bytes.TrimSpace(data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return &ValidationError{Fields: []FieldError{{Msg: "invalid JSON: " + err.Error()}}}
+		}
+	}
+
+	var fields []FieldError
+	s.check(v, "", &fields)
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// check validates v and appends its errors to fields.
+func (s *jsonSchema) check(v any, path string, fields *[]FieldError) {
+	fail := func(format string, args ...any) {
+		*fields = append(*fields, FieldError{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.types) > 0 && !slices.ContainsFunc(s.types, func(t string) bool { return isType(v, t) }) {
+		fail("must be %s, got %s", strings.Join(s.types, " or "), jsonType(v))
+		return
+	}
+	if len(s.enum) > 0 && !slices.ContainsFunc(s.enum, func(e any) bool { return jsonEqual(e, v) }) {
+		fail("must be one of %s", enumList(s.enum))
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := v[name]; !ok {
+				*fields = append(*fields, FieldError{Path: joinPath(path, name), Msg: "is required"})
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.properties[name]; ok {
+				p.check(v[name], joinPath(path, name), fields)
+			} else if s.additional != nil && !*s.additional {
+				*fields = append(*fields, FieldError{Path: joinPath(path, name), Msg: "unknown field"})
+			}
+		}
+	case []any:
+		if s.minItems != nil && len(v) < *s.minItems {
+			fail("must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(v) > *s.maxItems {
+			fail("must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range v {
+				s.items.check(item, path+"["+strconv.Itoa(i)+"]", fields)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.minLength != nil && n < *s.minLength {
+			fail("length must be at least %d", *s.minLength)
+		}
+		if s.maxLength != nil && n > *s.maxLength {
+			fail("length must be at most %d", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %s", s.pattern)
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if s.minimum != nil && f < *s.minimum {
+			fail("must be at least %s", formatFloat(*s.minimum))
+		}
+		if s.maximum != nil && f > *s.maximum {
+			fail("must be at most %s", formatFloat(*s.maximum))
+		}
+	}
+}
+
+// isType reports whether v, decoded with UseNumber, has JSON Schema type t.
+func isType(v any, t string) bool {
+	switch v := v.(type) {
+	case map[string]any:
+		return t == "object"
+	case []any:
+		return t == "array"
+	case string:
+		return t == "string"
+	case bool:
+		return t == "boolean"
+	case nil:
+		return t == "null"
+	case json.Number:
+		if t == "number" {
+			return true
+		}
+		if t != "integer" {
+			return false
+		}
+		if _, err := v.Int64(); err == nil {
+			return true
+		}
+		f, err := v.Float64()
+		return err == nil && f == math.Trunc(f)
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type name of v.
+func jsonType(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// jsonEqual compares an enum value (decoded without UseNumber) with v.
+func jsonEqual(e, v any) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		ef, isNum := e.(float64)
+		return err == nil && isNum && f == ef
+	}
+	a, errA := json.Marshal(e)
+	b, errB := json.Marshal(v)
+	return errors.Join(errA, errB) == nil && bytes.Equal(a, b)
+}
+
+func enumList(enum []any) string {
+	parts := make([]string, len(enum))
+	for i, e := range enum {
+		b, _ := json.Marshal(e)
+		parts[i] = string(b)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,359 @@
+// Package schema validates push record data per RecordType.
+//
+// A Registry maps record types to schemas. A schema is either a Go struct
+// (see Struct), checked with `validate` struct tags and an optional
+// Validate method, or a JSON Schema document (see JSON). Validation errors
+// are reported per field as a *ValidationError.
+//
+// Usage Example:
+//
+//	reg := schema.Builtin() // alarm, kpi, event, heartbeat
+//	reg.Register("backup", schema.Struct[BackupReport]())
+//	if err := reg.RegisterJSON("license", licenseSchema); err != nil {
+//	    return err
+//	}
+//
+//	p := push.New(push.WithSchemas(reg))
+//	err := p.Send(record, nil) // *schema.ValidationError before anything is sent
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FieldError describes one invalid field.
+type FieldError struct {
+	Path string // JSON path of the field, e.g. "values.cpu" or "items[2].name"; empty for the whole document
+	Msg  string // Reason the field is invalid
+}
+
+// String returns "path: msg".
+func (e FieldError) String() string {
+	if e.Path == "" {
+		return e.Msg
+	}
+	return e.Path + ": " + e.Msg
+}
+
+// ValidationError is returned when record data does not match its schema.
+type ValidationError struct {
+	RecordType string       // Record type whose schema failed, set by Registry
+	Fields     []FieldError // Invalid fields, in document order where possible
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		msgs[i] = f.String()
+	}
+	if e.RecordType == "" {
+		return "invalid record data: " + strings.Join(msgs, "; ")
+	}
+	return fmt.Sprintf("invalid %s record data: %s", e.RecordType, strings.Join(msgs, "; "))
+}
+
+// Schema validates the record data of one record type.
+type Schema interface {
+	// Validate checks data and returns a *ValidationError listing the
+	// invalid fields, or nil when data is valid.
+	Validate(data json.RawMessage) error
+}
+
+// Validator can be implemented by struct schema types for checks that
+// struct tags cannot express. Return a *ValidationError to report
+// specific fields; any other error is reported for the whole document.
+type Validator interface {
+	Validate() error
+}
+
+// Registry maps record types to schemas. Record types without a schema
+// are not validated. Thread-safe.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]Schema
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]Schema)}
+}
+
+// Register sets the schema of recordType, replacing any previous one.
+func (r *Registry) Register(recordType string, s Schema) {
+	r.mu.Lock()
+	r.schemas[recordType] = s
+	r.mu.Unlock()
+}
+
+// RegisterJSON compiles a JSON Schema document and registers it for
+// recordType. See JSON for the supported keywords.
+func (r *Registry) RegisterJSON(recordType string, doc []byte) error {
+	s, err := JSON(doc)
+	if err != nil {
+		return fmt.Errorf("schema %s: %w", recordType, err)
+	}
+	r.Register(recordType, s)
+	return nil
+}
+
+// Lookup returns the schema of recordType.
+func (r *Registry) Lookup(recordType string) (Schema, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.schemas[recordType]
+	return s, ok
+}
+
+// Types returns the record types that have a schema.
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.schemas))
+	for t := range r.schemas {
+		types = append(types, t)
+	}
+	return types
+}
+
+// Validate checks data against the schema of recordType. Returns nil when
+// recordType has no schema.
+func (r *Registry) Validate(recordType string, data json.RawMessage) error {
+	s, ok := r.Lookup(recordType)
+	if !ok {
+		return nil
+	}
+	err := s.Validate(data)
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		ve.RecordType = recordType
+	}
+	return err
+}
+
+// ============================================================================
+// Struct schemas
+// ============================================================================
+
+// structSchema validates data by decoding it into T.
+type structSchema[T any] struct{}
+
+// Struct returns a schema that decodes record data into T and checks it.
+//
+// Decoding rejects unknown fields and values of the wrong type. Fields are
+// then checked against their `validate` tag, a comma-separated list of:
+//
+//	required     the value must not be the zero value
+//	oneof=a b c  the value must be one of the space-separated words
+//	min=n        numbers must be >= n; strings, slices and maps need len >= n
+//	max=n        numbers must be <= n; strings, slices and maps need len <= n
+//
+// Nested structs, pointers to structs, and slices and maps of structs are
+// checked recursively. Finally, if *T or T implements Validator, its
+// Validate method is called.
+//
+// Example:
+//
+//	type Backup struct {
+//	    Job    string `json:"job" validate:"required"`
+//	    Result string `json:"result" validate:"required,oneof=ok failed"`
+//	    Bytes  int64  `json:"bytes" validate:"min=0"`
+//	}
+//	reg.Register("backup", schema.Struct[Backup]())
+func Struct[T any]() Schema {
+	return structSchema[T]{}
+}
+
+// Validate implements Schema.
+func (structSchema[T]) Validate(data json.RawMessage) error {
+	var v T
+	if len(bytes.TrimSpace(data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&v); err != nil {
+			return &ValidationError{Fields: []FieldError{decodeFieldError(err)}}
+		}
+	}
+	// Missing data is checked as the zero value, so required fields are reported.
+	return Check(&v)
+}
+
+// Check validates v, a struct or pointer to struct, with the rules of
+// Struct. Returns a *ValidationError or nil.
+func Check(v any) error {
+	var fields []FieldError
+	checkValue(reflect.ValueOf(v), "", &fields)
+
+	if val, ok := v.(Validator); ok {
+		if err := val.Validate(); err != nil {
+			var ve *ValidationError
+			if errors.As(err, &ve) {
+				fields = append(fields, ve.Fields...)
+			} else {
+				fields = append(fields, FieldError{Msg: err.Error()})
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// decodeFieldError converts a JSON decoding error to a FieldError.
+func decodeFieldError(err error) FieldError {
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &te) {
+		return FieldError{Path: te.Field, Msg: fmt.Sprintf("must be %s, got %s", typeName(te.Type), te.Value)}
+	}
+	msg := err.Error()
+	if name, ok := strings.CutPrefix(msg, "json: unknown field "); ok {
+		return FieldError{Path: strings.Trim(name, `"`), Msg: "unknown field"}
+	}
+	return FieldError{Msg: msg}
+}
+
+// typeName returns the JSON type name of a Go type.
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// checkValue applies the validate tags of struct v and recurses into nested
+// structs.
+func checkValue(v reflect.Value, path string, fields *[]FieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			sf := t.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fv := v.Field(i)
+			fp := joinPath(path, jsonName(sf))
+			if tag := sf.Tag.Get("validate"); tag != "" {
+				if msg := checkTag(fv, tag); msg != "" {
+					*fields = append(*fields, FieldError{Path: fp, Msg: msg})
+					continue
+				}
+			}
+			checkValue(fv, fp, fields)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			checkValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", fields)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			checkValue(iter.Value(), joinPath(path, fmt.Sprint(iter.Key().Interface())), fields)
+		}
+	}
+}
+
+// checkTag returns the first rule of tag that v violates, or "".
+func checkTag(v reflect.Value, tag string) string {
+	for rule := range strings.SplitSeq(tag, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "required":
+			if v.IsZero() {
+				return "is required"
+			}
+		case "oneof":
+			if v.IsZero() {
+				continue // combine with required to reject empty values
+			}
+			s := fmt.Sprint(reflect.Indirect(v).Interface())
+			words := strings.Fields(arg)
+			if !slices.Contains(words, s) {
+				return fmt.Sprintf("must be one of %s, got %q", strings.Join(words, ", "), s)
+			}
+		case "min", "max":
+			bound, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			n, isLen, ok := measure(v)
+			if !ok {
+				continue
+			}
+			if name == "min" && n < bound {
+				return boundMsg("at least", bound, isLen)
+			}
+			if name == "max" && n > bound {
+				return boundMsg("at most", bound, isLen)
+			}
+		}
+	}
+	return ""
+}
+
+// measure returns the number or length that min/max apply to.
+func measure(v reflect.Value) (n float64, isLen, ok bool) {
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false, true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false, true
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), true, true
+	}
+	return 0, false, false
+}
+
+func boundMsg(rel string, bound float64, isLen bool) string {
+	b := formatFloat(bound)
+	if isLen {
+		return "length must be " + rel + " " + b
+	}
+	return "must be " + rel + " " + b
+}
+
+// jsonName returns the JSON field name of sf.
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
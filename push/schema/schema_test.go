@@ -0,0 +1,164 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fields returns the field errors of err as "path: msg" strings.
+func fields(t *testing.T, err error) []string {
+	t.Helper()
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("err = %v, want *ValidationError", err)
+	}
+	out := make([]string, len(ve.Fields))
+	for i, f := range ve.Fields {
+		out[i] = f.String()
+	}
+	return out
+}
+
+type port struct {
+	Name  string `json:"name" validate:"required"`
+	Speed int    `json:"speed" validate:"min=1,max=400000"`
+}
+
+type device struct {
+	Host  string          `json:"host" validate:"required,max=8"`
+	Role  string          `json:"role" validate:"oneof=core edge"`
+	Ports []port          `json:"ports" validate:"min=1"`
+	Tags  map[string]port `json:"tags,omitempty"`
+}
+
+func (d *device) Validate() error {
+	if d.Role == "edge" && len(d.Ports) > 2 {
+		return &ValidationError{Fields: []FieldError{{Path: "ports", Msg: "edge devices have at most 2 ports"}}}
+	}
+	return nil
+}
+
+func TestStruct_TagsAndValidator(t *testing.T) {
+	s := Struct[device]()
+
+	if err := s.Validate(json.RawMessage(`{"host":"r1","role":"core","ports":[{"name":"eth0","speed":1000}]}`)); err != nil {
+		t.Fatalf("valid data: %v", err)
+	}
+
+	tests := map[string]struct {
+		data string
+		want []string
+	}{
+		"tags": {
+			`{"host":"router-0001","role":"spine","ports":[{"speed":0}]}`,
+			[]string{
+				"host: length must be at most 8",
+				`role: must be one of core, edge, got "spine"`,
+				"ports[0].name: is required",
+				"ports[0].speed: must be at least 1",
+			},
+		},
+		"validator": {
+			`{"host":"r1","role":"edge","ports":[{"name":"a","speed":1},{"name":"b","speed":1},{"name":"c","speed":1}]}`,
+			[]string{"ports: edge devices have at most 2 ports"},
+		},
+		"nested map":   {`{"host":"r1","ports":[{"name":"a","speed":1}],"tags":{"up":{"speed":1}}}`, []string{"tags.up.name: is required"}},
+		"wrong type":   {`{"host":1}`, []string{"host: must be a string, got number"}},
+		"unknown":      {`{"host":"r1","color":"red"}`, []string{"color: unknown field"}},
+		"empty data":   {``, []string{"host: is required", "ports: length must be at least 1"}},
+		"invalid json": {`{`, []string{"unexpected EOF"}},
+	}
+	for name, tc := range tests {
+		got := fields(t, s.Validate(json.RawMessage(tc.data)))
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: fields = %q, want %q", name, got, tc.want)
+		}
+	}
+}
+
+func TestJSON_Subset(t *testing.T) {
+	s, err := JSON([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"type": "object",
+		"required": ["license_id", "expires"],
+		"properties": {
+			"license_id": {"type": "string", "minLength": 3, "pattern": "^L-"},
+			"expires":    {"type": "integer", "minimum": 0},
+			"tier":       {"enum": ["basic", "pro"]},
+			"seats":      {"type": ["integer", "null"], "maximum": 100},
+			"features":   {"type": "array", "minItems": 1, "items": {"type": "string"}}
+		},
+		"additionalProperties": false
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Validate(json.RawMessage(`{"license_id":"L-1","expires":1.0,"tier":"pro","seats":null,"features":["x"]}`)); err != nil {
+		t.Fatalf("valid data: %v", err)
+	}
+
+	got := fields(t, s.Validate(json.RawMessage(`{"license_id":"X","expires":-1.5,"tier":"gold","seats":101,"features":[1],"extra":true}`)))
+	want := []string{
+		"expires: must be integer, got number",
+		"extra: unknown field",
+		"features[0]: must be string, got number",
+		"license_id: length must be at least 3",
+		"license_id: must match ^L-",
+		"seats: must be at most 100",
+		`tier: must be one of "basic", "pro"`,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("fields = %q\nwant %q", got, want)
+	}
+
+	got = fields(t, s.Validate(json.RawMessage(`{}`)))
+	if want := []string{"license_id: is required", "expires: is required"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("fields = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{`{"type":"date"}`, `{"pattern":"("}`, `{"properties":{"a":{"type":7}}}`} {
+		if _, err := JSON([]byte(bad)); err == nil {
+			t.Errorf("JSON(%s) compiled", bad)
+		}
+	}
+
+	// Keywords outside the subset are rejected instead of silently ignored
+	for bad, want := range map[string]string{
+		`{"type":"string","format":"date-time"}`:             `schema: unsupported keyword "format"`,
+		`{"properties":{"a":{"oneOf":[{"type":"string"}]}}}`: `schema a: unsupported keyword "oneOf"`,
+		`{"items":{"title":"n","exclusiveMinimum":0}}`:       `schema []: unsupported keyword "exclusiveMinimum"`,
+		`{"properties":{"a":{"additionalProperties":{}}}}`:   `decode json schema: schema a`,
+	} {
+		if _, err := JSON([]byte(bad)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("JSON(%s) = %v, want %q", bad, err, want)
+		}
+	}
+}
+
+func TestRegistry_Builtin(t *testing.T) {
+	reg := Builtin()
+
+	if err := reg.Validate(TypeAlarm, json.RawMessage(`{"alarm_id":"a-1","severity":"major"}`)); err != nil {
+		t.Fatalf("valid alarm: %v", err)
+	}
+	err := reg.Validate(TypeAlarm, json.RawMessage(`{"severity":"loud"}`))
+	if err == nil || err.Error() != `invalid alarm record data: alarm_id: is required; severity: must be one of critical, major, minor, warning, indeterminate, cleared, got "loud"` {
+		t.Fatalf("err = %v", err)
+	}
+	if got := fields(t, reg.Validate(TypeKPI, json.RawMessage(`{"values":{"":1}}`))); len(got) != 1 || got[0] != "values: KPI name must not be empty" {
+		t.Fatalf("kpi fields = %q", got)
+	}
+	if got := fields(t, reg.Validate(TypeHeartbeat, json.RawMessage(`{}`))); len(got) != 1 || got[0] != "status: is required" {
+		t.Fatalf("heartbeat fields = %q", got)
+	}
+	if err := reg.Validate(TypeEvent, json.RawMessage(`{"name":"config-change","severity":"info"}`)); err != nil {
+		t.Fatalf("valid event: %v", err)
+	}
+	if err := reg.Validate("custom", json.RawMessage(`not json`)); err != nil {
+		t.Fatalf("unregistered type validated: %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package push
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/tsmask/go-oam/push/schema"
+)
+
+func TestSchemas_ValidateBeforeSend(t *testing.T) {
+	recv := newReceiver(t, 200)
+	p := New(WithBaseURL(recv.srv.URL), WithPushURI("/"), WithSchemas(schema.Builtin()))
+	defer p.Close()
+
+	bad := &Record{NeUID: "ne-1", RecordType: schema.TypeAlarm, RecordData: json.RawMessage(`{"severity":"loud"}`)}
+	for name, send := range map[string]func(*Record, *SendParams) error{"Send": p.Send, "SendAsync": p.SendAsync} {
+		err := send(bad, nil)
+		var ve *schema.ValidationError
+		if !errors.As(err, &ve) || ve.RecordType != schema.TypeAlarm || len(ve.Fields) != 2 {
+			t.Fatalf("%s err = %v, want alarm validation error with 2 fields", name, err)
+		}
+	}
+	if bad.ID != "" {
+		t.Fatal("rejected record was assigned an ID")
+	}
+
+	rec, err := NewAlarm("ne-1", schema.Alarm{AlarmID: "link-down", Severity: schema.SeverityMajor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Send(rec, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Types without a schema are not checked
+	if err := p.Send(&Record{NeUID: "ne-2", RecordType: "custom", RecordData: json.RawMessage(`[1]`)}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := recv.got(); len(got) != 2 || recv.hits.Load() != 2 {
+		t.Fatalf("received %v, want only the valid records", got)
+	}
+}
+
+func TestNewAlarm_ReportsFieldErrors(t *testing.T) {
+	_, err := NewAlarm("ne-1", schema.Alarm{Severity: schema.SeverityMinor})
+	var ve *schema.ValidationError
+	if !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Path != "alarm_id" {
+		t.Fatalf("err = %v, want alarm_id required", err)
+	}
+
+	rec, err := NewKPI("ne-1", schema.KPI{Period: 60, Values: map[string]float64{"cpu": 42}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.RecordType != schema.TypeKPI || string(rec.RecordData) != `{"period":60,"values":{"cpu":42}}` {
+		t.Fatalf("record = %+v", rec)
+	}
+}
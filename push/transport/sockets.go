@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrClosed reports that a transport was used after Close.
+var ErrClosed = errors.New("transport closed")
+
+// sockConn is the part of socket.ClientTCP and socket.ClientUDP used by
+// the socket transports.
+type sockConn interface {
+	Connect() error
+	IsConnected() bool
+	Write(data []byte) (int, error)
+	Read() ([]byte, error)
+	Close()
+}
+
+// sockets keeps one pkg/socket client per destination address.
+type sockets struct {
+	dialTimeout time.Duration
+	// newConn returns an unconnected client for host:port. ctx is canceled
+	// by close and must be set as the client's Context.
+	newConn func(ctx context.Context, host, port string, dialTimeout time.Duration) sockConn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	conns  map[string]sockConn
+	closed bool
+}
+
+func newSockets(dialTimeout time.Duration, newConn func(ctx context.Context, host, port string, dialTimeout time.Duration) sockConn) *sockets {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &sockets{
+		dialTimeout: dialTimeout,
+		newConn:     newConn,
+		ctx:         ctx,
+		cancel:      cancel,
+		conns:       make(map[string]sockConn),
+	}
+}
+
+// get returns the client for host:port, connecting one when there is none
+// or the previous one was closed. Connecting happens outside the lock, so
+// a slow destination does not hold up the others.
+func (s *sockets) get(ctx context.Context, host, port string) (sockConn, error) {
+	addr := net.JoinHostPort(host, port)
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if c := s.conns[addr]; c != nil {
+		if c.IsConnected() {
+			s.mu.Unlock()
+			return c, nil
+		}
+		delete(s.conns, addr)
+		defer c.Close()
+	}
+	s.mu.Unlock()
+
+	dial := s.dialTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		dial = min(dial, time.Until(deadline))
+		if dial <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	c := s.newConn(s.ctx, host, port, dial)
+	if err := c.Connect(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.Close()
+		return nil, ErrClosed
+	}
+	if cur := s.conns[addr]; cur != nil && cur.IsConnected() {
+		// Another sender connected concurrently: share its client.
+		c.Close()
+		return cur, nil
+	}
+	go discard(c.Read)
+	s.conns[addr] = c
+	return c, nil
+}
+
+// drop closes c and forgets it if it is still the client for addr.
+func (s *sockets) drop(addr string, c sockConn) {
+	s.mu.Lock()
+	if s.conns[addr] == c {
+		delete(s.conns, addr)
+	}
+	s.mu.Unlock()
+	c.Close()
+}
+
+// close closes every client; later gets fail with ErrClosed.
+func (s *sockets) close() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// discard consumes data the receiver sends back, so a chatty receiver
+// cannot stall the client's read loop. It returns when the client is
+// closed.
+func discard(read func() ([]byte, error)) {
+	for {
+		if _, err := read(); err != nil {
+			return
+		}
+	}
+}
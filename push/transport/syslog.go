@@ -0,0 +1,195 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsmask/go-oam/pkg/socket"
+	"github.com/tsmask/go-oam/push/client"
+)
+
+const (
+	defaultSyslogPort = "514"
+	// maxSyslogSize is the largest UDP payload over IPv4.
+	maxSyslogSize = 65507
+
+	// FacilityLocal0 is the default syslog facility.
+	FacilityLocal0 = 16
+	// SeverityInfo is the default syslog severity (informational).
+	SeverityInfo = 6
+)
+
+// SyslogOption configures a Syslog transport.
+type SyslogOption func(*Syslog)
+
+// WithSyslogFacility sets the facility (0-23). Defaults to local0 (16).
+func WithSyslogFacility(facility int) SyslogOption {
+	return func(s *Syslog) {
+		if facility >= 0 && facility <= 23 {
+			s.facility = facility
+		}
+	}
+}
+
+// WithSyslogSeverity sets the severity (0-7) of every message. Defaults to
+// informational (6).
+func WithSyslogSeverity(severity int) SyslogOption {
+	return func(s *Syslog) {
+		if severity >= 0 && severity <= 7 {
+			s.severity = severity
+		}
+	}
+}
+
+// WithSyslogAppName sets the APP-NAME field. Defaults to "go-oam".
+func WithSyslogAppName(name string) SyslogOption {
+	return func(s *Syslog) { s.appName = headerField(name, 48) }
+}
+
+// WithSyslogHostname sets the HOSTNAME field. Defaults to os.Hostname.
+func WithSyslogHostname(name string) SyslogOption {
+	return func(s *Syslog) { s.hostname = headerField(name, 255) }
+}
+
+// WithSyslogMaxSize sets the largest datagram sent; larger records are
+// rejected with status 413. Defaults to 65507, the UDP limit over IPv4;
+// some collectors accept only 2048.
+func WithSyslogMaxSize(n int) SyslogOption {
+	return func(s *Syslog) {
+		if n > 0 {
+			s.maxSize = min(n, maxSyslogSize)
+		}
+	}
+}
+
+// Syslog is a client.Transport that sends records as RFC 5424 syslog
+// messages over UDP (RFC 5426), one datagram per record.
+//
+// The message is the record's JSON; MSGID is its record_type. A batch is
+// split into its records. Delivery is fire-and-forget: a message succeeds
+// once its datagrams are written, and the reported status is 0. A failed
+// batch is retried as a whole, so collectors may see some records twice.
+//
+// Destinations are "udp://host:port", "syslog://host:port", or
+// "host:port"; the port defaults to 514.
+type Syslog struct {
+	facility int
+	severity int
+	appName  string
+	hostname string
+	procID   string
+	maxSize  int
+
+	conns *sockets
+}
+
+// NewSyslog creates a UDP syslog transport.
+func NewSyslog(opts ...SyslogOption) *Syslog {
+	host, _ := os.Hostname()
+	s := &Syslog{
+		facility: FacilityLocal0,
+		severity: SeverityInfo,
+		appName:  "go-oam",
+		hostname: headerField(host, 255),
+		procID:   strconv.Itoa(os.Getpid()),
+		maxSize:  maxSyslogSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.conns = newSockets(10*time.Second, func(ctx context.Context, host, port string, dial time.Duration) sockConn {
+		return &socket.ClientUDP{Addr: host, Port: port, DialTimeout: dial, Context: ctx}
+	})
+	return s
+}
+
+// Send implements client.Transport.
+func (s *Syslog) Send(ctx context.Context, msg *client.Message) (int, []byte, error) {
+	recs, err := records(msg)
+	if err != nil {
+		return 0, nil, client.StatusError(400, err.Error())
+	}
+	datagrams := make([][]byte, len(recs))
+	now := time.Now()
+	for i, rec := range recs {
+		datagrams[i] = s.format(now, rec)
+		if len(datagrams[i]) > s.maxSize {
+			return 0, nil, client.StatusError(413, fmt.Sprintf("syslog message of %d bytes exceeds %d", len(datagrams[i]), s.maxSize))
+		}
+	}
+
+	host, port, err := hostPort(msg.URL, defaultSyslogPort)
+	if err != nil {
+		return 0, nil, err
+	}
+	addr := net.JoinHostPort(host, port)
+	conn, err := s.conns.get(ctx, host, port)
+	if err != nil {
+		return 0, nil, fmt.Errorf("syslog dial %s: %w", addr, err)
+	}
+	for _, d := range datagrams {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, err
+		}
+		if _, err := conn.Write(d); err != nil {
+			s.conns.drop(addr, conn)
+			if errors.Is(err, socket.ErrClientClosed) {
+				// The socket was closed after an ICMP error.
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, fmt.Errorf("syslog write %s: %w", addr, err)
+		}
+	}
+	return 0, nil, nil
+}
+
+// Close implements client.Transport.
+func (s *Syslog) Close() error {
+	s.conns.close()
+	return nil
+}
+
+// format returns the RFC 5424 message for one JSON record:
+//
+//	<PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID - MSG
+func (s *Syslog) format(now time.Time, rec []byte) []byte {
+	var head struct {
+		RecordType string `json:"record_type"`
+	}
+	_ = json.Unmarshal(rec, &head)
+
+	var b strings.Builder
+	b.Grow(len(rec) + 128)
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s - ",
+		s.facility*8+s.severity,
+		now.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		s.hostname, s.appName, s.procID, headerField(head.RecordType, 32))
+	b.Write(rec)
+	return []byte(b.String())
+}
+
+// headerField returns v as a syslog header field: printable US-ASCII
+// without spaces, at most n characters, or "-" when empty.
+func headerField(v string, n int) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, v)
+	if len(v) > n {
+		v = v[:n]
+	}
+	if v == "" {
+		return "-"
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"time"
+
+	"github.com/tsmask/go-oam/pkg/socket"
+	"github.com/tsmask/go-oam/push/client"
+)
+
+// TCPOption configures a TCP transport.
+type TCPOption func(*TCP)
+
+// WithTCPDialTimeout sets the connect timeout. The request timeout also
+// bounds it. If not set, defaults to 10s.
+func WithTCPDialTimeout(d time.Duration) TCPOption {
+	return func(t *TCP) { t.dialTimeout = d }
+}
+
+// WithTCPWriteTimeout bounds each frame write. If not set, writes are
+// bounded by the request timeout only.
+func WithTCPWriteTimeout(d time.Duration) TCPOption {
+	return func(t *TCP) { t.writeTimeout = d }
+}
+
+// WithTCPKeepAlive sets the TCP keep-alive period.
+func WithTCPKeepAlive(d time.Duration) TCPOption {
+	return func(t *TCP) { t.keepAlive = d }
+}
+
+// TCP is a client.Transport that writes each message as one frame on a
+// persistent TCP connection: a 4-byte big-endian body length followed by
+// the JSON body (a record, or a batch as a JSON array or NDJSON).
+//
+// Delivery is fire-and-forget: a message succeeds once its frame is
+// written, and the reported status is 0. Dial and write errors are
+// retried like HTTP connection errors; the broken connection is discarded
+// and the next attempt dials again.
+//
+// Destinations are "tcp://host:port" or "host:port".
+type TCP struct {
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	keepAlive    time.Duration
+
+	conns *sockets
+}
+
+// NewTCP creates a TCP transport.
+func NewTCP(opts ...TCPOption) *TCP {
+	t := &TCP{dialTimeout: 10 * time.Second}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.conns = newSockets(t.dialTimeout, func(ctx context.Context, host, port string, dial time.Duration) sockConn {
+		return &socket.ClientTCP{
+			Addr:         host,
+			Port:         port,
+			DialTimeout:  dial,
+			WriteTimeout: t.writeTimeout,
+			TCPKeepAlive: t.keepAlive,
+			Context:      ctx,
+		}
+	})
+	return t
+}
+
+// Send implements client.Transport.
+func (t *TCP) Send(ctx context.Context, msg *client.Message) (int, []byte, error) {
+	if uint64(len(msg.Body)) > math.MaxUint32 {
+		return 0, nil, client.StatusError(413, "frame too large")
+	}
+	host, port, err := hostPort(msg.URL, "")
+	if err != nil {
+		return 0, nil, err
+	}
+	addr := net.JoinHostPort(host, port)
+	conn, err := t.conns.get(ctx, host, port)
+	if err != nil {
+		return 0, nil, fmt.Errorf("tcp dial %s: %w", addr, err)
+	}
+
+	frame := make([]byte, 4+len(msg.Body))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg.Body)))
+	copy(frame[4:], msg.Body)
+
+	// Unblock the write when the request times out first.
+	stop := context.AfterFunc(ctx, func() { t.conns.drop(addr, conn) })
+	_, err = conn.Write(frame)
+	stop()
+	if err != nil {
+		t.conns.drop(addr, conn)
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+		if errors.Is(err, socket.ErrClientClosed) {
+			// The receiver closed the connection.
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, fmt.Errorf("tcp write %s: %w", addr, err)
+	}
+	return 0, nil, nil
+}
+
+// Close implements client.Transport. It closes every connection.
+func (t *TCP) Close() error {
+	t.conns.close()
+	return nil
+}
@@ -0,0 +1,86 @@
+// Package transport provides non-HTTP transports for push/client: WebSocket
+// (ws/client), length-prefixed TCP (pkg/socket.ClientTCP), and UDP syslog
+// (pkg/socket.ClientUDP).
+//
+// A transport is installed with client.WithTransport or push.WithTransport.
+// The Client keeps its retry loop, async queue, outbox, batching, circuit
+// breaker, and statistics; only the delivery of each message changes. The
+// destination URL selects the connection: every transport keeps one
+// connection per host and dials it on first use, so routes and failover
+// work as with HTTP.
+//
+// Example:
+//
+//	p := push.New(
+//	    push.WithBaseURL("tcp://nms.example.com:6000"),
+//	    push.WithTransport(transport.NewTCP()),
+//	    push.WithRetry(3),
+//	)
+package transport
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/tsmask/go-oam/push/client"
+)
+
+// hostPort returns the host and port of a destination URL such as
+// "tcp://host:6000" or a bare "host:6000". defaultPort is used when the
+// URL has none; an empty defaultPort makes the port required.
+func hostPort(rawURL, defaultPort string) (host, port string, err error) {
+	hp := rawURL
+	if strings.Contains(rawURL, "://") {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", "", err
+		}
+		hp = u.Host
+	}
+	if i := strings.IndexByte(hp, '/'); i >= 0 {
+		hp = hp[:i]
+	}
+
+	host, port, err = net.SplitHostPort(hp)
+	if err != nil {
+		if defaultPort == "" {
+			return "", "", fmt.Errorf("destination %q: %w", rawURL, err)
+		}
+		host, port = strings.Trim(hp, "[]"), defaultPort
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("destination %q: missing host", rawURL)
+	}
+	return host, port, nil
+}
+
+// records splits a message body into single JSON records: the lines of an
+// NDJSON batch, the elements of a JSON array batch, or the body itself.
+func records(msg *client.Message) ([][]byte, error) {
+	body := bytes.TrimSpace(msg.Body)
+	if msg.ContentType == client.ContentTypeNDJSON {
+		var out [][]byte
+		for line := range bytes.SplitSeq(body, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				out = append(out, line)
+			}
+		}
+		return out, nil
+	}
+	if len(body) > 0 && body[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(body, &items); err != nil {
+			return nil, fmt.Errorf("decode batch: %w", err)
+		}
+		out := make([][]byte, len(items))
+		for i, it := range items {
+			out[i] = it
+		}
+		return out, nil
+	}
+	return [][]byte{body}, nil
+}
@@ -0,0 +1,241 @@
+package transport
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/push"
+	"github.com/tsmask/go-oam/push/client"
+	wsclient "github.com/tsmask/go-oam/ws/client"
+	"github.com/tsmask/go-oam/ws/server"
+	"github.com/tsmask/go-oam/ws/types"
+)
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		url, def, want string
+	}{
+		{"tcp://nms:6000/api/push/receive", "", "nms:6000"},
+		{"nms:6000", "", "nms:6000"},
+		{"syslog://[::1]", "514", "[::1]:514"},
+		{"udp://collector", "514", "collector:514"},
+	}
+	for _, tc := range tests {
+		host, port, err := hostPort(tc.url, tc.def)
+		if got := net.JoinHostPort(host, port); err != nil || got != tc.want {
+			t.Errorf("hostPort(%q) = %q, %v; want %q", tc.url, got, err, tc.want)
+		}
+	}
+	if _, _, err := hostPort("tcp://nms", ""); err == nil {
+		t.Error("missing port accepted")
+	}
+}
+
+// readFrame reads one length-prefixed frame.
+func readFrame(r io.Reader) ([]byte, error) {
+	var n [4]byte
+	if _, err := io.ReadFull(r, n[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(n[:]))
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+func TestTCP_FramesAndReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	frames := make(chan push.Record, 10)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- c
+			go func() {
+				for {
+					b, err := readFrame(c)
+					if err != nil {
+						return
+					}
+					var rec push.Record
+					_ = json.Unmarshal(b, &rec)
+					frames <- rec
+				}
+			}()
+		}
+	}()
+
+	p := push.New(push.WithBaseURL("tcp://"+ln.Addr().String()), push.WithTransport(NewTCP()), push.WithRetry(2))
+	defer p.Close()
+
+	if err := p.Send(&push.Record{NeUID: "ne-1", RecordType: "kpi"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if rec := <-frames; rec.NeUID != "ne-1" || rec.ID == "" {
+		t.Fatalf("frame = %+v", rec)
+	}
+
+	// The receiver drops the connection: the next send dials again.
+	(<-conns).Close()
+	time.Sleep(50 * time.Millisecond)
+	if err := p.Send(&push.Record{NeUID: "ne-2", RecordType: "kpi"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-conns:
+	case <-time.After(time.Second):
+		t.Fatal("no reconnect")
+	}
+	if rec := <-frames; rec.NeUID != "ne-2" {
+		t.Fatalf("frame after reconnect = %+v", rec)
+	}
+}
+
+func TestSyslog_BatchAndSize(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	cli := client.New(
+		client.WithTransport(NewSyslog(WithSyslogHostname("ne host"), WithSyslogSeverity(4))),
+		client.WithBatch(client.BatchConfig{MaxRecords: 2, Format: client.BatchNDJSON}),
+	)
+	defer cli.Close()
+	dst := "syslog://" + pc.LocalAddr().String()
+	for _, ne := range []string{"ne-1", "ne-2"} {
+		if err := cli.AsyncPush(dst, &push.Record{NeUID: ne, RecordType: "alarm"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prefix := "<132>1 " // local0 (16) * 8 + warning (4)
+	header := " nehost go-oam " + strconv.Itoa(os.Getpid()) + " alarm - "
+	buf := make([]byte, 2048)
+	for _, ne := range []string{"ne-1", "ne-2"} {
+		_ = pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, prefix) || !strings.Contains(msg, header+`{"ne_uid":"`+ne+`"`) {
+			t.Fatalf("datagram = %q", msg)
+		}
+	}
+
+	p := push.New(push.WithBaseURL(dst), push.WithTransport(NewSyslog(WithSyslogMaxSize(64))))
+	defer p.Close()
+	err = p.Send(&push.Record{NeUID: "ne-1", RecordType: "alarm", RecordData: json.RawMessage(`"` + strings.Repeat("x", 64) + `"`)}, nil)
+	if client.StatusCode(err) != 413 {
+		t.Fatalf("oversized record: err = %v, want 413", err)
+	}
+}
+
+func TestWS_ResponsesAndReconnect(t *testing.T) {
+	srv := server.NewServer()
+	var mu sync.Mutex
+	var got []string
+	srv.Handle(DefaultWSAction, func(c *server.Conn, req *types.Request) {
+		var rec push.Record
+		_ = json.Unmarshal(req.Data, &rec)
+		code := int32(200)
+		if rec.NeUID == "bad" {
+			code = 400
+		} else {
+			mu.Lock()
+			got = append(got, rec.NeUID)
+			mu.Unlock()
+		}
+		_ = c.SendResp(&types.Response{ID: req.ID, Code: code, Msg: "rejected"})
+	})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	p := push.New(
+		push.WithBaseURL("ws"+strings.TrimPrefix(ts.URL, "http")),
+		push.WithPushURI("/ws"),
+		push.WithTransport(NewWS()),
+		push.WithRetry(2),
+		push.WithTimeout(5*time.Second),
+	)
+	defer p.Close()
+
+	if err := p.Send(&push.Record{NeUID: "ne-1"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Send(&push.Record{NeUID: "bad"}, nil); client.StatusCode(err) != 400 {
+		t.Fatalf("rejected record: err = %v, want 400", err)
+	}
+
+	// Drop the connection server-side: the next send reconnects.
+	srv.ConnManager().Range(func(c *server.Conn) bool {
+		_ = c.Close()
+		return true
+	})
+	time.Sleep(50 * time.Millisecond)
+	if err := p.Send(&push.Record{NeUID: "ne-2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(got, ",") != "ne-1,ne-2" {
+		t.Fatalf("received %v", got)
+	}
+}
+
+func TestWS_RecycledResponsesAreCopied(t *testing.T) {
+	srv := server.NewServer()
+	srv.Handle(DefaultWSAction, func(c *server.Conn, req *types.Request) {
+		code := int32(200)
+		if string(req.Data) == `"bad"` {
+			code = 400
+		}
+		_ = c.SendResp(&types.Response{ID: req.ID, Code: code, Msg: "echo " + string(req.Data), Data: req.Data})
+	})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	tr := NewWS(WithWSClientOptions(wsclient.WithClientRecycleResponses(true)))
+	defer tr.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				body := []byte(strconv.Itoa(i*1000 + j))
+				_, data, err := tr.Send(t.Context(), &client.Message{URL: url, ContentType: client.ContentTypeJSON, Body: body})
+				if err != nil || string(data) != string(body) {
+					t.Errorf("Send(%s) = %q, %v", body, data, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, _, err := tr.Send(t.Context(), &client.Message{URL: url, ContentType: client.ContentTypeJSON, Body: []byte(`"bad"`)})
+	if !strings.Contains(err.Error(), `echo "bad"`) {
+		t.Fatalf("err = %v, want the response message", err)
+	}
+}
@@ -0,0 +1,213 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/tsmask/go-oam/pkg/generate"
+	"github.com/tsmask/go-oam/push/client"
+	wsclient "github.com/tsmask/go-oam/ws/client"
+	"github.com/tsmask/go-oam/ws/types"
+)
+
+// DefaultWSAction is the request action used by the WebSocket transport.
+const DefaultWSAction = "push"
+
+// WSOption configures a WebSocket transport.
+type WSOption func(*WS)
+
+// WithWSAction sets the request action. Defaults to "push".
+func WithWSAction(action string) WSOption {
+	return func(t *WS) { t.action = action }
+}
+
+// WithWSClientOptions sets options for the ws/client connections, such as
+// wsclient.WithClientDialTimeout or wsclient.WithClientHeartbeat.
+func WithWSClientOptions(opts ...wsclient.ClientOption) WSOption {
+	return func(t *WS) { t.clientOpts = append(t.clientOpts, opts...) }
+}
+
+// WS is a client.Transport that sends each message as a ws/client request
+// and waits for the response with the same ID.
+//
+// The request Data is the record, or a batch as a JSON array (NDJSON
+// batches are converted). The response Code is the status: 0 and 2xx
+// accept the message, other codes reject it like the matching HTTP status,
+// and the response Data may carry a client.BatchResult. When the
+// connection is lost, pending requests fail and are retried on a new
+// connection.
+//
+// Destinations are WebSocket URLs, e.g. "ws://nms:8080/ws"; one
+// connection is kept per URL.
+type WS struct {
+	action     string
+	clientOpts []wsclient.ClientOption
+
+	mu     sync.Mutex
+	dests  map[string]*wsDest
+	closed bool
+}
+
+// NewWS creates a WebSocket transport.
+func NewWS(opts ...WSOption) *WS {
+	t := &WS{
+		action: DefaultWSAction,
+		dests:  make(map[string]*wsDest),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// wsDest is the connection to one URL and its requests awaiting a response.
+type wsDest struct {
+	cli    *wsclient.Client
+	connMu sync.Mutex // Serializes Connect
+
+	mu      sync.Mutex
+	pending map[string]chan wsReply
+}
+
+// wsReply is a response copied out of the *types.Response handed to
+// OnReceive, which may be recycled (WithClientRecycleResponses) once the
+// callback returns.
+type wsReply struct {
+	code int
+	msg  string
+	data []byte
+	err  error
+}
+
+// Send implements client.Transport.
+func (t *WS) Send(ctx context.Context, msg *client.Message) (int, []byte, error) {
+	d, err := t.dest(msg.URL)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := d.connect(ctx); err != nil {
+		return 0, nil, fmt.Errorf("ws connect %s: %w", msg.URL, err)
+	}
+
+	data := msg.Body
+	if msg.ContentType == client.ContentTypeNDJSON {
+		recs, _ := records(msg)
+		data = append(append([]byte{'['}, bytes.Join(recs, []byte{','})...), ']')
+	}
+
+	id := generate.String(21)
+	ch := make(chan wsReply, 1)
+	d.mu.Lock()
+	d.pending[id] = ch
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, id)
+		d.mu.Unlock()
+	}()
+
+	if err := d.cli.Send(&types.Request{ID: id, Action: t.action, Data: data}); err != nil {
+		if errors.Is(err, wsclient.ErrInvalidState) {
+			// Disconnected between connect and send.
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, nil, fmt.Errorf("ws send %s: %w", msg.URL, err)
+	}
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return 0, nil, fmt.Errorf("ws %s: %w", msg.URL, r.err)
+		}
+		code := r.code
+		if code == 0 {
+			code = 200
+		}
+		if code >= 300 {
+			return code, nil, client.StatusError(code, r.msg)
+		}
+		return code, r.data, nil
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+// dest returns the destination for url, creating its client on first use.
+func (t *WS) dest(url string) (*wsDest, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrClosed
+	}
+	if d := t.dests[url]; d != nil {
+		return d, nil
+	}
+
+	d := &wsDest{
+		cli:     wsclient.NewClient(url, t.clientOpts...),
+		pending: make(map[string]chan wsReply),
+	}
+	d.cli.OnReceive(d.receive)
+	d.cli.OnError(func(err error) {
+		if errors.Is(err, wsclient.ErrConnectionLost) {
+			d.failAll(io.ErrUnexpectedEOF)
+		}
+	})
+	t.dests[url] = d
+	return d, nil
+}
+
+// connect connects the client unless it is connected.
+func (d *wsDest) connect(ctx context.Context) error {
+	if d.cli.State() == wsclient.StateConnected {
+		return nil
+	}
+	d.connMu.Lock()
+	defer d.connMu.Unlock()
+	if d.cli.State() == wsclient.StateConnected {
+		return nil
+	}
+	return d.cli.Connect(ctx)
+}
+
+// receive hands a copy of a response to the request waiting for it.
+func (d *wsDest) receive(resp *types.Response) {
+	d.mu.Lock()
+	ch := d.pending[resp.ID]
+	delete(d.pending, resp.ID)
+	d.mu.Unlock()
+	if ch != nil {
+		ch <- wsReply{code: int(resp.Code), msg: strings.Clone(resp.Msg), data: bytes.Clone(resp.Data)}
+	}
+}
+
+// failAll fails every request waiting for a response.
+func (d *wsDest) failAll(err error) {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = make(map[string]chan wsReply)
+	d.mu.Unlock()
+	for _, ch := range pending {
+		ch <- wsReply{err: err}
+	}
+}
+
+// Close implements client.Transport. It closes every connection.
+func (t *WS) Close() error {
+	t.mu.Lock()
+	dests := t.dests
+	t.dests = nil
+	t.closed = true
+	t.mu.Unlock()
+
+	for _, d := range dests {
+		d.cli.Close()
+		d.failAll(ErrClosed)
+	}
+	return nil
+}
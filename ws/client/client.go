@@ -93,6 +93,7 @@ type Client struct {
 }
 
 // NewClient 创建 WebSocket 客户端
+// 编解码器名称未注册时 panic，自定义编解码器需先调用 codec.Register
 func NewClient(url string, opts ...ClientOption) *Client {
 	cfg := clientConfig{
 		dialTimeout:          30 * time.Second,
@@ -105,12 +106,16 @@ func NewClient(url string, opts ...ClientOption) *Client {
 	if cfg.codec == "" {
 		cfg.codec = "json"
 	}
+	cc, err := codec.NewCodec(cfg.codec)
+	if err != nil {
+		panic("ws/client: " + err.Error())
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Client{
 		url:    url,
-		codec:  codec.NewCodec(cfg.codec),
+		codec:  cc,
 		cfg:    cfg,
 		ctx:    ctx,
 		cancel: cancel,
@@ -133,7 +138,11 @@ func (c *Client) Connect(ctx context.Context) error {
 	dialCtx, dialCancel := context.WithTimeout(ctx, c.cfg.dialTimeout)
 	defer dialCancel()
 
-	conn, _, err := websocket.Dial(dialCtx, c.url, nil)
+	subprotocol := codec.Subprotocol(c.cfg.codec)
+	conn, _, err := websocket.Dial(dialCtx, c.url, &websocket.DialOptions{
+		HTTPClient:   c.cfg.httpClient,
+		Subprotocols: []string{subprotocol},
+	})
 	if err != nil {
 		c.state.Store(int32(StateFailed))
 		return err
@@ -156,7 +165,9 @@ func (c *Client) Connect(ctx context.Context) error {
 		c.onState(StateConnected)
 	}
 
-	go c.readLoop(conn, connCtx)
+	// 旧版服务端不支持子协议时回退为按帧类型检测
+	negotiated := conn.Subprotocol() == subprotocol
+	go c.readLoop(conn, connCtx, negotiated)
 	go c.writeLoop(conn, connCtx)
 	if c.cfg.heartbeat > 0 {
 		go c.healthLoop(conn, connCtx)
@@ -223,6 +234,10 @@ func (c *Client) OnReceive(fn func(*types.Response)) { c.onReceive = fn }
 // State 获取当前连接状态
 func (c *Client) State() State { return State(c.state.Load()) }
 
+// Codec 获取配置的编解码器
+// 可配合 codec.DecodeData/codec.EncodeData 按 action 注册的消息类型处理 Data
+func (c *Client) Codec() codec.Codec { return c.codec }
+
 // ============================================================================
 // 内部方法
 // ============================================================================
@@ -265,8 +280,8 @@ func (c *Client) onConnectionLost() {
 }
 
 // readLoop 读取循环，参数为当前连接和对应 context
-// 自动检测响应编码：binary 用配置的编码器，text 用 JSON 兜底
-func (c *Client) readLoop(conn *websocket.Conn, ctx context.Context) {
+// 已协商子协议时始终使用配置的编码器；否则自动检测响应编码：binary 用配置的编码器，text 用 JSON 兜底
+func (c *Client) readLoop(conn *websocket.Conn, ctx context.Context, negotiated bool) {
 	defer c.onConnectionLost()
 
 	jsonCodec := codec.JSON()
@@ -279,8 +294,10 @@ func (c *Client) readLoop(conn *websocket.Conn, ctx context.Context) {
 
 		// 根据消息类型选择解码器
 		var respCodec codec.Codec
-		switch msgType {
-		case websocket.MessageText:
+		switch {
+		case negotiated:
+			respCodec = c.codec
+		case msgType == websocket.MessageText:
 			respCodec = jsonCodec
 		default:
 			respCodec = c.codec
@@ -297,6 +314,9 @@ func (c *Client) readLoop(conn *websocket.Conn, ctx context.Context) {
 		if c.onReceive != nil {
 			c.onReceive(resp)
 		}
+		if c.cfg.recycleResponses {
+			codec.ReleaseResponse(resp)
+		}
 	}
 }
 
@@ -1,6 +1,9 @@
 package client
 
-import "time"
+import (
+	"net/http"
+	"time"
+)
 
 // ClientOption 客户端配置选项
 type ClientOption func(*clientConfig)
@@ -12,9 +15,12 @@ type clientConfig struct {
 	autoReconnect        bool
 	maxReconnectAttempts int
 	heartbeat            time.Duration
+	httpClient           *http.Client
+	recycleResponses     bool
 }
 
-// WithClientCodec 设置编解码器，支持 "json"/"msgpack"/"protobuf"，默认 "json"
+// WithClientCodec 设置编解码器，支持内置 "json"/"msgpack"/"protobuf"/"cbor" 及 codec.Register 注册的名称，默认 "json"
+// 连接时以子协议声明编码，服务端据此选择编解码器
 func WithClientCodec(name string) ClientOption {
 	return func(cfg *clientConfig) { cfg.codec = name }
 }
@@ -38,3 +44,14 @@ func WithClientMaxReconnectAttempts(n int) ClientOption {
 func WithClientHeartbeat(interval time.Duration) ClientOption {
 	return func(cfg *clientConfig) { cfg.heartbeat = interval }
 }
+
+// WithClientHTTPClient 设置握手使用的 HTTP 客户端，可注入自定义 Transport（代理、内存连接等）
+func WithClientHTTPClient(hc *http.Client) ClientOption {
+	return func(cfg *clientConfig) { cfg.httpClient = hc }
+}
+
+// WithClientRecycleResponses 设置 OnReceive 返回后是否将 Response 归还对象池，默认关闭
+// 开启后 OnReceive 回调不得在返回后继续持有 resp 或 resp.Data
+func WithClientRecycleResponses(enabled bool) ClientOption {
+	return func(cfg *clientConfig) { cfg.recycleResponses = enabled }
+}
@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/tsmask/go-oam/ws/types"
+)
+
+// cborEncMode 规范编码模式（RFC 7049 Canonical CBOR）
+// map 键按长度优先排序、整数与浮点取最短形式、禁止不定长编码，
+// 相同数据总是得到相同字节，便于签名与去重
+var cborEncMode = func() cbor.EncMode {
+	em, err := cbor.CanonicalEncOptions().EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return em
+}()
+
+// cborDecMode 解码模式，拒绝重复 map 键
+var cborDecMode = func() cbor.DecMode {
+	dm, err := cbor.DecOptions{DupMapKey: cbor.DupMapKeyEnforcedAPF}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return dm
+}()
+
+// cborCodec CBOR 编解码器（RFC 8949）
+// 使用 fxamacker/cbor 进行序列化，字段名沿用 json tag
+//
+// 特点：
+//   - 二进制格式，体积与 MsgPack 相当
+//   - 规范编码，输出确定
+//   - 标准化程度高，嵌入式/受限设备库支持广泛
+//
+// 适用场景：受限设备代理、IoT 网元接入
+type cborCodec struct{}
+
+// Marshal 实现 Codec 接口
+func (c *cborCodec) Marshal(v any) ([]byte, error) {
+	return cborEncMode.Marshal(v)
+}
+
+// Unmarshal 实现 Codec 接口
+func (c *cborCodec) Unmarshal(data []byte, v any) error {
+	return cborDecMode.Unmarshal(data, v)
+}
+
+// Name 实现 Codec 接口
+func (c *cborCodec) Name() string { return "cbor" }
+
+// MessageType 实现 Codec 接口，返回 BinaryMessage
+func (c *cborCodec) MessageType() int { return BinaryMessage }
+
+// MarshalRequest 实现 Codec 接口
+func (c *cborCodec) MarshalRequest(req *types.Request) ([]byte, error) {
+	return cborEncMode.Marshal(req)
+}
+
+// MarshalResponse 实现 Codec 接口
+func (c *cborCodec) MarshalResponse(resp *types.Response) ([]byte, error) {
+	return cborEncMode.Marshal(resp)
+}
+
+// UnmarshalRequest 实现 Codec 接口
+func (c *cborCodec) UnmarshalRequest(data []byte) (*types.Request, error) {
+	req := AcquireRequest()
+	if err := cborDecMode.Unmarshal(data, req); err != nil {
+		ReleaseRequest(req)
+		return nil, err
+	}
+	return req, nil
+}
+
+// UnmarshalResponse 实现 Codec 接口
+func (c *cborCodec) UnmarshalResponse(data []byte) (*types.Response, error) {
+	resp := AcquireResponse()
+	if err := cborDecMode.Unmarshal(data, resp); err != nil {
+		ReleaseResponse(resp)
+		return nil, err
+	}
+	return resp, nil
+}
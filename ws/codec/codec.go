@@ -1,6 +1,12 @@
 package codec
 
 import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
 	"github.com/tsmask/go-oam/ws/types"
 )
 
@@ -10,9 +16,26 @@ const (
 	BinaryMessage = 2 // 二进制消息（WebSocket BinaryMessage）
 )
 
+// SubprotocolPrefix WebSocket 子协议前缀，子协议名为 前缀 + 编解码器名称，如 "oam.msgpack"
+const SubprotocolPrefix = "oam."
+
+// ErrUnknownCodec 编解码器未注册
+var ErrUnknownCodec = errors.New("unknown codec")
+
 // 默认 JSON 编解码器（无状态，全局复用）
 var defaultJSON Codec = &jsonCodec{}
 
+// registry 已注册的编解码器，key 为注册名称
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Codec{
+		"json":     defaultJSON,
+		"msgpack":  &msgpackCodec{},
+		"protobuf": &protobufCodec{},
+		"cbor":     &cborCodec{},
+	}
+)
+
 // JSON 返回全局 JSON 编解码器（无状态，可直接复用）
 func JSON() Codec { return defaultJSON }
 
@@ -37,21 +60,78 @@ type Codec interface {
 	MarshalResponse(resp *types.Response) ([]byte, error)
 
 	// UnmarshalRequest 将字节数组反序列化为 Request
+	// 返回的 Data 可能与 data 共享底层数组（零拷贝），使用结果期间调用方不得修改或复用 data；
+	// 返回对象可通过 ReleaseRequest 归还对象池
 	UnmarshalRequest(data []byte) (*types.Request, error)
 
 	// UnmarshalResponse 将字节数组反序列化为 Response
+	// 零拷贝与对象池约定同 UnmarshalRequest，归还使用 ReleaseResponse
 	UnmarshalResponse(data []byte) (*types.Response, error)
 }
 
-// NewCodec 根据名称创建编解码器
-// 支持: "json", "msgpack", "protobuf"，默认 "json"
-func NewCodec(name string) Codec {
-	switch name {
-	case "msgpack":
-		return &msgpackCodec{}
-	case "protobuf":
-		return &protobufCodec{}
-	default:
-		return defaultJSON
+// Register 注册自定义编解码器，通常在 init 中调用
+// 名称为空、c 为 nil 或名称重复时 panic（与 database/sql.Register 一致）
+//
+// 注册后可通过 WithServerCodec/WithClientCodec 按名称选用，
+// 客户端会以子协议 Subprotocol(name) 声明编码，服务端在握手时据此选择编解码器。
+func Register(name string, c Codec) {
+	if name == "" {
+		panic("codec: Register name is empty")
+	}
+	if c == nil {
+		panic("codec: Register codec is nil")
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("codec: Register called twice for " + name)
+	}
+	registry[name] = c
+}
+
+// NewCodec 根据名称获取已注册的编解码器
+// 内置: "json", "msgpack", "protobuf", "cbor"；未注册的名称返回 ErrUnknownCodec
+func NewCodec(name string) (Codec, error) {
+	registryMu.RLock()
+	c, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownCodec, name)
+	}
+	return c, nil
+}
+
+// Names 返回所有已注册的编解码器名称（按字典序）
+func Names() []string {
+	registryMu.RLock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	registryMu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+// Subprotocol 返回编解码器名称对应的 WebSocket 子协议
+func Subprotocol(name string) string { return SubprotocolPrefix + name }
+
+// Subprotocols 返回所有已注册编解码器的子协议列表
+func Subprotocols() []string {
+	names := Names()
+	for i, name := range names {
+		names[i] = Subprotocol(name)
+	}
+	return names
+}
+
+// FromSubprotocol 根据握手协商出的子协议查找编解码器
+// 子协议为空、前缀不符或编解码器未注册时返回 false
+func FromSubprotocol(sp string) (Codec, bool) {
+	name, ok := strings.CutPrefix(sp, SubprotocolPrefix)
+	if !ok || name == "" {
+		return nil, false
 	}
+	c, err := NewCodec(name)
+	return c, err == nil
 }
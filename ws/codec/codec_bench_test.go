@@ -0,0 +1,111 @@
+package codec
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tsmask/go-oam/ws/types"
+)
+
+// benchSizes 基准测试的 Data 负载大小
+var benchSizes = []int{64, 1 << 10, 16 << 10, 256 << 10}
+
+// benchPayload 生成合法 JSON 字符串形式的负载，保证 json 编解码器也可参与
+func benchPayload(n int) []byte {
+	b := make([]byte, n)
+	b[0], b[n-1] = '"', '"'
+	for i := 1; i < n-1; i++ {
+		b[i] = 'a' + byte(i%26)
+	}
+	return b
+}
+
+func benchRequest(n int) *types.Request {
+	return &types.Request{ID: "V1StGXR8_Z5jdHi6B-myT", Action: "kpi.report", Data: benchPayload(n)}
+}
+
+func benchResponse(n int) *types.Response {
+	return &types.Response{ID: "V1StGXR8_Z5jdHi6B-myT", Ts: 1716700000000, Action: "kpi.report", Code: 200, Msg: "ok", Data: benchPayload(n)}
+}
+
+func BenchmarkMarshalRequest(b *testing.B) {
+	for _, name := range builtinCodecs {
+		c := mustCodec(b, name)
+		for _, size := range benchSizes {
+			req := benchRequest(size)
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					if _, err := c.MarshalRequest(req); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkUnmarshalRequest(b *testing.B) {
+	for _, name := range builtinCodecs {
+		c := mustCodec(b, name)
+		for _, size := range benchSizes {
+			data, err := c.MarshalRequest(benchRequest(size))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					req, err := c.UnmarshalRequest(data)
+					if err != nil {
+						b.Fatal(err)
+					}
+					ReleaseRequest(req)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMarshalResponse(b *testing.B) {
+	for _, name := range builtinCodecs {
+		c := mustCodec(b, name)
+		for _, size := range benchSizes {
+			resp := benchResponse(size)
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					if _, err := c.MarshalResponse(resp); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkUnmarshalResponse(b *testing.B) {
+	for _, name := range builtinCodecs {
+		c := mustCodec(b, name)
+		for _, size := range benchSizes {
+			data, err := c.MarshalResponse(benchResponse(size))
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(size))
+				for b.Loop() {
+					resp, err := c.UnmarshalResponse(data)
+					if err != nil {
+						b.Fatal(err)
+					}
+					ReleaseResponse(resp)
+				}
+			})
+		}
+	}
+}
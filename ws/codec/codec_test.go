@@ -0,0 +1,62 @@
+package codec
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// binaryJSON 以二进制帧传输的 JSON 编解码器，用于验证自定义注册
+type binaryJSON struct{ jsonCodec }
+
+func (*binaryJSON) Name() string     { return "binjson" }
+func (*binaryJSON) MessageType() int { return BinaryMessage }
+
+func TestRegistry_Builtin(t *testing.T) {
+	for _, name := range []string{"json", "msgpack", "protobuf"} {
+		c, err := NewCodec(name)
+		if err != nil {
+			t.Fatalf("NewCodec(%q): %v", name, err)
+		}
+		if c.Name() != name {
+			t.Fatalf("NewCodec(%q).Name() = %q", name, c.Name())
+		}
+	}
+}
+
+func TestRegistry_Unknown(t *testing.T) {
+	if _, err := NewCodec("yaml"); !errors.Is(err, ErrUnknownCodec) {
+		t.Fatalf("NewCodec(yaml) err = %v, want ErrUnknownCodec", err)
+	}
+	if _, ok := FromSubprotocol("oam.yaml"); ok {
+		t.Fatalf("FromSubprotocol(oam.yaml) ok, want false")
+	}
+	if _, ok := FromSubprotocol("json"); ok {
+		t.Fatalf("FromSubprotocol without prefix ok, want false")
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	Register("binjson", &binaryJSON{})
+
+	c, err := NewCodec("binjson")
+	if err != nil {
+		t.Fatalf("NewCodec(binjson): %v", err)
+	}
+	if c.MessageType() != BinaryMessage {
+		t.Fatalf("MessageType = %d, want binary", c.MessageType())
+	}
+	if !slices.Contains(Names(), "binjson") || !slices.Contains(Subprotocols(), "oam.binjson") {
+		t.Fatalf("Names/Subprotocols missing binjson: %v", Names())
+	}
+	if got, ok := FromSubprotocol(Subprotocol("binjson")); !ok || got != c {
+		t.Fatalf("FromSubprotocol(oam.binjson) = %v, %v", got, ok)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("duplicate Register did not panic")
+		}
+	}()
+	Register("binjson", &binaryJSON{})
+}
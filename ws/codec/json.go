@@ -45,8 +45,9 @@ func (c *jsonCodec) MarshalResponse(resp *types.Response) ([]byte, error) {
 
 // UnmarshalRequest 实现 Codec 接口
 func (c *jsonCodec) UnmarshalRequest(data []byte) (*types.Request, error) {
-	req := &types.Request{}
+	req := AcquireRequest()
 	if err := json.Unmarshal(data, req); err != nil {
+		ReleaseRequest(req)
 		return nil, err
 	}
 	return req, nil
@@ -54,8 +55,9 @@ func (c *jsonCodec) UnmarshalRequest(data []byte) (*types.Request, error) {
 
 // UnmarshalResponse 实现 Codec 接口
 func (c *jsonCodec) UnmarshalResponse(data []byte) (*types.Response, error) {
-	resp := &types.Response{}
+	resp := AcquireResponse()
 	if err := json.Unmarshal(data, resp); err != nil {
+		ReleaseResponse(resp)
 		return nil, err
 	}
 	return resp, nil
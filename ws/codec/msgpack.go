@@ -1,6 +1,8 @@
 package codec
 
 import (
+	"math"
+
 	"github.com/tsmask/go-oam/ws/types"
 	msgpack "github.com/vmihailenco/msgpack/v5"
 )
@@ -43,19 +45,258 @@ func (c *msgpackCodec) MarshalResponse(resp *types.Response) ([]byte, error) {
 }
 
 // UnmarshalRequest 实现 Codec 接口
+// 优先走零拷贝快速路径，Data 与 data 共享底层数组；遇到非常规编码时回退到通用解码
 func (c *msgpackCodec) UnmarshalRequest(data []byte) (*types.Request, error) {
-	req := &types.Request{}
+	req := AcquireRequest()
+	if decodeMsgpackRequest(data, req) {
+		return req, nil
+	}
+	*req = types.Request{}
 	if err := msgpack.Unmarshal(data, req); err != nil {
+		ReleaseRequest(req)
 		return nil, err
 	}
 	return req, nil
 }
 
 // UnmarshalResponse 实现 Codec 接口
+// 优先走零拷贝快速路径，Data 与 data 共享底层数组；遇到非常规编码时回退到通用解码
 func (c *msgpackCodec) UnmarshalResponse(data []byte) (*types.Response, error) {
-	resp := &types.Response{}
+	resp := AcquireResponse()
+	if decodeMsgpackResponse(data, resp) {
+		return resp, nil
+	}
+	*resp = types.Response{}
 	if err := msgpack.Unmarshal(data, resp); err != nil {
+		ReleaseResponse(resp)
 		return nil, err
 	}
 	return resp, nil
 }
+
+// ============================================================================
+// 零拷贝快速路径
+// ============================================================================
+
+// decodeMsgpackRequest 直接解析 map 形式的 Request，返回 false 表示需回退到通用解码
+// 只接受编码器使用的 Go 字段名（"ID"），与通用解码路径保持一致
+func decodeMsgpackRequest(data []byte, req *types.Request) bool {
+	r := mpReader{buf: data}
+	n, ok := r.mapLen()
+	if !ok {
+		return false
+	}
+	for range n {
+		// switch string(key) 不产生分配
+		key, ok := r.raw(false)
+		if !ok {
+			return false
+		}
+		switch string(key) {
+		case "ID":
+			v, ok := r.strOrNil()
+			if !ok {
+				return false
+			}
+			req.ID = string(v)
+		case "Action":
+			v, ok := r.strOrNil()
+			if !ok {
+				return false
+			}
+			req.Action = string(v)
+		case "Data":
+			v, ok := r.bytes()
+			if !ok {
+				return false
+			}
+			req.Data = v
+		default:
+			return false
+		}
+	}
+	return r.pos == len(data)
+}
+
+// decodeMsgpackResponse 直接解析 map 形式的 Response，返回 false 表示需回退到通用解码
+func decodeMsgpackResponse(data []byte, resp *types.Response) bool {
+	r := mpReader{buf: data}
+	n, ok := r.mapLen()
+	if !ok {
+		return false
+	}
+	for range n {
+		// switch string(key) 不产生分配
+		key, ok := r.raw(false)
+		if !ok {
+			return false
+		}
+		switch string(key) {
+		case "ID":
+			v, ok := r.strOrNil()
+			if !ok {
+				return false
+			}
+			resp.ID = string(v)
+		case "Ts":
+			v, ok := r.readInt()
+			if !ok {
+				return false
+			}
+			resp.Ts = v
+		case "Action":
+			v, ok := r.strOrNil()
+			if !ok {
+				return false
+			}
+			resp.Action = string(v)
+		case "Code":
+			v, ok := r.readInt()
+			if !ok || v < math.MinInt32 || v > math.MaxInt32 {
+				return false
+			}
+			resp.Code = int32(v)
+		case "Msg":
+			v, ok := r.strOrNil()
+			if !ok {
+				return false
+			}
+			resp.Msg = string(v)
+		case "Data":
+			v, ok := r.bytes()
+			if !ok {
+				return false
+			}
+			resp.Data = v
+		default:
+			return false
+		}
+	}
+	return r.pos == len(data)
+}
+
+// mpReader 最小化的 MessagePack 读取器，只覆盖 Request/Response 用到的类型
+type mpReader struct {
+	buf []byte
+	pos int
+}
+
+// next 读取 n 字节，返回的切片限制容量，防止调用方 append 覆盖后续数据
+func (r *mpReader) next(n int) ([]byte, bool) {
+	if n < 0 || len(r.buf)-r.pos < n {
+		return nil, false
+	}
+	b := r.buf[r.pos : r.pos+n : r.pos+n]
+	r.pos += n
+	return b, true
+}
+
+// byte1 读取一个字节
+func (r *mpReader) byte1() (byte, bool) {
+	if r.pos >= len(r.buf) {
+		return 0, false
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, true
+}
+
+// readUint 读取 n 字节大端无符号整数
+func (r *mpReader) readUint(n int) (uint64, bool) {
+	b, ok := r.next(n)
+	if !ok {
+		return 0, false
+	}
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v, true
+}
+
+// mapLen 读取 map 头
+func (r *mpReader) mapLen() (int, bool) {
+	b, ok := r.byte1()
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case b&0xf0 == 0x80:
+		return int(b & 0x0f), true
+	case b == 0xde:
+		n, ok := r.readUint(2)
+		return int(n), ok
+	case b == 0xdf:
+		n, ok := r.readUint(4)
+		return int(n), ok
+	}
+	return 0, false
+}
+
+// raw 读取 str/bin 类型的负载，nilOK 为 true 时接受 nil
+func (r *mpReader) raw(nilOK bool) ([]byte, bool) {
+	b, ok := r.byte1()
+	if !ok {
+		return nil, false
+	}
+	var n uint64
+	switch {
+	case b&0xe0 == 0xa0:
+		n = uint64(b & 0x1f)
+	case b == 0xd9 || b == 0xc4:
+		n, ok = r.readUint(1)
+	case b == 0xda || b == 0xc5:
+		n, ok = r.readUint(2)
+	case b == 0xdb || b == 0xc6:
+		n, ok = r.readUint(4)
+	case b == 0xc0 && nilOK:
+		return nil, true
+	default:
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	return r.next(int(n))
+}
+
+// strOrNil 读取字符串或 nil
+func (r *mpReader) strOrNil() ([]byte, bool) { return r.raw(true) }
+
+// bytes 读取 bin/str/nil，零拷贝返回
+func (r *mpReader) bytes() ([]byte, bool) { return r.raw(true) }
+
+// readInt 读取任意宽度的整数
+func (r *mpReader) readInt() (int64, bool) {
+	b, ok := r.byte1()
+	if !ok {
+		return 0, false
+	}
+	switch {
+	case b <= 0x7f:
+		return int64(b), true
+	case b >= 0xe0:
+		return int64(int8(b)), true
+	}
+	switch b {
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, ok := r.readUint(1 << (b - 0xcc))
+		if !ok || v > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case 0xd0:
+		v, ok := r.readUint(1)
+		return int64(int8(v)), ok
+	case 0xd1:
+		v, ok := r.readUint(2)
+		return int64(int16(v)), ok
+	case 0xd2:
+		v, ok := r.readUint(4)
+		return int64(int32(v)), ok
+	case 0xd3:
+		v, ok := r.readUint(8)
+		return int64(v), ok
+	}
+	return 0, false
+}
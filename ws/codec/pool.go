@@ -0,0 +1,47 @@
+package codec
+
+import (
+	"sync"
+
+	"github.com/tsmask/go-oam/ws/types"
+)
+
+// Request/Response 对象池
+//
+// 内置编解码器的 UnmarshalRequest/UnmarshalResponse 从池中取对象，
+// 调用方处理完毕后可通过 ReleaseRequest/ReleaseResponse 归还，减少高频消息下的分配。
+// 不归还也不会泄漏，对象由 GC 正常回收。
+var (
+	requestPool  = sync.Pool{New: func() any { return new(types.Request) }}
+	responsePool = sync.Pool{New: func() any { return new(types.Response) }}
+)
+
+// AcquireRequest 从对象池获取 Request，字段均为零值
+func AcquireRequest() *types.Request {
+	return requestPool.Get().(*types.Request)
+}
+
+// ReleaseRequest 清空 Request 并归还对象池
+// 归还后调用方不得再访问 req 及其 Data（Data 可能与解码输入共享底层数组）
+func ReleaseRequest(req *types.Request) {
+	if req == nil {
+		return
+	}
+	*req = types.Request{}
+	requestPool.Put(req)
+}
+
+// AcquireResponse 从对象池获取 Response，字段均为零值
+func AcquireResponse() *types.Response {
+	return responsePool.Get().(*types.Response)
+}
+
+// ReleaseResponse 清空 Response 并归还对象池
+// 归还后调用方不得再访问 resp 及其 Data
+func ReleaseResponse(resp *types.Response) {
+	if resp == nil {
+		return
+	}
+	*resp = types.Response{}
+	responsePool.Put(resp)
+}
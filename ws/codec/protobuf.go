@@ -2,12 +2,17 @@ package codec
 
 import (
 	"errors"
+	"unicode/utf8"
 
 	"github.com/tsmask/go-oam/ws/protocol"
 	"github.com/tsmask/go-oam/ws/types"
+	"google.golang.org/protobuf/encoding/protowire"
 	"google.golang.org/protobuf/proto"
 )
 
+// errInvalidUTF8 string 字段不是合法 UTF-8（与 proto.Unmarshal 行为一致）
+var errInvalidUTF8 = errors.New("proto: string field contains invalid UTF-8")
+
 // protobufCodec Protocol Buffers 编解码器
 // 使用 google.golang.org/protobuf 进行序列化
 //
@@ -63,31 +68,111 @@ func (c *protobufCodec) MarshalResponse(resp *types.Response) ([]byte, error) {
 	})
 }
 
-// UnmarshalRequest 将字节数组反序列化为 protocol.Request，再转换为 types.Request
+// UnmarshalRequest 直接按 wire 格式解析 protocol.Request 并填充 types.Request
+// Data 与 data 共享底层数组（零拷贝），未知字段跳过
 func (c *protobufCodec) UnmarshalRequest(data []byte) (*types.Request, error) {
-	pbreq := &protocol.Request{}
-	if err := proto.Unmarshal(data, pbreq); err != nil {
-		return nil, err
+	req := AcquireRequest()
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			ReleaseRequest(req)
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ != protowire.BytesType || num < 1 || num > 3 {
+			// 未知字段或 wire 类型不符，跳过
+			if n = protowire.ConsumeFieldValue(num, typ, data); n < 0 {
+				ReleaseRequest(req)
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			ReleaseRequest(req)
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case 1:
+			if !utf8.Valid(v) {
+				ReleaseRequest(req)
+				return nil, errInvalidUTF8
+			}
+			req.ID = string(v)
+		case 2:
+			if !utf8.Valid(v) {
+				ReleaseRequest(req)
+				return nil, errInvalidUTF8
+			}
+			req.Action = string(v)
+		case 3:
+			req.Data = v[:len(v):len(v)]
+		}
 	}
-	return &types.Request{
-		ID:     pbreq.GetId(),
-		Action: pbreq.GetAction(),
-		Data:   pbreq.GetData(),
-	}, nil
+	return req, nil
 }
 
-// UnmarshalResponse 将字节数组反序列化为 protocol.Response，再转换为 types.Response
+// UnmarshalResponse 直接按 wire 格式解析 protocol.Response 并填充 types.Response
+// Data 与 data 共享底层数组（零拷贝），未知字段跳过
 func (c *protobufCodec) UnmarshalResponse(data []byte) (*types.Response, error) {
-	pbresp := &protocol.Response{}
-	if err := proto.Unmarshal(data, pbresp); err != nil {
-		return nil, err
+	resp := AcquireResponse()
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			ReleaseResponse(resp)
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		var (
+			v      []byte
+			varint uint64
+		)
+		switch {
+		case typ == protowire.BytesType && (num == 1 || num == 3 || num == 5 || num == 6):
+			v, n = protowire.ConsumeBytes(data)
+		case typ == protowire.VarintType && (num == 2 || num == 4):
+			varint, n = protowire.ConsumeVarint(data)
+		default:
+			// 未知字段或 wire 类型不符，跳过
+			if n = protowire.ConsumeFieldValue(num, typ, data); n < 0 {
+				ReleaseResponse(resp)
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+		if n < 0 {
+			ReleaseResponse(resp)
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case 1, 3, 5:
+			if !utf8.Valid(v) {
+				ReleaseResponse(resp)
+				return nil, errInvalidUTF8
+			}
+			switch num {
+			case 1:
+				resp.ID = string(v)
+			case 3:
+				resp.Action = string(v)
+			case 5:
+				resp.Msg = string(v)
+			}
+		case 2:
+			resp.Ts = int64(varint)
+		case 4:
+			resp.Code = int32(varint)
+		case 6:
+			resp.Data = v[:len(v):len(v)]
+		}
 	}
-	return &types.Response{
-		ID:     pbresp.GetId(),
-		Ts:     pbresp.GetTs(),
-		Action: pbresp.GetAction(),
-		Code:   pbresp.GetCode(),
-		Msg:    pbresp.GetMsg(),
-		Data:   pbresp.GetData(),
-	}, nil
+	return resp, nil
 }
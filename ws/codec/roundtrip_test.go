@@ -0,0 +1,265 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/tsmask/go-oam/ws/types"
+	msgpack "github.com/vmihailenco/msgpack/v5"
+)
+
+// builtinCodecs 参与交叉测试的内置编解码器
+var builtinCodecs = []string{"json", "msgpack", "protobuf", "cbor"}
+
+func sampleRequest() *types.Request {
+	return &types.Request{ID: "req-001", Action: "alarm.sync", Data: []byte(`{"ne":"ne-001","level":3,"tags":["a","b"]}`)}
+}
+
+func sampleResponse() *types.Response {
+	return &types.Response{
+		ID: "req-001", Ts: 1716700000000, Action: "alarm.sync",
+		Code: 500, Msg: "partial failure", Data: []byte(`{"failed":[1,2]}`),
+	}
+}
+
+func equalRequest(a, b *types.Request) bool {
+	return a.ID == b.ID && a.Action == b.Action && bytes.Equal(a.Data, b.Data)
+}
+
+func equalResponse(a, b *types.Response) bool {
+	return a.ID == b.ID && a.Ts == b.Ts && a.Action == b.Action &&
+		a.Code == b.Code && a.Msg == b.Msg && bytes.Equal(a.Data, b.Data)
+}
+
+func mustCodec(t testing.TB, name string) Codec {
+	t.Helper()
+	c, err := NewCodec(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, name := range builtinCodecs {
+		t.Run(name, func(t *testing.T) {
+			c := mustCodec(t, name)
+
+			req := sampleRequest()
+			data, err := c.MarshalRequest(req)
+			if err != nil {
+				t.Fatalf("MarshalRequest: %v", err)
+			}
+			gotReq, err := c.UnmarshalRequest(data)
+			if err != nil {
+				t.Fatalf("UnmarshalRequest: %v", err)
+			}
+			if !equalRequest(req, gotReq) {
+				t.Fatalf("request = %+v, want %+v", gotReq, req)
+			}
+
+			resp := sampleResponse()
+			data, err = c.MarshalResponse(resp)
+			if err != nil {
+				t.Fatalf("MarshalResponse: %v", err)
+			}
+			gotResp, err := c.UnmarshalResponse(data)
+			if err != nil {
+				t.Fatalf("UnmarshalResponse: %v", err)
+			}
+			if !equalResponse(resp, gotResp) {
+				t.Fatalf("response = %+v, want %+v", gotResp, resp)
+			}
+		})
+	}
+}
+
+// TestCodec_CrossRoundTrip 经 a 编解码后再经 b 编解码，结果应与原始消息一致
+func TestCodec_CrossRoundTrip(t *testing.T) {
+	for _, from := range builtinCodecs {
+		for _, to := range builtinCodecs {
+			t.Run(fmt.Sprintf("%s->%s", from, to), func(t *testing.T) {
+				a, b := mustCodec(t, from), mustCodec(t, to)
+
+				data, err := a.MarshalRequest(sampleRequest())
+				if err != nil {
+					t.Fatal(err)
+				}
+				mid, err := a.UnmarshalRequest(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data, err = b.MarshalRequest(mid); err != nil {
+					t.Fatal(err)
+				}
+				req, err := b.UnmarshalRequest(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !equalRequest(req, sampleRequest()) {
+					t.Fatalf("request = %+v", req)
+				}
+
+				if data, err = a.MarshalResponse(sampleResponse()); err != nil {
+					t.Fatal(err)
+				}
+				midResp, err := a.UnmarshalResponse(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if data, err = b.MarshalResponse(midResp); err != nil {
+					t.Fatal(err)
+				}
+				resp, err := b.UnmarshalResponse(data)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !equalResponse(resp, sampleResponse()) {
+					t.Fatalf("response = %+v", resp)
+				}
+			})
+		}
+	}
+}
+
+func TestCBOR_Canonical(t *testing.T) {
+	c := mustCodec(t, "cbor")
+
+	// map 遍历顺序随机，规范编码应始终得到相同字节
+	m := map[string]any{"zeta": 1, "a": 2.5, "mid": "x", "bb": []int{1, 2}, "ccc": true}
+	want, err := c.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 20 {
+		got, err := c.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("non-deterministic encoding: %x vs %x", got, want)
+		}
+	}
+
+	// 键按长度优先、再按字典序排序
+	last := -1
+	for _, k := range []string{"a", "bb", "ccc", "mid", "zeta"} {
+		idx := bytes.Index(want, append([]byte{0x60 | byte(len(k))}, k...))
+		if idx <= last {
+			t.Fatalf("key %q at %d, want after %d: %x", k, idx, last, want)
+		}
+		last = idx
+	}
+
+	// 浮点取最短形式：2.5 可由 float16 精确表示
+	half, err := c.Marshal(2.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(half) != 3 || half[0] != 0xf9 {
+		t.Fatalf("2.5 encoded as %x, want float16", half)
+	}
+}
+
+func TestCBOR_RejectDuplicateKeys(t *testing.T) {
+	c := mustCodec(t, "cbor")
+	// {"id":"a","id":"b"}
+	dup := []byte{0xa2, 0x62, 'i', 'd', 0x61, 'a', 0x62, 'i', 'd', 0x61, 'b'}
+	if _, err := c.UnmarshalRequest(dup); err == nil {
+		t.Fatalf("duplicate map key accepted")
+	}
+}
+
+// ============================================================================
+// 零拷贝快速路径
+// ============================================================================
+
+func TestZeroCopy_DataAliasesInput(t *testing.T) {
+	for _, name := range []string{"msgpack", "protobuf"} {
+		t.Run(name, func(t *testing.T) {
+			c := mustCodec(t, name)
+			data, err := c.MarshalRequest(sampleRequest())
+			if err != nil {
+				t.Fatal(err)
+			}
+			req, err := c.UnmarshalRequest(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalRequest(req, sampleRequest()) {
+				t.Fatalf("request = %+v", req)
+			}
+			idx := bytes.Index(data, req.Data)
+			if idx < 0 || &data[idx] != &req.Data[0] {
+				t.Fatalf("Data does not alias the input buffer")
+			}
+			// 容量被截断，append 不会覆盖输入中后续字节
+			if cap(req.Data) != len(req.Data) {
+				t.Fatalf("cap(Data) = %d, want %d", cap(req.Data), len(req.Data))
+			}
+		})
+	}
+}
+
+func TestZeroCopy_ReleaseClearsFields(t *testing.T) {
+	req := AcquireRequest()
+	req.ID, req.Action, req.Data = "x", "y", []byte("z")
+	ReleaseRequest(req)
+	ReleaseRequest(nil)
+	if req.ID != "" || req.Action != "" || req.Data != nil {
+		t.Fatalf("released request not cleared: %+v", req)
+	}
+}
+
+func TestMsgpack_OnlyEncoderKeys(t *testing.T) {
+	c := mustCodec(t, "msgpack")
+	data, err := msgpack.Marshal(map[string]any{"id": "req-001", "action": "alarm.sync", "data": []byte("x")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 快速路径与通用解码对同一字节必须给出相同结果
+	var want types.Request
+	if err := msgpack.Unmarshal(data, &want); err != nil {
+		t.Fatal(err)
+	}
+	req, err := c.UnmarshalRequest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalRequest(req, &want) {
+		t.Fatalf("request = %+v, generic decoder = %+v", req, &want)
+	}
+}
+
+func TestMsgpack_FallbackOnUnknownKey(t *testing.T) {
+	c := mustCodec(t, "msgpack")
+	data, err := msgpack.Marshal(map[string]any{"ID": "req-001", "Action": "alarm.sync", "Extra": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := c.UnmarshalRequest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.ID != "req-001" || req.Action != "alarm.sync" {
+		t.Fatalf("request = %+v", req)
+	}
+}
+
+func TestProtobuf_SkipUnknownFields(t *testing.T) {
+	c := mustCodec(t, "protobuf")
+	data, err := c.MarshalResponse(sampleResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 追加未知字段 15（varint），旧版本对端应忽略
+	data = append(data, 15<<3|0, 0x01)
+	resp, err := c.UnmarshalResponse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalResponse(resp, sampleResponse()) {
+		t.Fatalf("response = %+v", resp)
+	}
+}
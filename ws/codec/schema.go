@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ErrUnknownAction action 未注册消息类型，调用方应按原始字节处理 Data
+var ErrUnknownAction = errors.New("unknown action")
+
+// schemas 已注册的 action 消息类型，key 为 action
+var (
+	schemasMu sync.RWMutex
+	schemas   = map[string]protoreflect.MessageType{}
+)
+
+// Schema action 与消息类型的对应关系
+type Schema struct {
+	Action  string // 动作类型
+	Message string // 消息全名，如 "oam.alarm.v1.Alarm"
+}
+
+// RegisterMessage 为 action 注册 Protobuf 消息类型，通常在 init 中调用
+// action 为空、m 为 nil 或 action 重复时 panic（与 Register 一致）
+//
+// 注册后 DecodeData/EncodeData 按连接编码处理 Data：
+// protobuf 会话使用 Protobuf 二进制，其他编码使用 protojson。
+func RegisterMessage(action string, m proto.Message) {
+	if action == "" {
+		panic("codec: RegisterMessage action is empty")
+	}
+	if m == nil {
+		panic("codec: RegisterMessage message is nil")
+	}
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	if _, dup := schemas[action]; dup {
+		panic("codec: RegisterMessage called twice for " + action)
+	}
+	schemas[action] = m.ProtoReflect().Type()
+}
+
+// NewMessage 创建 action 对应消息类型的空实例，未注册时返回 false
+func NewMessage(action string) (proto.Message, bool) {
+	schemasMu.RLock()
+	mt, ok := schemas[action]
+	schemasMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return mt.New().Interface(), true
+}
+
+// Schemas 返回所有已注册的 action 消息类型（按 action 字典序）
+func Schemas() []Schema {
+	schemasMu.RLock()
+	list := make([]Schema, 0, len(schemas))
+	for action, mt := range schemas {
+		list = append(list, Schema{Action: action, Message: string(mt.Descriptor().FullName())})
+	}
+	schemasMu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Action < list[j].Action })
+	return list
+}
+
+// DecodeData 按 action 注册的消息类型解码 Data
+// action 未注册时返回 ErrUnknownAction，调用方可回退到按原始字节处理
+func DecodeData(c Codec, action string, data []byte) (proto.Message, error) {
+	m, ok := NewMessage(action)
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownAction, action)
+	}
+	if isProtobuf(c) {
+		if err := proto.Unmarshal(data, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if err := protojson.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// EncodeData 按连接编码序列化消息，结果用作 Request/Response 的 Data
+func EncodeData(c Codec, m proto.Message) ([]byte, error) {
+	if isProtobuf(c) {
+		return proto.Marshal(m)
+	}
+	return protojson.Marshal(m)
+}
+
+// isProtobuf 是否为 Protobuf 会话
+func isProtobuf(c Codec) bool {
+	return c != nil && c.Name() == "protobuf"
+}
+
+// Bundle 导出已注册消息所在的 .proto 文件及其全部依赖
+// 文件按依赖顺序排列（被依赖的在前），可直接写出供 protoc --descriptor_set_in、
+// buf 或 grpcurl 等工具使用；action 与消息的对应关系见 Schemas。
+func Bundle() *descriptorpb.FileDescriptorSet {
+	schemasMu.RLock()
+	files := make([]protoreflect.FileDescriptor, 0, len(schemas))
+	for _, mt := range schemas {
+		files = append(files, mt.Descriptor().ParentFile())
+	}
+	schemasMu.RUnlock()
+	sort.Slice(files, func(i, j int) bool { return files[i].Path() < files[j].Path() })
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var walk func(fd protoreflect.FileDescriptor)
+	walk = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			walk(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range files {
+		walk(fd)
+	}
+	return set
+}
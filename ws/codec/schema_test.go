@@ -0,0 +1,90 @@
+package codec
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tsmask/go-oam/ws/protocol"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/apipb"
+)
+
+func init() {
+	RegisterMessage("test.schema.request", &protocol.Request{})
+	RegisterMessage("test.schema.api", &apipb.Api{})
+}
+
+func TestSchema_DecodeEncode(t *testing.T) {
+	want := &protocol.Request{Id: "inner", Action: "nested", Data: []byte{0x00, 0xff}}
+	for _, name := range builtinCodecs {
+		t.Run(name, func(t *testing.T) {
+			c := mustCodec(t, name)
+			data, err := EncodeData(c, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := DecodeData(c, "test.schema.request", data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(got, want) {
+				t.Fatalf("decoded = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestSchema_ProtobufSessionUsesWireFormat(t *testing.T) {
+	m := &protocol.Request{Id: "x"}
+	data, err := EncodeData(mustCodec(t, "protobuf"), m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wire, _ := proto.Marshal(m); string(data) != string(wire) {
+		t.Fatalf("data = %x, want protobuf wire %x", data, wire)
+	}
+}
+
+func TestSchema_UnknownAction(t *testing.T) {
+	_, err := DecodeData(mustCodec(t, "json"), "test.schema.missing", []byte(`{}`))
+	if !errors.Is(err, ErrUnknownAction) {
+		t.Fatalf("err = %v, want ErrUnknownAction", err)
+	}
+}
+
+func TestSchema_RegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate RegisterMessage did not panic")
+		}
+	}()
+	RegisterMessage("test.schema.request", &protocol.Request{})
+}
+
+func TestSchema_ListAndBundle(t *testing.T) {
+	found := map[string]string{}
+	for _, s := range Schemas() {
+		found[s.Action] = s.Message
+	}
+	if found["test.schema.request"] != "protocol.Request" || found["test.schema.api"] != "google.protobuf.Api" {
+		t.Fatalf("schemas = %v", found)
+	}
+
+	// 依赖文件排在引用它的文件之前
+	index := map[string]int{}
+	for i, f := range Bundle().GetFile() {
+		index[f.GetName()] = i
+	}
+	api, ok := index["google/protobuf/api.proto"]
+	if !ok {
+		t.Fatalf("bundle missing api.proto: %v", index)
+	}
+	for _, dep := range []string{"google/protobuf/source_context.proto", "google/protobuf/type.proto"} {
+		if i, ok := index[dep]; !ok || i > api {
+			t.Fatalf("dependency %s at %d (present %v), api.proto at %d", dep, i, ok, api)
+		}
+	}
+	if _, ok := index["ws/protocol/ws.proto"]; !ok {
+		t.Fatalf("bundle missing ws.proto: %v", index)
+	}
+}
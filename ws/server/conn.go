@@ -26,13 +26,19 @@ type Conn struct {
 
 	lastActive atomic.Int64 // 最后活跃时间（Unix 毫秒）
 
-	// codec 配置的编解码器（binary 解码用）
+	// codec 配置的编解码器（binary 解码用），子协议协商成功时为协商结果
 	codec codec.Codec
 
+	// negotiated 是否通过子协议协商了编码，协商后不再按帧类型猜测
+	negotiated bool
+
 	// respCodec 自动检测的响应编码器（text→JSON，binary→配置的编码器）
 	respMu    sync.RWMutex
 	respCodec codec.Codec
 
+	// reqCodecs 处理中的请求 → 解码该请求所用的编码器，按帧记录，不受后续帧影响
+	reqCodecs sync.Map
+
 	ctx       context.Context
 	cancel    context.CancelFunc
 	closeOnce sync.Once
@@ -76,6 +82,9 @@ func (c *Conn) GetMeta(key string) (any, bool) {
 	return c.ctx.Value(connMetaKey{}).(*sync.Map).Load(key)
 }
 
+// Negotiated 是否通过 WebSocket 子协议协商了编码
+func (c *Conn) Negotiated() bool { return c.negotiated }
+
 // CodecName 获取当前连接使用的编码器名称
 func (c *Conn) CodecName() string {
 	c.respMu.RLock()
@@ -83,6 +92,19 @@ func (c *Conn) CodecName() string {
 	return c.respCodec.Name()
 }
 
+// Codec 获取当前连接使用的编码器
+// 可配合 codec.DecodeData/codec.EncodeData 按 action 注册的消息类型处理 Data
+func (c *Conn) Codec() codec.Codec { return c.getRespCodec() }
+
+// RequestCodec 获取解码 req 所在帧使用的编码器
+// 文本帧与二进制帧交替到达时 Codec 随每帧变化，处理器解码 Data 应以此为准；req 不在处理中时退回 Codec
+func (c *Conn) RequestCodec(req *types.Request) codec.Codec {
+	if cc, ok := c.reqCodecs.Load(req); ok {
+		return cc.(codec.Codec)
+	}
+	return c.Codec()
+}
+
 // getRespCodec 获取响应编码器
 func (c *Conn) getRespCodec() codec.Codec {
 	c.respMu.RLock()
@@ -210,7 +232,7 @@ func (c *Conn) SendResp(resp *types.Response) error {
 // ============================================================================
 
 // readLoop 读循环，每条消息起独立协程处理，永不阻塞
-// 自动检测消息类型：text → JSON，binary → 配置的编码器
+// 已协商子协议时始终使用协商的编码器；否则自动检测消息类型：text → JSON，binary → 配置的编码器
 func (c *Conn) readLoop() {
 	defer c.Close()
 
@@ -236,8 +258,10 @@ func (c *Conn) readLoop() {
 
 		// 根据消息类型自动选择解码器
 		var reqCodec codec.Codec
-		switch msgType {
-		case websocket.MessageText:
+		switch {
+		case c.negotiated:
+			reqCodec = c.codec
+		case msgType == websocket.MessageText:
 			reqCodec = jsonCodec
 		default:
 			reqCodec = c.codec
@@ -266,10 +290,12 @@ func (c *Conn) readLoop() {
 				Code:   404,
 				Msg:    "handler not found",
 			})
+			c.releaseRequest(req)
 			continue
 		}
 
 		// 每条消息独立协程，readLoop 立即回到读取
+		c.reqCodecs.Store(req, reqCodec)
 		go func(h Handler, r *types.Request) {
 			defer func() {
 				if v := recover(); v != nil {
@@ -279,12 +305,21 @@ func (c *Conn) readLoop() {
 						Msg:    "internal server error",
 					})
 				}
+				c.reqCodecs.Delete(r)
+				c.releaseRequest(r)
 			}()
 			h(c, r)
 		}(handler, req)
 	}
 }
 
+// releaseRequest 开启 WithServerRecycleRequests 时归还 Request
+func (c *Conn) releaseRequest(req *types.Request) {
+	if c.server.cfg.recycleRequests {
+		codec.ReleaseRequest(req)
+	}
+}
+
 // writeLoop 写循环，根据响应编码器决定消息类型
 func (c *Conn) writeLoop() {
 	for {
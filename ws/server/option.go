@@ -13,9 +13,11 @@ type serverConfig struct {
 	heartbeat         time.Duration
 	allowedOriginFunc func(origin string) bool
 	maxMessageSize    int
+	recycleRequests   bool
 }
 
-// WithServerCodec 设置编解码器，支持 "json"/"msgpack"/"protobuf"，默认 "json"
+// WithServerCodec 设置默认编解码器，支持内置 "json"/"msgpack"/"protobuf"/"cbor" 及 codec.Register 注册的名称，默认 "json"
+// 客户端通过子协议声明编码时以客户端声明为准
 func WithServerCodec(name string) ServerOption {
 	return func(cfg *serverConfig) { cfg.codec = name }
 }
@@ -44,3 +46,9 @@ func WithServerAllowedOrigins(fn func(origin string) bool) ServerOption {
 func WithServerMaxMessageSize(size int) ServerOption {
 	return func(cfg *serverConfig) { cfg.maxMessageSize = size }
 }
+
+// WithServerRecycleRequests 设置 Handler 返回后是否将 Request 归还对象池，默认关闭
+// 开启后 Handler 及中间件不得在返回后继续持有 req 或 req.Data（包括交给其他协程）
+func WithServerRecycleRequests(enabled bool) ServerOption {
+	return func(cfg *serverConfig) { cfg.recycleRequests = enabled }
+}
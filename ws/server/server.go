@@ -11,6 +11,7 @@ import (
 	"github.com/tsmask/go-oam/pkg/generate"
 	"github.com/tsmask/go-oam/ws/codec"
 	"github.com/tsmask/go-oam/ws/types"
+	"google.golang.org/protobuf/proto"
 )
 
 // ============================================================================
@@ -30,6 +31,9 @@ type Handler func(*Conn, *types.Request)
 // Middleware 中间件函数类型
 type Middleware func(Handler) Handler
 
+// MessageHandler 消息处理函数类型，m 为按 action 注册的消息类型解码后的 Data
+type MessageHandler func(*Conn, *types.Request, proto.Message)
+
 // ============================================================================
 // ConnManager 连接管理器
 // ============================================================================
@@ -228,6 +232,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
 		InsecureSkipVerify: true,
+		Subprotocols:       codec.Subprotocols(),
 	})
 	if err != nil {
 		return
@@ -240,6 +245,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		codec:  s.codec,
 		sendCh: make(chan []byte, s.cfg.sendBufferSize),
 	}
+	// 客户端通过子协议声明编码时，整条连接固定使用该编解码器
+	if cc, ok := codec.FromSubprotocol(conn.Subprotocol()); ok {
+		c.codec = cc
+		c.negotiated = true
+	}
 	c.init(r)
 	c.SetMeta("remote_addr", r.RemoteAddr)
 	c.SetMeta("user_agent", r.UserAgent())
@@ -247,6 +257,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 // NewServer 创建 WebSocket 服务端
+// 编解码器名称未注册时 panic，自定义编解码器需先调用 codec.Register
 func NewServer(opts ...ServerOption) *Server {
 	cfg := serverConfig{
 		maxConns:       100000,
@@ -259,9 +270,13 @@ func NewServer(opts ...ServerOption) *Server {
 	if cfg.codec == "" {
 		cfg.codec = "json"
 	}
+	cc, err := codec.NewCodec(cfg.codec)
+	if err != nil {
+		panic("ws/server: " + err.Error())
+	}
 
 	return &Server{
-		codec:    codec.NewCodec(cfg.codec),
+		codec:    cc,
 		cfg:      cfg,
 		conns:    newConnManager(),
 		topics:   newTopicManager(),
@@ -295,6 +310,27 @@ func (s *Server) Handle(action string, handler Handler) {
 	s.handlersMu.Unlock()
 }
 
+// HandleMessage 注册按消息类型处理的处理器，action 须已通过 codec.RegisterMessage 注册，否则 panic
+// 分发时按该请求所在帧的编码（见 Conn.RequestCodec）将 Data 解码为注册的消息类型再调用 handler，解码失败回复 400
+func (s *Server) HandleMessage(action string, handler MessageHandler) {
+	if _, ok := codec.NewMessage(action); !ok {
+		panic("ws/server: HandleMessage action not registered: " + action)
+	}
+	s.Handle(action, func(c *Conn, req *types.Request) {
+		m, err := codec.DecodeData(c.RequestCodec(req), req.Action, req.Data)
+		if err != nil {
+			_ = c.SendResp(&types.Response{
+				ID:     req.ID,
+				Action: req.Action,
+				Code:   400,
+				Msg:    "invalid data: " + err.Error(),
+			})
+			return
+		}
+		handler(c, req, m)
+	})
+}
+
 // OnConnect 设置连接建立回调
 func (s *Server) OnConnect(fn func(*Conn, *http.Request)) { s.onConnect = fn }
 
@@ -1,10 +1,13 @@
 package ws
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/tsmask/go-oam/ws/client"
+	"github.com/tsmask/go-oam/ws/codec"
 	"github.com/tsmask/go-oam/ws/server"
+	"google.golang.org/protobuf/proto"
 )
 
 // ============================================================================
@@ -13,12 +16,16 @@ import (
 
 type (
 	// 服务端类型
-	Server       = server.Server
-	ConnManager  = server.ConnManager
-	Conn         = server.Conn
-	Handler      = server.Handler
-	Middleware   = server.Middleware
-	ServerOption = server.ServerOption
+	Server         = server.Server
+	ConnManager    = server.ConnManager
+	Conn           = server.Conn
+	Handler        = server.Handler
+	MessageHandler = server.MessageHandler
+	Middleware     = server.Middleware
+	ServerOption   = server.ServerOption
+
+	// 编解码器
+	Codec = codec.Codec
 
 	// 客户端类型
 	Client       = client.Client
@@ -47,6 +54,10 @@ var (
 	// 服务端错误
 	ErrSendFull = server.ErrSendFull
 
+	// 编解码错误
+	ErrUnknownCodec  = codec.ErrUnknownCodec
+	ErrUnknownAction = codec.ErrUnknownAction
+
 	// 客户端错误
 	ErrClientClosed   = client.ErrClientClosed
 	ErrConnectionLost = client.ErrConnectionLost
@@ -67,11 +78,17 @@ func NewClient(url string, opts ...ClientOption) *Client {
 	return client.NewClient(url, opts...)
 }
 
+// RegisterCodec 注册自定义编解码器，名称重复时 panic
+func RegisterCodec(name string, c Codec) { codec.Register(name, c) }
+
+// RegisterMessage 为 action 注册 Protobuf 消息类型，action 重复时 panic
+func RegisterMessage(action string, m proto.Message) { codec.RegisterMessage(action, m) }
+
 // ============================================================================
 // 服务端选项函数
 // ============================================================================
 
-// WithServerCodec 设置编解码器，支持 "json"/"msgpack"/"protobuf"，默认 "json"
+// WithServerCodec 设置默认编解码器，支持内置及 RegisterCodec 注册的名称，默认 "json"
 func WithServerCodec(name string) ServerOption { return server.WithServerCodec(name) }
 
 // WithServerMaxConns 设置最大连接数
@@ -91,11 +108,16 @@ func WithServerAllowedOrigins(fn func(origin string) bool) ServerOption {
 // WithServerMaxMessageSize 设置最大消息大小（字节），0 不限制
 func WithServerMaxMessageSize(size int) ServerOption { return server.WithServerMaxMessageSize(size) }
 
+// WithServerRecycleRequests 设置 Handler 返回后是否将 Request 归还对象池
+func WithServerRecycleRequests(enabled bool) ServerOption {
+	return server.WithServerRecycleRequests(enabled)
+}
+
 // ============================================================================
 // 客户端选项函数
 // ============================================================================
 
-// WithClientCodec 设置编解码器，支持 "json"/"msgpack"/"protobuf"，默认 "json"
+// WithClientCodec 设置编解码器，支持内置及 RegisterCodec 注册的名称，默认 "json"
 func WithClientCodec(name string) ClientOption { return client.WithClientCodec(name) }
 
 // WithClientDialTimeout 设置连接建立超时，默认 30s
@@ -117,3 +139,11 @@ func WithClientMaxReconnectAttempts(n int) ClientOption {
 func WithClientHeartbeat(interval time.Duration) ClientOption {
 	return client.WithClientHeartbeat(interval)
 }
+
+// WithClientHTTPClient 设置握手使用的 HTTP 客户端
+func WithClientHTTPClient(hc *http.Client) ClientOption { return client.WithClientHTTPClient(hc) }
+
+// WithClientRecycleResponses 设置 OnReceive 返回后是否将 Response 归还对象池
+func WithClientRecycleResponses(enabled bool) ClientOption {
+	return client.WithClientRecycleResponses(enabled)
+}
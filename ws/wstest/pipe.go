@@ -0,0 +1,131 @@
+package wstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ErrOffline 模拟网络不可达，SetOffline(true) 后拨号返回此错误
+var ErrOffline = errors.New("wstest: network offline")
+
+// errListenerClosed 监听器已关闭
+var errListenerClosed = errors.New("wstest: listener closed")
+
+// memAddr 内存连接地址，每条连接唯一，便于在服务端按 remote_addr 定位连接
+type memAddr string
+
+func (a memAddr) Network() string { return "memory" }
+func (a memAddr) String() string  { return string(a) }
+
+// memConn 包装 net.Pipe 的一端，覆盖地址信息
+type memConn struct {
+	net.Conn
+	local  net.Addr
+	remote net.Addr
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return c.local }
+func (c *memConn) RemoteAddr() net.Addr { return c.remote }
+
+// memListener 基于 net.Pipe 的内存监听器
+// 同时充当 http.Server 的 Listener 和客户端 Transport 的拨号器
+type memListener struct {
+	ch      chan net.Conn
+	done    chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	seq     int
+	conns   []net.Conn // 所有已建立连接的两端，Disconnect 时一并关闭
+	last    string     // 最近一次拨号的客户端地址
+	offline bool       // 模拟离线
+}
+
+func newMemListener() *memListener {
+	return &memListener{
+		ch:   make(chan net.Conn),
+		done: make(chan struct{}),
+	}
+}
+
+// Accept 实现 net.Listener
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.ch:
+		return c, nil
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+// Close 实现 net.Listener
+func (l *memListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	l.disconnect()
+	return nil
+}
+
+// Addr 实现 net.Listener
+func (l *memListener) Addr() net.Addr { return memAddr("wstest-server") }
+
+// dial 建立一对内存连接，服务端一端交给 Accept
+func (l *memListener) dial(ctx context.Context, _, _ string) (net.Conn, error) {
+	l.mu.Lock()
+	if l.offline {
+		l.mu.Unlock()
+		return nil, ErrOffline
+	}
+	l.seq++
+	addr := memAddr(fmt.Sprintf("wstest-client-%d", l.seq))
+	l.mu.Unlock()
+
+	cliSide, srvSide := net.Pipe()
+	cc := &memConn{Conn: cliSide, local: addr, remote: l.Addr()}
+	sc := &memConn{Conn: srvSide, local: l.Addr(), remote: addr}
+
+	select {
+	case l.ch <- sc:
+	case <-l.done:
+		cliSide.Close()
+		srvSide.Close()
+		return nil, errListenerClosed
+	case <-ctx.Done():
+		cliSide.Close()
+		srvSide.Close()
+		return nil, ctx.Err()
+	}
+
+	l.mu.Lock()
+	l.conns = append(l.conns, cc, sc)
+	l.last = string(addr)
+	l.mu.Unlock()
+	return cc, nil
+}
+
+// disconnect 关闭所有已建立的连接，模拟链路中断
+func (l *memListener) disconnect() {
+	l.mu.Lock()
+	conns := l.conns
+	l.conns = nil
+	l.mu.Unlock()
+
+	for _, c := range conns {
+		_ = c.Close()
+	}
+}
+
+// setOffline 设置离线状态
+func (l *memListener) setOffline(v bool) {
+	l.mu.Lock()
+	l.offline = v
+	l.mu.Unlock()
+}
+
+// lastAddr 最近一次拨号的客户端地址
+func (l *memListener) lastAddr() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
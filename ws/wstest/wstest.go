@@ -0,0 +1,320 @@
+// Package wstest 提供进程内 WebSocket 测试台，不占用真实网络端口。
+//
+// Harness 将 server.Server 挂在基于 net.Pipe 的内存监听器上，
+// 并创建一个已连接的 client.Client，可直接在单元测试中驱动 Handler：
+//
+//	srv := server.NewServer()
+//	srv.Handle("echo", func(c *server.Conn, req *types.Request) {
+//	    _ = c.SendResp(&types.Response{ID: req.ID, Action: req.Action, Code: 200, Data: req.Data})
+//	})
+//
+//	h := wstest.New(t, srv)
+//	id := h.Send("echo", []byte(`"hi"`))
+//	resp := h.ExpectResponse(id)
+//
+// 断开重连场景：
+//
+//	h.SetOffline(true)
+//	h.Disconnect()
+//	h.ExpectState(client.StateReconnecting)
+//	h.SetOffline(false)
+//	h.ExpectState(client.StateConnected)
+package wstest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsmask/go-oam/pkg/generate"
+	"github.com/tsmask/go-oam/ws/client"
+	"github.com/tsmask/go-oam/ws/server"
+	"github.com/tsmask/go-oam/ws/types"
+)
+
+// URL 测试台客户端使用的连接地址，仅作握手用，不会解析
+const URL = "ws://wstest/ws"
+
+// DefaultTimeout Expect 系列断言的默认等待时长
+const DefaultTimeout = 3 * time.Second
+
+// Harness 进程内 WebSocket 测试台
+//
+// 收到的响应与状态变更全部缓存，Expect 系列方法按条件匹配并消费，
+// 未匹配的消息保留给后续断言，因此断言顺序不必与到达顺序一致。
+type Harness struct {
+	// Server 被测服务端
+	Server *server.Server
+	// Client 已连接的客户端，默认开启自动重连、关闭心跳
+	Client *client.Client
+	// Timeout Expect 系列方法的等待时长，默认 DefaultTimeout
+	Timeout time.Duration
+
+	t       testing.TB
+	ln      *memListener
+	httpSrv *http.Server
+
+	mu     sync.Mutex
+	notify chan struct{}     // 有新消息或新状态时关闭并重建，唤醒等待者
+	resps  []*types.Response // 尚未被消费的响应
+	states []client.State    // 尚未被消费的状态变更
+	errs   []error           // 客户端错误回调记录
+}
+
+// New 创建测试台并建立连接，测试结束时自动关闭
+//
+// opts 追加在默认选项（自动重连开启、心跳关闭）之后，可覆盖默认值。
+func New(t testing.TB, srv *server.Server, opts ...client.ClientOption) *Harness {
+	t.Helper()
+
+	ln := newMemListener()
+	h := &Harness{
+		Server:  srv,
+		Timeout: DefaultTimeout,
+		t:       t,
+		ln:      ln,
+		httpSrv: &http.Server{Handler: srv},
+		notify:  make(chan struct{}),
+	}
+	go func() { _ = h.httpSrv.Serve(ln) }()
+
+	hc := &http.Client{Transport: &http.Transport{DialContext: ln.dial}}
+	base := []client.ClientOption{
+		client.WithClientHTTPClient(hc),
+		client.WithClientAutoReconnect(true),
+		client.WithClientHeartbeat(0),
+		client.WithClientDialTimeout(time.Second),
+	}
+	h.Client = client.NewClient(URL, append(base, opts...)...)
+	h.Client.OnReceive(h.onReceive)
+	h.Client.OnState(h.onState)
+	h.Client.OnError(h.onError)
+
+	t.Cleanup(h.Close)
+
+	if err := h.Client.Connect(context.Background()); err != nil {
+		t.Fatalf("wstest: connect: %v", err)
+	}
+	return h
+}
+
+// Close 关闭客户端、服务端连接和内存监听器（幂等）
+func (h *Harness) Close() {
+	h.Client.Close()
+	h.Server.Shutdown()
+	_ = h.httpSrv.Close()
+	_ = h.ln.Close()
+}
+
+// ============================================================================
+// 发送
+// ============================================================================
+
+// Send 发送请求并返回请求 ID，ID 由测试台生成以便后续 ExpectResponse
+func (h *Harness) Send(action string, data []byte) string {
+	h.t.Helper()
+	id := generate.String(21)
+	h.SendRequest(&types.Request{ID: id, Action: action, Data: data})
+	return id
+}
+
+// SendRequest 发送完整请求，失败时终止测试
+func (h *Harness) SendRequest(req *types.Request) {
+	h.t.Helper()
+	if err := h.Client.Send(req); err != nil {
+		h.t.Fatalf("wstest: send %q: %v", req.Action, err)
+	}
+}
+
+// ============================================================================
+// 断言
+// ============================================================================
+
+// ExpectResponse 等待 ID 匹配的响应
+func (h *Harness) ExpectResponse(id string) *types.Response {
+	h.t.Helper()
+	resp, ok := h.waitResp(func(r *types.Response) bool { return r.ID == id })
+	if !ok {
+		h.t.Fatalf("wstest: no response with id %q within %v", id, h.Timeout)
+	}
+	return resp
+}
+
+// ExpectPublish 等待 topic 上的发布消息
+//
+// 约定发布消息 ID 为空、Action 为 topic 名称，与 Server.Publish 的常见用法一致。
+func (h *Harness) ExpectPublish(topic string) *types.Response {
+	h.t.Helper()
+	resp, ok := h.waitResp(func(r *types.Response) bool { return r.ID == "" && r.Action == topic })
+	if !ok {
+		h.t.Fatalf("wstest: no publish on topic %q within %v", topic, h.Timeout)
+	}
+	return resp
+}
+
+// ExpectMatch 等待满足条件的任意响应
+func (h *Harness) ExpectMatch(match func(*types.Response) bool) *types.Response {
+	h.t.Helper()
+	resp, ok := h.waitResp(match)
+	if !ok {
+		h.t.Fatalf("wstest: no matching response within %v", h.Timeout)
+	}
+	return resp
+}
+
+// ExpectNoPublish 在 d 时间内不应收到 topic 上的发布消息
+func (h *Harness) ExpectNoPublish(topic string, d time.Duration) {
+	h.t.Helper()
+	if resp, ok := waitFor(h, d, func() (*types.Response, bool) {
+		return h.takeResp(func(r *types.Response) bool { return r.ID == "" && r.Action == topic })
+	}); ok {
+		h.t.Fatalf("wstest: unexpected publish on topic %q: %+v", topic, resp)
+	}
+}
+
+// ExpectState 等待客户端进入指定状态，之前的状态变更被消费
+func (h *Harness) ExpectState(want client.State) {
+	h.t.Helper()
+	_, ok := waitFor(h, h.Timeout, func() (struct{}, bool) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i, s := range h.states {
+			if s == want {
+				h.states = h.states[i+1:]
+				return struct{}{}, true
+			}
+		}
+		return struct{}{}, false
+	})
+	if !ok {
+		h.t.Fatalf("wstest: client did not reach state %s within %v (now %s)", want, h.Timeout, h.Client.State())
+	}
+}
+
+// Errors 返回客户端错误回调记录的所有错误
+func (h *Harness) Errors() []error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]error(nil), h.errs...)
+}
+
+// ============================================================================
+// 连接控制
+// ============================================================================
+
+// Conn 返回当前客户端连接在服务端侧对应的 Conn
+//
+// 重连后返回新连接；连接尚未在服务端注册时等待，超时终止测试。
+func (h *Harness) Conn() *server.Conn {
+	h.t.Helper()
+	addr := h.ln.lastAddr()
+	conn, ok := waitFor(h, h.Timeout, func() (*server.Conn, bool) {
+		var found *server.Conn
+		h.Server.ConnManager().Range(func(c *server.Conn) bool {
+			if v, ok := c.GetMeta("remote_addr"); ok && v == addr {
+				found = c
+				return false
+			}
+			return true
+		})
+		return found, found != nil
+	})
+	if !ok {
+		h.t.Fatalf("wstest: server conn for %s not registered within %v", addr, h.Timeout)
+	}
+	return conn
+}
+
+// Disconnect 切断当前所有内存连接，模拟链路中断
+// 客户端开启自动重连时会进入 StateReconnecting 并尝试重新拨号。
+func (h *Harness) Disconnect() { h.ln.disconnect() }
+
+// SetOffline 设置网络是否离线，离线期间拨号返回 ErrOffline
+func (h *Harness) SetOffline(offline bool) { h.ln.setOffline(offline) }
+
+// ============================================================================
+// 内部方法
+// ============================================================================
+
+// onReceive 缓存收到响应的副本
+// 开启 WithClientRecycleResponses 时 resp 在回调返回后归还对象池，不能直接保存。
+func (h *Harness) onReceive(resp *types.Response) {
+	cp := &types.Response{
+		ID:     strings.Clone(resp.ID),
+		Ts:     resp.Ts,
+		Action: strings.Clone(resp.Action),
+		Code:   resp.Code,
+		Msg:    strings.Clone(resp.Msg),
+		Data:   bytes.Clone(resp.Data),
+	}
+	h.mu.Lock()
+	h.resps = append(h.resps, cp)
+	h.wakeLocked()
+	h.mu.Unlock()
+}
+
+// onState 缓存状态变更
+func (h *Harness) onState(s client.State) {
+	h.mu.Lock()
+	h.states = append(h.states, s)
+	h.wakeLocked()
+	h.mu.Unlock()
+}
+
+// onError 记录客户端错误
+func (h *Harness) onError(err error) {
+	h.mu.Lock()
+	h.errs = append(h.errs, err)
+	h.wakeLocked()
+	h.mu.Unlock()
+}
+
+// wakeLocked 唤醒所有等待者，调用方需持有 mu
+func (h *Harness) wakeLocked() {
+	close(h.notify)
+	h.notify = make(chan struct{})
+}
+
+// takeResp 取出并移除第一条匹配的响应
+func (h *Harness) takeResp(match func(*types.Response) bool) (*types.Response, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, r := range h.resps {
+		if match(r) {
+			h.resps = append(h.resps[:i], h.resps[i+1:]...)
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// waitResp 在 Timeout 内等待匹配的响应
+func (h *Harness) waitResp(match func(*types.Response) bool) (*types.Response, bool) {
+	return waitFor(h, h.Timeout, func() (*types.Response, bool) { return h.takeResp(match) })
+}
+
+// waitFor 轮询 check 直到成功或超时，每次有新事件时重新检查
+// 服务端连接注册不会触发事件，因此同时以短间隔兜底轮询。
+func waitFor[T any](h *Harness, d time.Duration, check func() (T, bool)) (T, bool) {
+	deadline := time.NewTimer(d)
+	defer deadline.Stop()
+	for {
+		h.mu.Lock()
+		notify := h.notify
+		h.mu.Unlock()
+
+		if v, ok := check(); ok {
+			return v, true
+		}
+		select {
+		case <-notify:
+		case <-time.After(10 * time.Millisecond):
+		case <-deadline.C:
+			return check()
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package wstest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/tsmask/go-oam/ws/client"
+	"github.com/tsmask/go-oam/ws/codec"
+	"github.com/tsmask/go-oam/ws/protocol"
+	"github.com/tsmask/go-oam/ws/server"
+	"github.com/tsmask/go-oam/ws/types"
+	"google.golang.org/protobuf/proto"
+)
+
+// newEchoServer 创建带 echo/subscribe 处理器的服务端
+func newEchoServer() *server.Server {
+	srv := server.NewServer(server.WithServerHeartbeat(0))
+	srv.Handle("echo", func(c *server.Conn, req *types.Request) {
+		_ = c.SendResp(&types.Response{ID: req.ID, Action: req.Action, Code: 200, Data: req.Data})
+	})
+	srv.Handle("subscribe", func(c *server.Conn, req *types.Request) {
+		var topic string
+		_ = json.Unmarshal(req.Data, &topic)
+		c.Subscribe(topic)
+		_ = c.SendResp(&types.Response{ID: req.ID, Action: req.Action, Code: 200})
+	})
+	return srv
+}
+
+func TestHarness_Echo(t *testing.T) {
+	h := New(t, newEchoServer())
+
+	id := h.Send("echo", []byte(`"hello"`))
+	resp := h.ExpectResponse(id)
+	if resp.Code != 200 || string(resp.Data) != `"hello"` {
+		t.Fatalf("resp = %+v, want code 200 data \"hello\"", resp)
+	}
+
+	if h.Conn().CodecName() != "json" {
+		t.Fatalf("server conn codec = %q, want json", h.Conn().CodecName())
+	}
+}
+
+func TestHarness_HandlerNotFound(t *testing.T) {
+	h := New(t, newEchoServer())
+
+	h.Send("missing", nil)
+	resp := h.ExpectMatch(func(r *types.Response) bool { return r.Action == "missing" })
+	if resp.Code != 404 {
+		t.Fatalf("code = %d, want 404", resp.Code)
+	}
+}
+
+func TestHarness_Publish(t *testing.T) {
+	srv := newEchoServer()
+	h := New(t, srv)
+
+	h.ExpectResponse(h.Send("subscribe", []byte(`"news"`)))
+	h.ExpectNoPublish("news", 50*time.Millisecond)
+
+	srv.Publish("news", &types.Response{Action: "news", Code: 200, Data: []byte(`{"n":1}`)})
+	resp := h.ExpectPublish("news")
+	if string(resp.Data) != `{"n":1}` {
+		t.Fatalf("publish data = %s", resp.Data)
+	}
+}
+
+func TestHarness_Reconnect(t *testing.T) {
+	srv := newEchoServer()
+	h := New(t, srv)
+	h.ExpectState(client.StateConnected)
+	first := h.Conn()
+
+	h.SetOffline(true)
+	h.Disconnect()
+	h.ExpectState(client.StateReconnecting)
+
+	h.SetOffline(false)
+	h.ExpectState(client.StateConnected)
+
+	second := h.Conn()
+	if second.ID() == first.ID() {
+		t.Fatalf("server conn not replaced after reconnect")
+	}
+	h.ExpectResponse(h.Send("echo", []byte(`1`)))
+}
+
+func TestHarness_SubprotocolNegotiation(t *testing.T) {
+	for _, name := range []string{"json", "msgpack", "protobuf", "cbor"} {
+		t.Run(name, func(t *testing.T) {
+			// 服务端默认 msgpack，编码以客户端子协议声明为准
+			srv := server.NewServer(server.WithServerCodec("msgpack"), server.WithServerHeartbeat(0))
+			srv.Handle("echo", func(c *server.Conn, req *types.Request) {
+				_ = c.SendResp(&types.Response{ID: req.ID, Action: req.Action, Code: 200, Data: req.Data})
+			})
+			h := New(t, srv, client.WithClientCodec(name))
+
+			resp := h.ExpectResponse(h.Send("echo", []byte(`{"k":"v"}`)))
+			if string(resp.Data) != `{"k":"v"}` {
+				t.Fatalf("data = %s", resp.Data)
+			}
+			conn := h.Conn()
+			if !conn.Negotiated() || conn.CodecName() != name {
+				t.Fatalf("negotiated = %v codec = %q, want %q", conn.Negotiated(), conn.CodecName(), name)
+			}
+		})
+	}
+}
+
+func TestHarness_MessageSchema(t *testing.T) {
+	codec.RegisterMessage("wstest.schema", &protocol.Request{})
+
+	for _, name := range []string{"json", "protobuf"} {
+		t.Run(name, func(t *testing.T) {
+			srv := server.NewServer(server.WithServerHeartbeat(0))
+			srv.HandleMessage("wstest.schema", func(c *server.Conn, req *types.Request, m proto.Message) {
+				in := m.(*protocol.Request)
+				data, _ := codec.EncodeData(c.Codec(), &protocol.Request{Id: in.Id, Action: in.Action + ".ack"})
+				_ = c.SendResp(&types.Response{ID: req.ID, Action: req.Action, Code: 200, Data: data})
+			})
+			h := New(t, srv, client.WithClientCodec(name))
+
+			data, err := codec.EncodeData(h.Client.Codec(), &protocol.Request{Id: "inner", Action: "alarm"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := h.ExpectResponse(h.Send("wstest.schema", data))
+			if resp.Code != 200 {
+				t.Fatalf("resp = %+v", resp)
+			}
+			m, err := codec.DecodeData(h.Client.Codec(), resp.Action, resp.Data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out := m.(*protocol.Request); out.Id != "inner" || out.Action != "alarm.ack" {
+				t.Fatalf("decoded = %v", out)
+			}
+
+			if resp := h.ExpectResponse(h.Send("wstest.schema", []byte(`"x"`))); resp.Code != 400 {
+				t.Fatalf("undecodable data: resp = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestHarness_MessageSchemaMixedFrames(t *testing.T) {
+	codec.RegisterMessage("wstest.mixed", &protocol.Request{})
+
+	// 第一条（文本帧）在第二条（二进制帧）到达后才解码，期间连接的响应编码器已切换
+	second := make(chan struct{})
+	got := make(chan string, 2)
+	srv := server.NewServer(server.WithServerHeartbeat(0), server.WithServerCodec("protobuf"))
+	srv.Use(func(next server.Handler) server.Handler {
+		return func(c *server.Conn, req *types.Request) {
+			if req.ID == "text" {
+				<-second
+			} else {
+				close(second)
+			}
+			next(c, req)
+		}
+	})
+	srv.HandleMessage("wstest.mixed", func(c *server.Conn, req *types.Request, m proto.Message) {
+		got <- m.(*protocol.Request).Id
+	})
+	h := New(t, srv)
+
+	hc := &http.Client{Transport: &http.Transport{DialContext: h.ln.dial}}
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout)
+	defer cancel()
+	raw, _, err := websocket.Dial(ctx, URL, &websocket.DialOptions{HTTPClient: hc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.CloseNow()
+
+	pb, _ := codec.NewCodec("protobuf")
+	frames := []struct {
+		typ websocket.MessageType
+		cc  codec.Codec
+		id  string
+	}{
+		{websocket.MessageText, codec.JSON(), "text"},
+		{websocket.MessageBinary, pb, "binary"},
+	}
+	for _, f := range frames {
+		data, err := codec.EncodeData(f.cc, &protocol.Request{Id: f.id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := f.cc.MarshalRequest(&types.Request{ID: f.id, Action: "wstest.mixed", Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := raw.Write(ctx, f.typ, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	seen := map[string]bool{}
+	for range frames {
+		select {
+		case id := <-got:
+			seen[id] = true
+		case <-ctx.Done():
+			t.Fatalf("decoded %v, want text and binary", seen)
+		}
+	}
+	if !seen["text"] || !seen["binary"] {
+		t.Fatalf("decoded %v, want text and binary", seen)
+	}
+}
+
+func TestHarness_RecycleResponses(t *testing.T) {
+	h := New(t, newEchoServer(), client.WithClientRecycleResponses(true))
+
+	first := h.ExpectResponse(h.Send("echo", []byte(`"first"`)))
+	h.ExpectResponse(h.Send("echo", []byte(`"second"`)))
+	if first.Action != "echo" || string(first.Data) != `"first"` {
+		t.Fatalf("first resp = %+v, want cached copy of echo \"first\"", first)
+	}
+}